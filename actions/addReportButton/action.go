@@ -10,14 +10,16 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
 	interfaces2 "github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
 )
 
 type Action struct {
 	logger *zap.Logger
-	bot    *telego.Bot
+	bot    botAPI.BotAPI
 
 	isAnonymousReport bool
 	msgPrefix         string
@@ -91,7 +93,7 @@ func (r *Action) PerMessage() bool {
 	return true
 }
 
-func New(logger *zap.Logger, bot *telego.Bot, config map[string]any) (interfaces.Action, error) {
+func New(logger *zap.Logger, _ interfaces2.Deps, _ bannedDB.BanDB, bot botAPI.BotAPI, config map[string]any) (interfaces.Action, error) {
 	anonymousReport, err := config2.GetOptionBoolWithDefault(config, "isAnonymousReport", true)
 	if err != nil {
 		return nil, err
@@ -3,29 +3,43 @@ package deleteAndBan
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/mymmrac/telego"
 	tu "github.com/mymmrac/telego/telegoutil"
 	"go.uber.org/zap"
 
 	"github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/audit"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
 	interfaces2 "github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
 	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
 )
 
 type Action struct {
-	logger *zap.Logger
-	bot    *telego.Bot
+	logger   *zap.Logger
+	bot      botAPI.BotAPI
+	banDB    bannedDB.BanDB
+	auditLog *audit.Log
+	events   *events.Hub
 
 	cleanState    bool
 	dryRun        bool
 	deleteAll     bool
 	verboseDryRun bool
+	// trainSpam passes messages of banned users to rules that learn from spam, it should be set only for chains that
+	// ban users because of the text of their messages
+	trainSpam bool
+	// Ban is permanent if duration is not set
+	banDuration time.Duration
 }
 
-func (r *Action) Apply(callback interfaces2.StatefulFilter, _ *scoringResult.ScoringResult, chatID telego.ChatID, messageIDs []int64, userID int64) error {
+func (r *Action) Apply(callback interfaces2.StatefulFilter, score *scoringResult.ScoringResult, chatID telego.ChatID, messageIDs []int64, userID int64) error {
 	if r.dryRun {
 		r.logger.Debug("applying action in dry run mode")
 		if r.verboseDryRun {
@@ -54,10 +68,26 @@ func (r *Action) Apply(callback interfaces2.StatefulFilter, _ *scoringResult.Sco
 		}
 	}
 
-	err := tg.BanUser(r.bot, chatID, userID, r.deleteAll)
+	chatIDs, err := r.banDB.ChatsFor(chatID.ID)
+	if err != nil {
+		return err
+	}
+	err = tg.BanUserInChats(r.bot, chatIDs, userID, r.deleteAll)
 	if err != nil {
 		r.logger.Error("failed to ban user", zap.Int64("userID", userID), zap.Error(err))
 	}
+	banned := tg.Succeeded(chatIDs, err)
+	if r.trainSpam && len(banned) > 0 {
+		r.publishSpam(userID)
+	}
+
+	if r.banDuration > 0 {
+		// Ban is lifted only where it was applied
+		err = r.banDB.BanUserFor(userID, banned, r.banDuration)
+		if err != nil {
+			r.logger.Error("failed to set ban duration", zap.Int64("userID", userID), zap.Error(err))
+		}
+	}
 
 	msgIds := make([]int, 0, len(messageIDs))
 	for _, messageID := range messageIDs {
@@ -71,6 +101,15 @@ func (r *Action) Apply(callback interfaces2.StatefulFilter, _ *scoringResult.Sco
 	if err != nil {
 		return err
 	}
+	r.auditLog.Record(&auditEvent.AuditEvent{
+		Action:  audit.ActionDelete,
+		UserId:  userID,
+		ChatId:  chatID.ID,
+		Chain:   callback.GetFilterName(),
+		Rule:    score.GetRule(),
+		Reason:  score.GetReason(),
+		Details: fmt.Sprintf("%v messages", len(msgIds)),
+	})
 
 	if r.cleanState {
 		err = callback.RemoveState(userID)
@@ -83,6 +122,19 @@ func (r *Action) Apply(callback interfaces2.StatefulFilter, _ *scoringResult.Sco
 	return nil
 }
 
+// publishSpam passes message of the banned user to rules that learn from spam. Message is known only by the excerpt
+// that chain has recorded with the ban.
+func (r *Action) publishSpam(userID int64) {
+	record, err := r.banDB.GetBan(userID)
+	if err != nil {
+		if !errors.Is(err, bannedDB.ErrNotBanned) {
+			r.logger.Error("failed to get ban", zap.Int64("userID", userID), zap.Error(err))
+		}
+		return
+	}
+	r.events.PublishTraining(events.Spam, record.GetMessageExcerpt())
+}
+
 var ErrNotSupported = errors.New("not supported")
 
 func (r *Action) GetName() string {
@@ -97,7 +149,7 @@ func (r *Action) ApplyToMessage(_ interfaces2.StatefulFilter, _ *scoringResult.S
 	return ErrNotSupported
 }
 
-func New(logger *zap.Logger, bot *telego.Bot, config map[string]any) (interfaces.Action, error) {
+func New(logger *zap.Logger, deps interfaces2.Deps, banDB bannedDB.BanDB, bot botAPI.BotAPI, config map[string]any) (interfaces.Action, error) {
 	cleanState, err := config2.GetOptionBoolWithDefault(config, "cleanState", false)
 	if err != nil {
 		return nil, err
@@ -114,16 +166,32 @@ func New(logger *zap.Logger, bot *telego.Bot, config map[string]any) (interfaces
 	if err != nil {
 		return nil, err
 	}
+	banDuration, err := config2.GetOptionDurationWithDefault(config, "banDuration", 0)
+	if err != nil {
+		return nil, err
+	}
+	if banDuration < 0 {
+		return nil, bannedDB.ErrDurationNotPositive
+	}
+	trainSpam, err := config2.GetOptionBoolWithDefault(config, "trainSpam", false)
+	if err != nil {
+		return nil, err
+	}
 	return &Action{
 		logger:        logger,
 		bot:           bot,
+		banDB:         banDB,
+		auditLog:      deps.Audit,
+		events:        deps.Events,
 		dryRun:        dryRyn,
 		cleanState:    cleanState,
 		deleteAll:     deleteAll,
 		verboseDryRun: verboseDryRun,
+		trainSpam:     trainSpam,
+		banDuration:   banDuration,
 	}, nil
 }
 
 func Help() string {
-	return "deleteAndBan doesn't require any parameter"
+	return "deleteAndBan doesn't require any parameter, optional: `banDuration` (e.g. `7d`, ban is permanent by default), `trainSpam` (train rules that learn from spam on messages of banned users, enable only for chains that ban because of the text, default false)"
 }
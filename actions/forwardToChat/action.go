@@ -8,17 +8,20 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
 	interfaces2 "github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
 	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
 )
 
 type Action struct {
 	logger *zap.Logger
-	bot    *telego.Bot
+	bot    botAPI.BotAPI
 
-	forwardToChatID int64
+	forwardToChatID   int64
+	moderationButtons bool
 }
 
 func (r *Action) Apply(_ interfaces2.StatefulFilter, _ *scoringResult.ScoringResult, _ telego.ChatID, _ []int64, _ int64) error {
@@ -63,29 +66,47 @@ func (r *Action) ApplyToMessage(_ interfaces2.StatefulFilter, score *scoringResu
 		return err
 	}
 
-	msgText := fmt.Sprintf("used_id: %v\nmessage_spam_score: %v\n\nban_reason:\n%v", forwardedMsg.From.ID, score.Score,
+	msgText := fmt.Sprintf("used_id: %v\nmessage_spam_score: %v\n\nban_reason:\n%v", msg.From.ID, score.Score,
 		score.Reason)
-	err = tg.SendMarkdownMessage(r.bot, telego.ChatID{ID: r.forwardToChatID}, &forwardedMsg.MessageID, msgText)
+	params := &telego.SendMessageParams{
+		ChatID:    telego.ChatID{ID: r.forwardToChatID},
+		Text:      msgText,
+		ParseMode: telego.ModeMarkdownV2,
+		ReplyParameters: &telego.ReplyParameters{
+			MessageID: forwardedMsg.MessageID,
+		},
+	}
+	if r.moderationButtons {
+		params.ReplyMarkup = tg.ModerationKeyboard(msg.Chat.ID, msg.From.ID, msg.MessageID)
+	}
+	_, err = r.bot.SendMessage(params)
 	if err != nil {
-		err = tg.SendMessage(r.bot, telego.ChatID{ID: r.forwardToChatID}, &forwardedMsg.MessageID, msgText)
+		params.ParseMode = ""
+		_, err = r.bot.SendMessage(params)
 	}
 
 	return err
 }
 
-func New(logger *zap.Logger, bot *telego.Bot, config map[string]any) (interfaces.Action, error) {
+func New(logger *zap.Logger, _ interfaces2.Deps, _ bannedDB.BanDB, bot botAPI.BotAPI, config map[string]any) (interfaces.Action, error) {
 	forwardToChatID, err := config2.GetOptionInt(config, "forwardToChatID")
 	if err != nil {
 		return nil, err
 	}
 
+	moderationButtons, err := config2.GetOptionBoolWithDefault(config, "moderationButtons", true)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Action{
-		logger:          logger,
-		bot:             bot,
-		forwardToChatID: int64(forwardToChatID),
+		logger:            logger,
+		bot:               bot,
+		forwardToChatID:   int64(forwardToChatID),
+		moderationButtons: moderationButtons,
 	}, nil
 }
 
 func Help() string {
-	return "deleteAndBan doesn't require any parameter"
+	return "forwardToChat requires `forwardToChatID` parameter, optional `moderationButtons` (default true) adds buttons to ban, unban, delete the message or verify the user"
 }
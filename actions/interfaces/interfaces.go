@@ -4,8 +4,10 @@ import (
 	"github.com/mymmrac/telego"
 	"go.uber.org/zap"
 
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 )
 
 type Action interface {
@@ -15,6 +17,6 @@ type Action interface {
 	PerMessage() bool
 }
 
-type InitFunc func(*zap.Logger, *telego.Bot, map[string]any) (Action, error)
+type InitFunc func(*zap.Logger, interfaces.Deps, bannedDB.BanDB, botAPI.BotAPI, map[string]any) (Action, error)
 
 type HelpFunc func() string
@@ -0,0 +1,94 @@
+package kick
+
+import (
+	"errors"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/audit"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	interfaces2 "github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+// Action removes user from the chat without banning, so the user can join again
+type Action struct {
+	logger   *zap.Logger
+	bot      botAPI.BotAPI
+	auditLog *audit.Log
+
+	dryRun bool
+}
+
+func (r *Action) Apply(callback interfaces2.StatefulFilter, score *scoringResult.ScoringResult, chatID telego.ChatID, messageIDs []int64, userID int64) error {
+	if r.dryRun {
+		r.logger.Debug("applying action in dry run mode", zap.Int64("userID", userID))
+		return nil
+	}
+
+	for _, messageID := range messageIDs {
+		err := r.bot.DeleteMessage(tu.Delete(chatID, int(messageID)))
+		if err != nil {
+			r.logger.Warn("failed to delete message", zap.Int64("messageID", messageID), zap.Error(err))
+		}
+	}
+
+	err := tg.BanUser(r.bot, chatID, userID, false)
+	if err != nil {
+		r.logger.Error("failed to kick user", zap.Int64("userID", userID), zap.Error(err))
+		return err
+	}
+
+	r.auditLog.Record(&auditEvent.AuditEvent{
+		Action: audit.ActionKick,
+		UserId: userID,
+		ChatId: chatID.ID,
+		Chain:  callback.GetFilterName(),
+		Rule:   score.GetRule(),
+		Reason: score.GetReason(),
+	})
+
+	return r.bot.UnbanChatMember(&telego.UnbanChatMemberParams{
+		ChatID:       chatID,
+		UserID:       userID,
+		OnlyIfBanned: true,
+	})
+}
+
+var ErrNotSupported = errors.New("not supported")
+
+func (r *Action) GetName() string {
+	return "kick"
+}
+
+func (r *Action) PerMessage() bool {
+	return false
+}
+
+func (r *Action) ApplyToMessage(_ interfaces2.StatefulFilter, _ *scoringResult.ScoringResult, _ *telego.Message) error {
+	return ErrNotSupported
+}
+
+func New(logger *zap.Logger, deps interfaces2.Deps, _ bannedDB.BanDB, bot botAPI.BotAPI, config map[string]any) (interfaces.Action, error) {
+	dryRun, err := config2.GetOptionBoolWithDefault(config, "dryRun", true)
+	if err != nil {
+		return nil, err
+	}
+	return &Action{
+		logger:   logger,
+		bot:      bot,
+		auditLog: deps.Audit,
+		dryRun:   dryRun,
+	}, nil
+}
+
+func Help() string {
+	return "kick removes the user from the chat without banning, optional: `dryRun` (default true)"
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/Civil/tg-simple-regex-antispam/actions/deleteAndBan"
 	"github.com/Civil/tg-simple-regex-antispam/actions/forwardToChat"
 	"github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/actions/kick"
 )
 
 var (
@@ -14,11 +15,13 @@ var (
 		"deleteAndBan":    deleteAndBan.New,
 		"addReportButton": addReportButton.New,
 		"forwardToChat":   forwardToChat.New,
+		"kick":            kick.New,
 	}
 	supportedActionsHelp = map[string]interfaces.HelpFunc{
 		"deleteAndBan":    deleteAndBan.Help,
 		"addReportButton": addReportButton.Help,
 		"forwardToChat":   forwardToChat.Help,
+		"kick":            kick.Help,
 	}
 )
 
@@ -0,0 +1,288 @@
+package adminAPI
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/chains"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+// maxRequestSize limits size of request bodies, commands and ban requests are tiny
+const maxRequestSize = 64 << 10
+
+// CommandExecutor runs admin commands, the same way as they are run for `/admin` messages
+type CommandExecutor interface {
+	ExecuteAdminCommand(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) (bool, error)
+}
+
+// Server is a local HTTP API for the same operations that are available through `/admin` messages. Changes are made
+// by executing admin commands, their replies are returned instead of being sent to telegram.
+type Server struct {
+	logger   *zap.Logger
+	cfg      config.AdminAPIConfig
+	executor CommandExecutor
+	bot      botAPI.BotAPI
+	banDB    bannedDB.BanDB
+	chains   *chains.Manager
+
+	server *http.Server
+}
+
+// CommandRequest is a command as it would be written after `/admin`, e.g. `bandb ban 12345 1d`
+type CommandRequest struct {
+	Command string `json:"command"`
+	// ChatID is a chat where command is issued, 0 means that it is not related to any chat
+	ChatID int64 `json:"chat_id,omitempty"`
+}
+
+// CommandResponse contains replies of the command, that would be sent to telegram otherwise
+type CommandResponse struct {
+	Replies []string `json:"replies"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// BanRequest bans the user, by default permanently and with removal of all messages
+type BanRequest struct {
+	Duration string `json:"duration,omitempty"`
+	// ChatID is a chat where user is banned, it is required unless bans are propagated to all chats
+	ChatID       int64 `json:"chat_id,omitempty"`
+	KeepMessages bool  `json:"keep_messages,omitempty"`
+}
+
+type Ban struct {
+	UserID int64           `json:"user_id"`
+	Record json.RawMessage `json:"record"`
+}
+
+func New(logger *zap.Logger, cfg config.AdminAPIConfig, executor CommandExecutor, bot botAPI.BotAPI,
+	banDB bannedDB.BanDB, chains *chains.Manager,
+) *Server {
+	return &Server{
+		logger:   logger.With(zap.String("component", "admin_api")),
+		cfg:      cfg,
+		executor: executor,
+		bot:      bot,
+		banDB:    banDB,
+		chains:   chains,
+	}
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/commands", s.commandHandler)
+	mux.HandleFunc("GET /api/v1/chains", s.chainsHandler)
+	mux.HandleFunc("GET /api/v1/bans", s.listBansHandler)
+	mux.HandleFunc("GET /api/v1/bans/{user_id}", s.getBanHandler)
+	mux.HandleFunc("PUT /api/v1/bans/{user_id}", s.banHandler)
+	mux.HandleFunc("DELETE /api/v1/bans/{user_id}", s.unbanHandler)
+	return s.authorized(mux)
+}
+
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.cfg.ListenAddress)
+	if err != nil {
+		return err
+	}
+	s.server = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.logger.Info("serving admin api", zap.String("listen_address", listener.Addr().String()))
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("admin api server failed", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Stop() {
+	if s.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		s.logger.Warn("failed to stop admin api server", zap.Error(err))
+	}
+}
+
+func (s *Server) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+			s.logger.Warn("unauthorized admin api request", zap.String("remote_addr", req.RemoteAddr))
+			writeJSON(w, http.StatusUnauthorized, CommandResponse{Replies: []string{}, Error: "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, CommandResponse{Replies: []string{}, Error: err.Error()})
+}
+
+// execute runs admin command and responds with its replies
+func (s *Server) execute(w http.ResponseWriter, chatID int64, tokens []string) {
+	message := &telego.Message{
+		Chat: telego.Chat{ID: chatID},
+		From: &telego.User{ID: s.cfg.AdminID},
+		Text: strings.Join(append([]string{"/admin"}, tokens...), " "),
+	}
+	logger := s.logger.With(zap.Int64("chat_id", chatID), zap.Strings("tokens", tokens))
+	logger.Info("admin api command")
+
+	recorder := tg.NewReplyRecorder(s.bot, message)
+	found, err := s.executor.ExecuteAdminCommand(logger, recorder, message, tokens)
+	res := CommandResponse{Replies: recorder.Replies()}
+	switch {
+	case !found:
+		res.Error = ErrUnknownCommand.Error()
+		writeJSON(w, http.StatusNotFound, res)
+	case err != nil:
+		logger.Warn("admin api command failed", zap.Error(err))
+		res.Error = err.Error()
+		writeJSON(w, http.StatusBadRequest, res)
+	default:
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+func (s *Server) commandHandler(w http.ResponseWriter, req *http.Request) {
+	var cmd CommandRequest
+	err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestSize)).Decode(&cmd)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.execute(w, cmd.ChatID, strings.Fields(cmd.Command))
+}
+
+func (s *Server) chainsHandler(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.chains.Describe())
+}
+
+func (s *Server) listBansHandler(w http.ResponseWriter, _ *http.Request) {
+	userIDs, err := s.banDB.ListUserIDs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	res := make([]Ban, 0, len(userIDs))
+	for _, userID := range userIDs {
+		record, err := s.banDB.GetBan(userID)
+		if errors.Is(err, bannedDB.ErrNotBanned) {
+			continue
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		data, err := protojson.Marshal(record)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		res = append(res, Ban{UserID: userID, Record: data})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func parseUserID(w http.ResponseWriter, req *http.Request) (int64, bool) {
+	userID, err := strconv.ParseInt(req.PathValue("user_id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	return userID, true
+}
+
+func (s *Server) getBanHandler(w http.ResponseWriter, req *http.Request) {
+	userID, ok := parseUserID(w, req)
+	if !ok {
+		return
+	}
+	record, err := s.banDB.GetBan(userID)
+	if errors.Is(err, bannedDB.ErrNotBanned) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	data, err := protojson.Marshal(record)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Ban{UserID: userID, Record: data})
+}
+
+func (s *Server) banHandler(w http.ResponseWriter, req *http.Request) {
+	userID, ok := parseUserID(w, req)
+	if !ok {
+		return
+	}
+	var ban BanRequest
+	if req.ContentLength != 0 {
+		err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRequestSize)).Decode(&ban)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	cmd := "ban"
+	if ban.KeepMessages {
+		cmd = "bannodel"
+	}
+	tokens := []string{s.banDB.TGAdminPrefix(), cmd, strconv.FormatInt(userID, 10)}
+	if ban.Duration != "" {
+		tokens = append(tokens, ban.Duration)
+	}
+	s.execute(w, ban.ChatID, tokens)
+}
+
+func (s *Server) unbanHandler(w http.ResponseWriter, req *http.Request) {
+	userID, ok := parseUserID(w, req)
+	if !ok {
+		return
+	}
+	// Chat where user is unbanned, it is required unless bans are propagated to all chats
+	var chatID int64
+	if c := req.URL.Query().Get("chat_id"); c != "" {
+		var err error
+		chatID, err = strconv.ParseInt(c, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	s.execute(w, chatID, []string{s.banDB.TGAdminPrefix(), "unban", strconv.FormatInt(userID, 10)})
+}
@@ -0,0 +1,194 @@
+package adminAPI
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+)
+
+const (
+	testToken  = "secret"
+	testChatID = -100
+	testUserID = 1000
+)
+
+// banDBExecutor runs commands of bannedDB only, as they are run for `/admin bandb ...` messages
+type banDBExecutor struct {
+	banDB bannedDB.BanDB
+}
+
+func (e *banDBExecutor) ExecuteAdminCommand(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) (bool, error) {
+	if len(tokens) == 0 || tokens[0] != e.banDB.TGAdminPrefix() {
+		return false, nil
+	}
+	return true, e.banDB.HandleTGCommands(logger, bot, message, tokens[1:])
+}
+
+func newTestServer(t *testing.T, banDBConfig map[string]any) (*httptest.Server, bannedDB.BanDB, *fakeBot.Bot) {
+	t.Helper()
+	logger := zap.NewNop()
+	banDBConfig["state_dir"] = t.TempDir()
+	banDB, err := bannedDB.New(logger, banDBConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = banDB.Close() })
+	bot := fakeBot.New()
+	banDB.SetBot(bot, []int64{testChatID})
+
+	s := New(logger, config.AdminAPIConfig{Enabled: true, Token: testToken, AdminID: 1}, &banDBExecutor{banDB: banDB},
+		bot, banDB, nil)
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv, banDB, bot
+}
+
+// request sends authorized request and decodes response into res if it is not nil
+func request(t *testing.T, srv *httptest.Server, method, path, body string, res any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if res != nil {
+		err = json.NewDecoder(resp.Body).Decode(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv, _, _ := newTestServer(t, map[string]any{})
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "no token"},
+		{name: "wrong token", header: "Bearer wrong"},
+		{name: "token without scheme", header: testToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/bans", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("got status %v, want %v", resp.StatusCode, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestRouting(t *testing.T) {
+	srv, _, _ := newTestServer(t, map[string]any{})
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "unknown route", method: http.MethodGet, path: "/api/v1/unknown", want: http.StatusNotFound},
+		{name: "wrong method", method: http.MethodPost, path: "/api/v1/bans", want: http.StatusMethodNotAllowed},
+		{name: "invalid user id", method: http.MethodGet, path: "/api/v1/bans/abc", want: http.StatusBadRequest},
+		{name: "not banned", method: http.MethodGet, path: "/api/v1/bans/1", want: http.StatusNotFound},
+		{name: "unknown command", method: http.MethodPost, path: "/api/v1/commands", body: `{"command": "unknown"}`, want: http.StatusNotFound},
+		{name: "invalid chat id", method: http.MethodDelete, path: "/api/v1/bans/1?chat_id=abc", want: http.StatusBadRequest},
+		{
+			name:   "oversized body",
+			method: http.MethodPost,
+			path:   "/api/v1/commands",
+			body:   `{"command": "` + strings.Repeat("a", maxRequestSize) + `"}`,
+			want:   http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := request(t, srv, tt.method, tt.path, tt.body, nil); got != tt.want {
+				t.Errorf("got status %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBanRequiresChat(t *testing.T) {
+	srv, banDB, _ := newTestServer(t, map[string]any{})
+	var res CommandResponse
+	status := request(t, srv, http.MethodPut, "/api/v1/bans/1000", "", &res)
+	if status != http.StatusBadRequest || !strings.Contains(res.Error, bannedDB.ErrChatRequired.Error()) {
+		t.Errorf("got status %v and response %+v, want error %v", status, res, bannedDB.ErrChatRequired)
+	}
+	if banDB.IsBanned(testUserID) {
+		t.Errorf("user was banned without chat")
+	}
+}
+
+func TestBanAndUnban(t *testing.T) {
+	srv, banDB, bot := newTestServer(t, map[string]any{})
+
+	body, err := json.Marshal(BanRequest{ChatID: testChatID, Duration: "1d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res CommandResponse
+	status := request(t, srv, http.MethodPut, "/api/v1/bans/1000", string(body), &res)
+	if status != http.StatusOK || len(res.Replies) != 1 || !strings.Contains(res.Replies[0], "banned") {
+		t.Fatalf("got status %v and response %+v", status, res)
+	}
+	if bans := bot.CallsTo(fakeBot.MethodBanChatMember); len(bans) != 1 {
+		t.Errorf("got %v bans in telegram, want 1", len(bans))
+	}
+	if sent := bot.CallsTo(fakeBot.MethodSendMessage); len(sent) != 0 {
+		t.Errorf("replies were sent to telegram: %v", sent)
+	}
+
+	var ban Ban
+	status = request(t, srv, http.MethodGet, "/api/v1/bans/1000", "", &ban)
+	if status != http.StatusOK || ban.UserID != testUserID || !bytes.Contains(ban.Record, []byte("expiresAt")) {
+		t.Errorf("got status %v and ban %v %s", status, ban.UserID, ban.Record)
+	}
+	var bans []Ban
+	status = request(t, srv, http.MethodGet, "/api/v1/bans", "", &bans)
+	if status != http.StatusOK || len(bans) != 1 {
+		t.Errorf("got status %v and %v bans, want 1", status, len(bans))
+	}
+
+	status = request(t, srv, http.MethodDelete, "/api/v1/bans/1000?chat_id=-100", "", &res)
+	if status != http.StatusOK {
+		t.Fatalf("got status %v and response %+v", status, res)
+	}
+	if banDB.IsBanned(testUserID) {
+		t.Errorf("user is still banned")
+	}
+	if unbans := bot.CallsTo(fakeBot.MethodUnbanChatMember); len(unbans) != 1 {
+		t.Errorf("got %v unbans in telegram, want 1", len(unbans))
+	}
+}
@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/stateful"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+const (
+	defaultLimit = 20
+	maxLimit     = 100
+)
+
+// parseLimit parses optional number of events to show
+func parseLimit(tokens []string) (int, error) {
+	if len(tokens) == 0 {
+		return defaultLimit, nil
+	}
+	n, err := strconv.Atoi(tokens[0])
+	if err != nil || n <= 0 {
+		return 0, stateful.ErrInvalidCommand
+	}
+	return min(n, maxLimit), nil
+}
+
+// FormatEvent returns a single line description of the event
+func FormatEvent(e *auditEvent.AuditEvent) string {
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString(e.GetTime().AsTime().UTC().Format(time.DateTime))
+	buf.WriteString(" " + e.Action)
+	if e.UserId != 0 {
+		buf.WriteString(fmt.Sprintf(" user %v", e.UserId))
+	}
+	if e.ChatId != 0 {
+		buf.WriteString(fmt.Sprintf(" in %v", e.ChatId))
+	}
+	switch {
+	case e.ActorId != 0:
+		buf.WriteString(fmt.Sprintf(" by %v", e.ActorId))
+	case e.Chain != "" && e.Rule != "":
+		buf.WriteString(fmt.Sprintf(" by %v (%v)", e.Chain, e.Rule))
+	case e.Chain != "":
+		buf.WriteString(" by " + e.Chain)
+	}
+	if e.Reason != "" {
+		buf.WriteString(": " + e.Reason)
+	}
+	if e.Details != "" {
+		buf.WriteString(" [" + e.Details + "]")
+	}
+	return buf.String()
+}
+
+func (l *Log) reply(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, title string, q Query, n int) error {
+	events, err := l.Last(q, n)
+	if err != nil {
+		logger.Error("failed to query audit log", zap.Any("query", q), zap.Error(err))
+		return err
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if len(events) == 0 {
+		buf.WriteString(title + ": no events\n")
+	} else {
+		buf.WriteString(fmt.Sprintf("%v, %v most recent first:\n", title, len(events)))
+	}
+	for _, e := range events {
+		buf.WriteString(FormatEvent(e) + "\n")
+	}
+	err = tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
+
+func (l *Log) lastCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	n, err := parseLimit(tokens)
+	if err != nil {
+		logger.Warn("invalid number of events", zap.Strings("tokens", tokens))
+		return err
+	}
+	return l.reply(logger, bot, message, "Audit log", Query{}, n)
+}
+
+func (l *Log) userCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	if len(tokens) < 1 {
+		logger.Warn("invalid command", zap.Strings("tokens", tokens))
+		return stateful.ErrInvalidCommand
+	}
+	userID, err := strconv.ParseInt(tokens[0], 10, 64)
+	if err != nil {
+		logger.Warn("invalid user id", zap.Strings("tokens", tokens), zap.Error(err))
+		return stateful.ErrUserIDInvalid
+	}
+	n, err := parseLimit(tokens[1:])
+	if err != nil {
+		logger.Warn("invalid number of events", zap.Strings("tokens", tokens))
+		return err
+	}
+	return l.reply(logger, bot, message, fmt.Sprintf("Audit log for user %v", userID), Query{UserID: userID}, n)
+}
+
+func (l *Log) chainCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	if len(tokens) < 1 {
+		logger.Warn("invalid command", zap.Strings("tokens", tokens))
+		return stateful.ErrInvalidCommand
+	}
+	n, err := parseLimit(tokens[1:])
+	if err != nil {
+		logger.Warn("invalid number of events", zap.Strings("tokens", tokens))
+		return err
+	}
+	return l.reply(logger, bot, message, fmt.Sprintf("Audit log for chain %v", tokens[0]), Query{Chain: tokens[0]}, n)
+}
+
+func (l *Log) helpCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("Available commands:\n")
+	buf.WriteString(fmt.Sprintf(" - `last [N]` - show N most recent moderation events, %v by default, up to %v\n", defaultLimit, maxLimit))
+	buf.WriteString(" - `user <id> [N]` - show most recent events that affected the user\n")
+	buf.WriteString(" - `chain <name> [N]` - show most recent events caused by the chain\n")
+	buf.WriteString(" - `help` - this help\n")
+
+	err := tg.SendMarkdownMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
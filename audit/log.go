@@ -0,0 +1,266 @@
+package audit
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/metrics"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+var (
+	ErrStateDirEmpty = errors.New("audit.state_dir cannot be empty")
+	ErrStopIteration = errors.New("stop iteration")
+)
+
+// Actions that are recorded
+const (
+	ActionBan      = "ban"
+	ActionUnban    = "unban"
+	ActionDelete   = "delete"
+	ActionKick     = "kick"
+	ActionVerify   = "verify"
+	ActionReport   = "report"
+	ActionRegexAdd = "regex_add"
+	ActionRegexDel = "regex_del"
+	// ActionBanDuration is recorded when ban is limited in time, after the ban itself
+	ActionBanDuration = "ban_duration"
+)
+
+const (
+	prefixEvent byte = 'e'
+	prefixUser  byte = 'u'
+	prefixChain byte = 'c'
+)
+
+// Log is an append-only store of moderation events.
+//
+// Every event is stored under a primary key ordered by time and indexed by affected user and by chain. Events are
+// never changed or removed.
+type Log struct {
+	logger *zap.Logger
+	db     *badger.DB
+	seq    atomic.Uint64
+
+	tg.TGHaveAdminCommands
+}
+
+// Query selects events, zero values mean "any"
+type Query struct {
+	UserID int64
+	Chain  string
+	Since  time.Time
+	Until  time.Time
+}
+
+func open(logger *zap.Logger, cfg config.AuditConfig, readOnly bool) (*Log, error) {
+	if cfg.StateDir == "" {
+		return nil, ErrStateDirEmpty
+	}
+	opts := badgerOpts.GetBadgerOptions(logger, "audit", cfg.StateDir)
+	opts.ReadOnly = readOnly
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	metrics.TrackBadger("audit", db)
+
+	l := &Log{
+		logger: logger.With(zap.String("component", "audit")),
+		db:     db,
+	}
+	l.TGHaveAdminCommands.Handlers = map[string]tg.AdminCMDHandlerFunc{
+		"last":  l.lastCmd,
+		"user":  l.userCmd,
+		"chain": l.chainCmd,
+		"help":  l.helpCmd,
+	}
+	return l, nil
+}
+
+func New(logger *zap.Logger, cfg config.AuditConfig) (*Log, error) {
+	return open(logger, cfg, false)
+}
+
+// OpenReadOnly opens the log for export, it fails if the log is used by the running bot
+func OpenReadOnly(logger *zap.Logger, cfg config.AuditConfig) (*Log, error) {
+	return open(logger, cfg, true)
+}
+
+// Record appends event to the log, errors are only logged. Nil log records nothing, so it can be passed to components
+// when audit is disabled. Time is set to now if it is empty.
+func (l *Log) Record(e *auditEvent.AuditEvent) {
+	if l == nil {
+		return
+	}
+	err := l.Append(e)
+	if err != nil {
+		l.logger.Error("failed to record audit event", zap.Any("event", e), zap.Error(err))
+	}
+}
+
+// sortableInt converts signed int to unsigned one that keeps the order when encoded as big endian
+func sortableInt(i int64) uint64 {
+	return uint64(i) ^ (1 << 63)
+}
+
+func appendInt(buf []byte, i int64) []byte {
+	return binary.BigEndian.AppendUint64(buf, sortableInt(i))
+}
+
+// eventID orders events by time, sequence number distinguishes events that happened at the same time
+func (l *Log) eventID(t time.Time) []byte {
+	id := appendInt(make([]byte, 0, 16), t.UnixNano())
+	return binary.BigEndian.AppendUint64(id, l.seq.Add(1))
+}
+
+func userPrefix(userID int64) []byte {
+	return appendInt([]byte{prefixUser}, userID)
+}
+
+func chainPrefix(chain string) []byte {
+	return append(append([]byte{prefixChain}, chain...), 0)
+}
+
+// Append stores the event
+func (l *Log) Append(e *auditEvent.AuditEvent) error {
+	if e.Time == nil {
+		e.Time = timestamppb.Now()
+	}
+	b, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	id := l.eventID(e.Time.AsTime())
+	return l.db.Update(func(txn *badger.Txn) error {
+		err := txn.Set(append([]byte{prefixEvent}, id...), b)
+		if err != nil {
+			return err
+		}
+		if e.UserId != 0 {
+			err = txn.Set(append(userPrefix(e.UserId), id...), nil)
+			if err != nil {
+				return err
+			}
+		}
+		if e.Chain != "" {
+			err = txn.Set(append(chainPrefix(e.Chain), id...), nil)
+		}
+		return err
+	})
+}
+
+// scanPrefix returns prefix of the index that should be used for the query
+func (q *Query) scanPrefix() []byte {
+	switch {
+	case q.UserID != 0:
+		return userPrefix(q.UserID)
+	case q.Chain != "":
+		return chainPrefix(q.Chain)
+	default:
+		return []byte{prefixEvent}
+	}
+}
+
+func (q *Query) match(e *auditEvent.AuditEvent) bool {
+	t := e.GetTime().AsTime()
+	if !q.Since.IsZero() && t.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && t.After(q.Until) {
+		return false
+	}
+	if q.UserID != 0 && e.UserId != q.UserID {
+		return false
+	}
+	return q.Chain == "" || e.Chain == q.Chain
+}
+
+// iterate calls fn for events that match the query, in chronological or in reverse order
+func (l *Log) iterate(q Query, reverse bool, fn func(*auditEvent.AuditEvent) error) error {
+	prefix := q.scanPrefix()
+	err := l.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.PrefetchValues = prefix[0] == prefixEvent
+		opts.Reverse = reverse
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		start := prefix
+		if reverse {
+			start = append(append([]byte{}, prefix...), 0xFF)
+		}
+		for it.Seek(start); it.Valid(); it.Next() {
+			key := append([]byte{prefixEvent}, it.Item().Key()[len(prefix):]...)
+			item, err := txn.Get(key)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			var e auditEvent.AuditEvent
+			err = item.Value(func(val []byte) error {
+				return proto.Unmarshal(val, &e)
+			})
+			if err != nil {
+				return err
+			}
+			if !q.match(&e) {
+				continue
+			}
+			err = fn(&e)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// ForEach calls fn for every event that matches the query in chronological order. Returning ErrStopIteration from
+// fn stops iteration without an error.
+func (l *Log) ForEach(q Query, fn func(*auditEvent.AuditEvent) error) error {
+	return l.iterate(q, false, fn)
+}
+
+// Last returns up to n most recent events that match the query, newest first
+func (l *Log) Last(q Query, n int) ([]*auditEvent.AuditEvent, error) {
+	res := make([]*auditEvent.AuditEvent, 0, n)
+	if n <= 0 {
+		return res, nil
+	}
+	err := l.iterate(q, true, func(e *auditEvent.AuditEvent) error {
+		res = append(res, e)
+		if len(res) >= n {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (l *Log) TGAdminPrefix() string {
+	return "audit"
+}
+
+func (l *Log) Close() error {
+	metrics.UntrackBadger(l.db)
+	return l.db.Close()
+}
@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestLog(t *testing.T) *Log {
+	t.Helper()
+	l, err := New(zap.NewNop(), config.AuditConfig{StateDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	return l
+}
+
+// testEvents are appended out of order, reasons are used to identify them
+var testEvents = []*auditEvent.AuditEvent{
+	{Action: ActionBan, UserId: 1, Chain: "spam", Reason: "1", Time: timestamppb.New(testStart.Add(1 * time.Minute))},
+	{Action: ActionBan, UserId: -2, Chain: "flood", Reason: "3", Time: timestamppb.New(testStart.Add(3 * time.Minute))},
+	{Action: ActionUnban, UserId: 1, Reason: "2", Time: timestamppb.New(testStart.Add(2 * time.Minute))},
+	{Action: ActionRegexAdd, Chain: "spam", Reason: "4", Time: timestamppb.New(testStart.Add(4 * time.Minute))},
+	{Action: ActionDelete, UserId: -2, Chain: "spam", Reason: "5", Time: timestamppb.New(testStart.Add(4 * time.Minute))},
+}
+
+func appendTestEvents(t *testing.T, l *Log) {
+	t.Helper()
+	for _, e := range testEvents {
+		err := l.Append(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func reasons(events []*auditEvent.AuditEvent) []string {
+	res := make([]string, 0, len(events))
+	for _, e := range events {
+		res = append(res, e.Reason)
+	}
+	return res
+}
+
+func TestForEach(t *testing.T) {
+	l := newTestLog(t)
+	appendTestEvents(t, l)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{name: "all events by time", want: []string{"1", "2", "3", "4", "5"}},
+		{name: "by user", query: Query{UserID: 1}, want: []string{"1", "2"}},
+		{name: "by negative user", query: Query{UserID: -2}, want: []string{"3", "5"}},
+		{name: "by chain", query: Query{Chain: "spam"}, want: []string{"1", "4", "5"}},
+		{name: "by user and chain", query: Query{UserID: -2, Chain: "spam"}, want: []string{"5"}},
+		{name: "unknown chain", query: Query{Chain: "spa"}, want: []string{}},
+		{
+			name:  "time range",
+			query: Query{Since: testStart.Add(2 * time.Minute), Until: testStart.Add(3 * time.Minute)},
+			want:  []string{"2", "3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []*auditEvent.AuditEvent
+			err := l.ForEach(tt.query, func(e *auditEvent.AuditEvent) error {
+				got = append(got, e)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(reasons(got), tt.want) {
+				t.Errorf("got events %v, want %v", reasons(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestForEachStops(t *testing.T) {
+	l := newTestLog(t)
+	appendTestEvents(t, l)
+
+	var got []*auditEvent.AuditEvent
+	err := l.ForEach(Query{}, func(e *auditEvent.AuditEvent) error {
+		got = append(got, e)
+		if len(got) == 2 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stopped iteration returned error: %v", err)
+	}
+	if !slices.Equal(reasons(got), []string{"1", "2"}) {
+		t.Errorf("got events %v, want [1 2]", reasons(got))
+	}
+
+	errFailed := errors.New("failed")
+	err = l.ForEach(Query{}, func(*auditEvent.AuditEvent) error {
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("got error %v, want %v", err, errFailed)
+	}
+}
+
+func TestLast(t *testing.T) {
+	l := newTestLog(t)
+	appendTestEvents(t, l)
+
+	tests := []struct {
+		name  string
+		query Query
+		n     int
+		want  []string
+	}{
+		{name: "newest first", n: 3, want: []string{"5", "4", "3"}},
+		{name: "more than recorded", n: 10, want: []string{"5", "4", "3", "2", "1"}},
+		{name: "nothing requested", n: 0, want: []string{}},
+		{name: "by user", query: Query{UserID: 1}, n: 10, want: []string{"2", "1"}},
+		{name: "by negative user", query: Query{UserID: -2}, n: 1, want: []string{"5"}},
+		{name: "by chain", query: Query{Chain: "spam"}, n: 2, want: []string{"5", "4"}},
+		{name: "until", query: Query{Until: testStart.Add(2 * time.Minute)}, n: 10, want: []string{"2", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.Last(tt.query, tt.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(reasons(got), tt.want) {
+				t.Errorf("got events %v, want %v", reasons(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendSetsTime(t *testing.T) {
+	l := newTestLog(t)
+	before := time.Now()
+	e := &auditEvent.AuditEvent{Action: ActionBan, UserId: 1}
+	err := l.Append(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Time == nil || e.Time.AsTime().Before(before) {
+		t.Errorf("time was not set: %v", e.Time)
+	}
+
+	var nilLog *Log
+	nilLog.Record(&auditEvent.AuditEvent{Action: ActionBan})
+}
+
+func TestSortableInt(t *testing.T) {
+	values := []int64{-1 << 63, -1000, -1, 0, 1, 1000, 1<<63 - 1}
+	for i := 1; i < len(values); i++ {
+		if sortableInt(values[i-1]) >= sortableInt(values[i]) {
+			t.Errorf("order of %v and %v is not kept", values[i-1], values[i])
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package bannedDB
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Civil/tg-simple-regex-antispam/audit"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	badgerHelper "github.com/Civil/tg-simple-regex-antispam/helper/badger"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+)
+
+var (
+	ErrBlocklistsNotAList   = errors.New("blocklists must be a list")
+	ErrBlocklistNotAMap     = errors.New("blocklist must have `source` and `path` parameters")
+	ErrBlocklistSourceEmpty = errors.New("blocklist source cannot be empty")
+	ErrBlocklistDuplicate   = errors.New("blocklist sources must be unique")
+	ErrBlocklistEmpty       = errors.New("blocklist is empty, refusing to remove all its bans (list must contain e.g. `[]` or a comment to be considered empty)")
+)
+
+// blocklist is an external list of spammer IDs that is periodically imported. Entries are tagged with the source,
+// so they can be removed once the list drops them.
+type blocklist struct {
+	source   string
+	path     string
+	interval time.Duration
+}
+
+func parseBlocklists(config map[string]any) ([]blocklist, error) {
+	listsI, ok := config["blocklists"]
+	if !ok {
+		return nil, nil
+	}
+	lists, ok := listsI.([]any)
+	if !ok {
+		return nil, ErrBlocklistsNotAList
+	}
+
+	res := make([]blocklist, 0, len(lists))
+	seen := make(map[string]struct{})
+	for _, l := range lists {
+		cfg, ok := l.(map[string]any)
+		if !ok {
+			return nil, ErrBlocklistNotAMap
+		}
+		source, err := config2.GetOptionString(cfg, "source")
+		if err != nil {
+			return nil, err
+		}
+		if source == "" {
+			return nil, ErrBlocklistSourceEmpty
+		}
+		if _, ok := seen[source]; ok {
+			return nil, fmt.Errorf("%w: %v", ErrBlocklistDuplicate, source)
+		}
+		seen[source] = struct{}{}
+		path, err := config2.GetOptionString(cfg, "path")
+		if err != nil {
+			return nil, err
+		}
+		interval, err := config2.GetOptionDurationWithDefault(cfg, "interval", time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 {
+			return nil, ErrDurationNotPositive
+		}
+		res = append(res, blocklist{source: source, path: path, interval: interval})
+	}
+	return res, nil
+}
+
+// readBlocklist reads user IDs from the file or from every file in the directory. size is a total size of the
+// files, it is 0 if they were truncated, e.g. while being written.
+func readBlocklist(path string) (ids map[int64]struct{}, size int64, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+
+	ids = make(map[int64]struct{})
+	for _, file := range files {
+		n, err := readBlocklistFile(file, ids)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%v: %w", file, err)
+		}
+		size += n
+	}
+	return ids, size, nil
+}
+
+// readBlocklistFile adds IDs from the file to ids and returns size of the file
+func readBlocklistFile(file string, ids map[int64]struct{}) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), parseBlocklistFile(file, f, ids)
+}
+
+// parseBlocklistFile adds IDs from the file to ids. Format is chosen by extension: `.json` is an array of IDs or of
+// objects with `user_id` or `id` field, `.csv` has IDs in the first column (rows that don't start with an ID,
+// e.g. a header, are skipped), anything else is plain text with one ID per line and `#` comments.
+func parseBlocklistFile(file string, f io.Reader, ids map[int64]struct{}) error {
+	var err error
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		var entries []json.RawMessage
+		err = json.NewDecoder(f).Decode(&entries)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			var id int64
+			if json.Unmarshal(e, &id) != nil {
+				var obj struct {
+					UserID int64 `json:"user_id"`
+					ID     int64 `json:"id"`
+				}
+				err = json.Unmarshal(e, &obj)
+				if err != nil {
+					return err
+				}
+				id = max(obj.UserID, obj.ID)
+			}
+			if id != 0 {
+				ids[id] = struct{}{}
+			}
+		}
+	case ".csv":
+		r := csv.NewReader(f)
+		r.FieldsPerRecord = -1
+		for {
+			row, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if len(row) == 0 {
+				continue
+			}
+			if id, err := strconv.ParseInt(strings.TrimSpace(row[0]), 10, 64); err == nil {
+				ids[id] = struct{}{}
+			}
+		}
+	default:
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(line, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid user id %q", line)
+			}
+			ids[id] = struct{}{}
+		}
+		return scanner.Err()
+	}
+	return nil
+}
+
+// updateEach calls fn for every user in its own part of a transaction, committing it when it grows too big
+func (r *BannedDB) updateEach(userIDs []int64, fn func(txn *badger.Txn, userID int64) error) error {
+	txn := r.db.NewTransaction(true)
+	defer func() { txn.Discard() }()
+	for _, userID := range userIDs {
+		err := fn(txn, userID)
+		if errors.Is(err, badger.ErrTxnTooBig) {
+			err = txn.Commit()
+			if err != nil {
+				return err
+			}
+			txn = r.db.NewTransaction(true)
+			err = fn(txn, userID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// syncBlocklist bans users from the list that are not banned yet and removes bans of the source that are not in
+// the list anymore. Bans from other sources (chains, admins, other lists) are never changed, users that were
+// unbanned explicitly are not banned again. Sync is refused if list is truncated and all bans would be removed.
+func (r *BannedDB) syncBlocklist(b blocklist) (added, removed int, err error) {
+	ids, size, err := readBlocklist(b.path)
+	if err != nil {
+		return 0, 0, err
+	}
+	listed := len(ids)
+
+	bans, err := r.listBans()
+	if err != nil {
+		return 0, 0, err
+	}
+	toRemove := make([]int64, 0)
+	for _, ban := range bans {
+		if _, ok := ids[ban.userID]; ok {
+			delete(ids, ban.userID)
+			continue
+		}
+		if ban.record.Source == b.source {
+			toRemove = append(toRemove, ban.userID)
+		}
+	}
+	if listed == 0 && size == 0 && len(toRemove) > 0 {
+		return 0, 0, ErrBlocklistEmpty
+	}
+	toAdd := make([]int64, 0, len(ids))
+	for id := range ids {
+		toAdd = append(toAdd, id)
+	}
+
+	// Records are checked again in the transaction, as they could be changed since they were listed
+	removedIDs := make([]int64, 0, len(toRemove))
+	err = r.updateEach(toRemove, func(txn *badger.Txn, userID int64) error {
+		record, err := getRecord(txn, userID)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil || record.Source != b.source {
+			return err
+		}
+		err = txn.Delete(badgerHelper.UserIDToKey(userID))
+		if err == nil {
+			removedIDs = append(removedIDs, userID)
+		}
+		return err
+	})
+	r.recordSourceChanges(audit.ActionUnban, "removed from blocklist "+b.source, removedIDs)
+	if err != nil {
+		return 0, len(removedIDs), err
+	}
+
+	val, err := proto.Marshal(&banRecord.BanRecord{
+		BannedAt: timestamppb.Now(),
+		Reason:   "listed in blocklist " + b.source,
+		Source:   b.source,
+	})
+	if err != nil {
+		return 0, len(removedIDs), err
+	}
+	addedIDs := make([]int64, 0, len(toAdd))
+	err = r.updateEach(toAdd, func(txn *badger.Txn, userID int64) error {
+		_, err := getRecord(txn, userID)
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		unbanned, err := hasTombstone(txn, userID)
+		if err != nil || unbanned {
+			return err
+		}
+		err = txn.Set(badgerHelper.UserIDToKey(userID), val)
+		if err == nil {
+			addedIDs = append(addedIDs, userID)
+		}
+		return err
+	})
+	r.recordSourceChanges(audit.ActionBan, "listed in blocklist "+b.source, addedIDs)
+	return len(addedIDs), len(removedIDs), err
+}
+
+func (r *BannedDB) blocklistLoop(b blocklist) {
+	defer r.wg.Done()
+	logger := r.logger.With(zap.String("blocklist", b.source), zap.String("path", b.path))
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		added, removed, err := r.syncBlocklist(b)
+		if err != nil {
+			logger.Error("failed to import blocklist", zap.Error(err))
+		} else {
+			logger.Info("blocklist imported", zap.Int("added", added), zap.Int("removed", removed))
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package bannedDB
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/audit"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func bannedIDs(t *testing.T, db *BannedDB) []int64 {
+	t.Helper()
+	ids, err := db.ListUserIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestSyncBlocklist(t *testing.T) {
+	db := newTestDB(t, nil)
+	path := filepath.Join(t.TempDir(), "list.txt")
+	b := blocklist{source: "shared", path: path}
+	err := db.BanUser(3, &banRecord.BanRecord{AdminId: testAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, path, "1\n2 # spammer\n3\n")
+	added, removed, err := db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 2 || removed != 0 {
+		t.Errorf("got added=%v removed=%v, want 2 and 0", added, removed)
+	}
+
+	writeFile(t, path, "2\n")
+	added, removed, err = db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 0 || removed != 1 {
+		t.Errorf("got added=%v removed=%v, want 0 and 1", added, removed)
+	}
+	if ids := bannedIDs(t, db); !slices.Equal(ids, []int64{2, 3}) {
+		t.Errorf("got bans %v, want [2 3]: ban of the admin must be kept", ids)
+	}
+}
+
+func TestSyncBlocklistRespectsUnban(t *testing.T) {
+	db := newTestDB(t, nil)
+	path := filepath.Join(t.TempDir(), "list.json")
+	b := blocklist{source: "shared", path: path}
+
+	writeFile(t, path, `[1, {"user_id": 2}]`)
+	_, _, err := db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UnbanUser(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, _, err := db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 0 || db.IsBanned(1) {
+		t.Errorf("unbanned user was banned again")
+	}
+	if ids := bannedIDs(t, db); !slices.Equal(ids, []int64{2}) {
+		t.Errorf("got bans %v, want [2]", ids)
+	}
+}
+
+func TestSyncBlocklistAfterRemoveBan(t *testing.T) {
+	db := newTestDB(t, nil)
+	filter := &recordingFilter{}
+	db.SetStatefulFilters([]interfaces.StatefulFilter{filter})
+	path := filepath.Join(t.TempDir(), "list.txt")
+	b := blocklist{source: "shared", path: path}
+
+	writeFile(t, path, "1\n")
+	err := db.BanUser(1, &banRecord.BanRecord{AdminId: testAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.RemoveBan(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(filter.removed, []int64{1}) || len(filter.unbanned) != 0 {
+		t.Errorf("user was verified: removed %v, verified %v", filter.removed, filter.unbanned)
+	}
+
+	added, _, err := db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added != 1 || !db.IsBanned(1) {
+		t.Errorf("user whose ban was removed is not banned by blocklist")
+	}
+}
+
+func TestSyncBlocklistRefusesTruncatedList(t *testing.T) {
+	db := newTestDB(t, nil)
+	path := filepath.Join(t.TempDir(), "list.txt")
+	b := blocklist{source: "shared", path: path}
+
+	writeFile(t, path, "1\n2\n")
+	_, _, err := db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, path, "")
+	_, removed, err := db.syncBlocklist(b)
+	if !errors.Is(err, ErrBlocklistEmpty) {
+		t.Errorf("got %v, want %v", err, ErrBlocklistEmpty)
+	}
+	if removed != 0 || len(bannedIDs(t, db)) != 2 {
+		t.Errorf("bans were removed from truncated list")
+	}
+
+	writeFile(t, path, "# no spammers left\n")
+	_, removed, err = db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || len(bannedIDs(t, db)) != 0 {
+		t.Errorf("bans were not removed from explicitly empty list, removed %v", removed)
+	}
+}
+
+func TestSyncBlocklistIsAudited(t *testing.T) {
+	db := newTestDB(t, nil)
+	log, err := audit.New(zap.NewNop(), config.AuditConfig{StateDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = log.Close() })
+	db.SetAuditLog(log)
+	path := filepath.Join(t.TempDir(), "list.txt")
+	b := blocklist{source: "shared", path: path}
+
+	writeFile(t, path, "1\n2\n")
+	_, _, err = db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "2\n")
+	_, _, err = db.syncBlocklist(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := log.Last(audit.Query{UserID: 1}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make([]string, 0, len(events))
+	for _, e := range events {
+		actions = append(actions, e.Action)
+	}
+	if want := []string{audit.ActionUnban, audit.ActionBan}; !slices.Equal(actions, want) {
+		t.Errorf("got events %v, want %v", actions, want)
+	}
+}
+
+func TestBlocklistIsImportedOnlyAfterStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	writeFile(t, path, "1\n")
+	db := newTestDB(t, map[string]any{
+		"blocklists": []any{map[string]any{"source": "shared", "path": path}},
+	})
+	if ids := bannedIDs(t, db); len(ids) != 0 {
+		t.Fatalf("blocklist was imported before start: %v", ids)
+	}
+
+	// The first import is audited, as the log is set before start
+	log, err := audit.New(zap.NewNop(), config.AuditConfig{StateDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = log.Close() })
+	db.SetAuditLog(log)
+	t.Cleanup(func() { db.SetAuditLog(nil) })
+
+	db.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// Ban is audited after it is stored
+		events, err := log.Last(audit.Query{UserID: 1}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) > 0 {
+			if len(events) != 1 || events[0].Action != audit.ActionBan || !db.IsBanned(1) {
+				t.Errorf("unexpected import: %v", events)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("blocklist was not imported and audited after start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -4,16 +4,29 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net/http"
+	"slices"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/mymmrac/telego"
 
 	"github.com/dgraph-io/badger/v4"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"github.com/Civil/tg-simple-regex-antispam/audit"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
 	badgerHelper "github.com/Civil/tg-simple-regex-antispam/helper/badger"
 	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+	"github.com/Civil/tg-simple-regex-antispam/helper/metrics"
 	"github.com/Civil/tg-simple-regex-antispam/helper/stateful"
 	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
 )
@@ -23,7 +36,28 @@ type BannedDB struct {
 	stateDir string
 	db       *badger.DB
 
+	// Bans and unbans are applied to every allowed chat, not only to the one where they were issued
+	propagate bool
+
+	// Protects filters, bot, chats, audit log and events, as they are used by the sweeper
+	mu              sync.RWMutex
 	statefulFilters []interfaces.StatefulFilter
+	bot             botAPI.BotAPI
+	allowedChats    []int64
+	auditLog        *audit.Log
+	events          *events.Hub
+
+	// Expired bans are lifted and blocklists are imported in background once DB is started, see Start
+	sweepInterval time.Duration
+	blocklists    []blocklist
+
+	// HTTP feed that shares bans with other instances and peers whose feeds are merged
+	feed   *feedConfig
+	peers  []peer
+	server *http.Server
+
+	stop chan struct{}
+	wg   sync.WaitGroup
 
 	tg.TGHaveAdminCommands
 }
@@ -36,6 +70,29 @@ var ErrStateDirNotString = errors.New(
 	"state_dir is not a string",
 )
 
+var ErrDurationNotPositive = errors.New(
+	"ban duration must be positive",
+)
+
+var ErrSweepIntervalNotPositive = errors.New(
+	"sweep_interval must be positive",
+)
+
+var ErrNotBanned = errors.New(
+	"user is not banned",
+)
+
+var ErrChatRequired = errors.New(
+	"chat is required, as bans are not propagated to all chats",
+)
+
+var ErrNoChats = errors.New(
+	"no chats are configured to propagate bans to",
+)
+
+// legacyBanValue is stored by older versions, such bans are permanent
+var legacyBanValue = []byte("1")
+
 func New(logger *zap.Logger, config map[string]any) (BanDB, error) {
 	stateDirI, ok := config["state_dir"]
 	if !ok {
@@ -46,15 +103,59 @@ func New(logger *zap.Logger, config map[string]any) (BanDB, error) {
 		return nil, ErrStateDirNotString
 	}
 
+	sweepInterval, err := config2.GetOptionDurationWithDefault(config, "sweep_interval", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if sweepInterval <= 0 {
+		return nil, ErrSweepIntervalNotPositive
+	}
+
+	propagate, err := config2.GetOptionBoolWithDefault(config, "propagate_to_all_chats", false)
+	if err != nil {
+		return nil, err
+	}
+
+	blocklists, err := parseBlocklists(config)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := parseFeed(config)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := parsePeers(config)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]struct{}, len(blocklists))
+	for _, b := range blocklists {
+		sources[b.source] = struct{}{}
+	}
+	for _, p := range peers {
+		if _, ok := sources[p.source]; ok {
+			return nil, fmt.Errorf("%w: %v", ErrSourceAlreadyExists, p.source)
+		}
+		sources[p.source] = struct{}{}
+	}
+
 	badgerDB, err := badger.Open(badgerOpts.GetBadgerOptions(logger, "bannedDB", stateDir))
 	if err != nil {
 		return nil, err
 	}
+	metrics.TrackBadger("bannedDB", badgerDB)
 
 	db := &BannedDB{
 		logger:              logger.With(zap.String("banDB", "bannedDB")),
 		stateDir:            stateDir,
 		db:                  badgerDB,
+		propagate:           propagate,
+		sweepInterval:       sweepInterval,
+		blocklists:          blocklists,
+		feed:                feed,
+		peers:               peers,
+		stop:                make(chan struct{}),
 		TGHaveAdminCommands: tg.TGHaveAdminCommands{},
 	}
 	db.TGHaveAdminCommands.Handlers = map[string]tg.AdminCMDHandlerFunc{
@@ -62,33 +163,275 @@ func New(logger *zap.Logger, config map[string]any) (BanDB, error) {
 		"unban":    db.unbanCmd,
 		"bannodel": db.bannodelCmd,
 		"ban":      db.banCmd,
+		"info":     db.infoCmd,
 		"help":     db.helpCmd,
 	}
+
 	return db, nil
 }
 
-func (r *BannedDB) BanUser(userID int64) error {
+// Start starts lifting expired bans and importing blocklists. It should be called once bot and audit log are set,
+// offline commands don't call it so that they don't change the DB on their own.
+func (r *BannedDB) Start() {
+	r.wg.Add(1 + len(r.blocklists))
+	go r.sweepLoop(r.sweepInterval)
+	for _, b := range r.blocklists {
+		go r.blocklistLoop(b)
+	}
+}
+
+func decodeRecord(val []byte) (*banRecord.BanRecord, error) {
+	record := &banRecord.BanRecord{}
+	if bytes.Equal(val, legacyBanValue) {
+		return record, nil
+	}
+	err := proto.Unmarshal(val, record)
+	return record, err
+}
+
+// tombstoneKey is a key of the mark that user was unbanned explicitly, blocklists and peers don't ban such users.
+// Ban keys are single user IDs, so keys with this prefix are never confused with them.
+func tombstoneKey(userID int64) []byte {
+	return append([]byte{0, 't'}, badgerHelper.UserIDToKey(userID)...)
+}
+
+// hasTombstone reports whether user was explicitly unbanned
+func hasTombstone(txn *badger.Txn, userID int64) (bool, error) {
+	_, err := txn.Get(tombstoneKey(userID))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func getRecord(txn *badger.Txn, userID int64) (*banRecord.BanRecord, error) {
+	item, err := txn.Get(badgerHelper.UserIDToKey(userID))
+	if err != nil {
+		return nil, err
+	}
+	var record *banRecord.BanRecord
+	err = item.Value(func(val []byte) error {
+		record, err = decodeRecord(val)
+		return err
+	})
+	return record, err
+}
+
+// updateRecord applies update to the existing record of the user or to a new one
+func (r *BannedDB) updateRecord(userID int64, update func(record *banRecord.BanRecord)) error {
 	return r.db.Update(
 		func(txn *badger.Txn) error {
-			return txn.Set(badgerHelper.UserIDToKey(userID), []byte("1"))
+			record, err := getRecord(txn, userID)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				record = &banRecord.BanRecord{BannedAt: timestamppb.Now()}
+			} else if err != nil {
+				return err
+			}
+			update(record)
+			val, err := proto.Marshal(record)
+			if err != nil {
+				return err
+			}
+			return txn.Set(badgerHelper.UserIDToKey(userID), val)
+		})
+}
+
+// BanUser bans user permanently. Details of the ban are taken from info and replace previous ones.
+func (r *BannedDB) BanUser(userID int64, info *banRecord.BanRecord) error {
+	err := r.updateRecord(userID, func(record *banRecord.BanRecord) {
+		record.BannedAt = timestamppb.Now()
+		record.ExpiresAt = nil
+		record.ChatId = info.GetChatId()
+		record.ChainName = info.GetChainName()
+		record.RuleName = info.GetRuleName()
+		record.Reason = info.GetReason()
+		record.MessageExcerpt = info.GetMessageExcerpt()
+		record.AdminId = info.GetAdminId()
+		record.Source = info.GetSource()
+	})
+	if err != nil {
+		return err
+	}
+	metrics.Bans.Inc()
+	r.record(&auditEvent.AuditEvent{
+		Action:  audit.ActionBan,
+		ActorId: info.GetAdminId(),
+		UserId:  userID,
+		ChatId:  info.GetChatId(),
+		Chain:   info.GetChainName(),
+		Rule:    info.GetRuleName(),
+		Reason:  info.GetReason(),
+	})
+	r.publishBan(userID, info)
+	return nil
+}
+
+// SetBan stores the record as is, replacing existing one. It is used to import bans, they are not audited.
+func (r *BannedDB) SetBan(userID int64, record *banRecord.BanRecord) error {
+	val, err := proto.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(
+		func(txn *badger.Txn) error {
+			return txn.Set(badgerHelper.UserIDToKey(userID), val)
+		})
+}
+
+// GetBan returns record of the ban, ErrNotBanned if user is not banned
+func (r *BannedDB) GetBan(userID int64) (*banRecord.BanRecord, error) {
+	var record *banRecord.BanRecord
+	err := r.db.View(
+		func(tx *badger.Txn) error {
+			var err error
+			record, err = getRecord(tx, userID)
+			return err
 		})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrNotBanned
+	}
+	return record, err
+}
+
+// BanUserFor bans user for the duration. chatIDs are chats where user was actually banned in telegram, ban is lifted
+// there once it expires.
+func (r *BannedDB) BanUserFor(userID int64, chatIDs []int64, duration time.Duration) error {
+	if duration <= 0 {
+		return ErrDurationNotPositive
+	}
+	err := r.updateRecord(userID, func(record *banRecord.BanRecord) {
+		record.ExpiresAt = timestamppb.New(time.Now().Add(duration))
+		for _, id := range chatIDs {
+			if !slices.Contains(record.ChatIds, id) {
+				record.ChatIds = append(record.ChatIds, id)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	r.record(&auditEvent.AuditEvent{
+		Action:  audit.ActionBanDuration,
+		UserId:  userID,
+		Details: fmt.Sprintf("%v in chats %v", duration, chatIDs),
+	})
+	return nil
 }
 
 func (r *BannedDB) SetStatefulFilters(filters []interfaces.StatefulFilter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.statefulFilters = filters
 }
 
+func (r *BannedDB) IsVerified(userID int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, f := range r.statefulFilters {
+		v, ok := f.(interfaces.Verifier)
+		if !ok {
+			continue
+		}
+		verified, err := v.IsVerified(userID)
+		if err != nil {
+			r.logger.Error("failed to check if user is verified", zap.String("filter", f.GetFilterName()),
+				zap.Int64("userID", userID), zap.Error(err))
+			continue
+		}
+		if verified {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAuditLog sets log where bans and unbans are recorded
+func (r *BannedDB) SetAuditLog(log *audit.Log) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.auditLog = log
+}
+
+// record appends event to the audit log, if it is set
+func (r *BannedDB) record(e *auditEvent.AuditEvent) {
+	r.mu.RLock()
+	log := r.auditLog
+	r.mu.RUnlock()
+	log.Record(e)
+}
+
+// recordSourceChanges records bans and unbans that were made by a blocklist or a peer
+func (r *BannedDB) recordSourceChanges(action, reason string, userIDs []int64) {
+	for _, userID := range userIDs {
+		r.record(&auditEvent.AuditEvent{
+			Action: action,
+			UserId: userID,
+			Reason: reason,
+		})
+	}
+}
+
+func (r *BannedDB) SetBot(bot botAPI.BotAPI, allowedChats []int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bot = bot
+	r.allowedChats = allowedChats
+}
+
+// ChatsFor returns chats where ban or unban issued in the chat should be applied. Ones issued outside of any chat
+// (chatID is 0, e.g. through admin API) require bans to be propagated to every allowed chat.
+func (r *BannedDB) ChatsFor(chatID int64) ([]int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.propagate {
+		if chatID == 0 {
+			return nil, ErrChatRequired
+		}
+		return []int64{chatID}, nil
+	}
+	if len(r.allowedChats) == 0 {
+		if chatID == 0 {
+			return nil, ErrNoChats
+		}
+		return []int64{chatID}, nil
+	}
+	return slices.Clone(r.allowedChats), nil
+}
+
+// UnbanUser removes the ban and makes filters treat the user as verified. Blocklists and peers won't ban the user
+// again, see tombstoneKey.
 func (r *BannedDB) UnbanUser(userID int64) error {
+	return r.unban(userID, true, interfaces.StatefulFilter.UnbanUser)
+}
+
+// RemoveBan removes the ban and resets state of the user in filters, like expiry does. Unlike UnbanUser it doesn't
+// prevent blocklists and peers from banning the user again.
+func (r *BannedDB) RemoveBan(userID int64) error {
+	return r.unban(userID, false, interfaces.StatefulFilter.RemoveState)
+}
+
+// unban removes the ban and updates state of the user in every filter with update. tombstone is set if unban was
+// requested explicitly rather than caused by an expiry.
+func (r *BannedDB) unban(userID int64, tombstone bool, update func(interfaces.StatefulFilter, int64) error) error {
 	err := r.db.Update(
 		func(txn *badger.Txn) error {
+			if tombstone {
+				err := txn.Set(tombstoneKey(userID), []byte(time.Now().UTC().Format(time.RFC3339)))
+				if err != nil {
+					return err
+				}
+			}
 			return txn.Delete(badgerHelper.UserIDToKey(userID))
 		})
 	if err != nil {
 		return err
 	}
+	metrics.Unbans.Inc()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	if r.statefulFilters != nil {
 		for _, filter := range r.statefulFilters {
-			err = filter.UnbanUser(userID)
+			err = update(filter, userID)
 			if err != nil {
 				r.logger.Error("failed to remove state from filter",
 					zap.Int64("userID", userID),
@@ -101,22 +444,116 @@ func (r *BannedDB) UnbanUser(userID int64) error {
 	return nil
 }
 
+func isExpired(record *banRecord.BanRecord, now time.Time) bool {
+	return record.ExpiresAt != nil && !record.ExpiresAt.AsTime().After(now)
+}
+
+// IsBanned returns false for expired bans, even if sweeper haven't removed them yet
 func (r *BannedDB) IsBanned(userID int64) bool {
-	var exists bool
+	var banned bool
 	err := r.db.View(
 		func(tx *badger.Txn) error {
-			key := badgerHelper.UserIDToKey(userID)
-			if val, err := tx.Get(key); err != nil {
+			record, err := getRecord(tx, userID)
+			if err != nil {
 				return err
-			} else if val != nil {
-				exists = true
 			}
+			banned = !isExpired(record, time.Now())
 			return nil
 		})
 	if err != nil {
 		return false
 	}
-	return exists
+	return banned
+}
+
+type ban struct {
+	userID int64
+	record *banRecord.BanRecord
+}
+
+func (r *BannedDB) listBans() ([]ban, error) {
+	var bans []ban
+	err := r.db.View(
+		func(tx *badger.Txn) error {
+			it := tx.NewIterator(badger.DefaultIteratorOptions)
+			defer it.Close()
+
+			for it.Rewind(); it.Valid(); it.Next() {
+				item := it.Item()
+				if !badgerHelper.IsUserIDKey(item.Key()) {
+					continue
+				}
+				userID, err := badgerHelper.KeyToUserID(item.Key())
+				if err != nil {
+					return err
+				}
+				var record *banRecord.BanRecord
+				err = item.Value(func(val []byte) error {
+					record, err = decodeRecord(val)
+					return err
+				})
+				if err != nil {
+					return err
+				}
+				bans = append(bans, ban{userID: userID, record: record})
+			}
+			return nil
+		})
+	return bans, err
+}
+
+// sweep removes expired bans and lifts them in telegram. Expiry is not a verification, so state of the user is
+// reset and filters check them again as if they have just joined.
+func (r *BannedDB) sweep() {
+	bans, err := r.listBans()
+	if err != nil {
+		r.logger.Error("failed to list bans", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	for _, b := range bans {
+		if !isExpired(b.record, now) {
+			continue
+		}
+		logger := r.logger.With(zap.Int64("userID", b.userID))
+		logger.Info("ban expired, unbanning user")
+		err = r.RemoveBan(b.userID)
+		if err != nil {
+			logger.Error("failed to remove expired ban", zap.Error(err))
+			continue
+		}
+		r.record(&auditEvent.AuditEvent{
+			Action: audit.ActionUnban,
+			UserId: b.userID,
+			Reason: "ban expired",
+		})
+
+		r.mu.RLock()
+		bot := r.bot
+		r.mu.RUnlock()
+		if bot == nil {
+			logger.Warn("bot is not set, ban can't be lifted in telegram")
+			continue
+		}
+		err = tg.UnbanUserInChats(bot, b.record.ChatIds, b.userID)
+		if err != nil {
+			logger.Error("failed to lift ban in telegram", zap.Error(err))
+		}
+	}
+}
+
+func (r *BannedDB) sweepLoop(interval time.Duration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.sweep()
+		}
+	}
 }
 
 func (r *BannedDB) ListUserIDs() ([]int64, error) {
@@ -131,6 +568,9 @@ func (r *BannedDB) ListUserIDs() ([]int64, error) {
 			for it.Rewind(); it.Valid(); it.Next() {
 				item := it.Item()
 				key := item.Key()
+				if !badgerHelper.IsUserIDKey(key) {
+					continue
+				}
 				userID, err := badgerHelper.KeyToUserID(key)
 				if err != nil {
 					return err
@@ -152,6 +592,18 @@ func (r *BannedDB) SaveState() error {
 }
 
 func (r *BannedDB) Close() error {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	r.stopFeed()
+	r.wg.Wait()
+	r.mu.RLock()
+	hub := r.events
+	r.mu.RUnlock()
+	hub.SetBanHistory(nil)
+	metrics.UntrackBadger(r.db)
 	return r.db.Close()
 }
 
@@ -159,16 +611,98 @@ func (r *BannedDB) TGAdminPrefix() string {
 	return "bandb"
 }
 
-func (r *BannedDB) listCmd(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error {
-	list, err := r.ListUserIDs()
+func (r *BannedDB) listCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	bans, err := r.listBans()
 	if err != nil {
 		logger.Error("failed to list banned users", zap.Error(err))
 		return err
 	}
 	buf := bytes.NewBuffer([]byte{})
 	buf.WriteString("Banned users:\n")
-	for _, userID := range list {
-		buf.WriteString(fmt.Sprintf("%v\n", userID))
+	for _, b := range bans {
+		buf.WriteString(fmt.Sprintf("%v - %v", b.userID, expiry(b.record)))
+		if origin := origin(b.record); origin != "" {
+			buf.WriteString(" - " + origin)
+		}
+		buf.WriteString("\n")
+	}
+	err = tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
+
+func expiry(record *banRecord.BanRecord) string {
+	if record.ExpiresAt == nil {
+		return "permanent"
+	}
+	return "expires in " + config2.FormatDuration(time.Until(record.ExpiresAt.AsTime()))
+}
+
+// origin returns short description of who issued the ban
+func origin(record *banRecord.BanRecord) string {
+	switch {
+	case record.Source != "":
+		return "imported from " + record.Source
+	case record.AdminId != 0:
+		return fmt.Sprintf("by admin %v", record.AdminId)
+	case record.ChainName != "" && record.RuleName != "":
+		return fmt.Sprintf("by %v (%v)", record.ChainName, record.RuleName)
+	case record.ChainName != "":
+		return "by " + record.ChainName
+	default:
+		return ""
+	}
+}
+
+func (r *BannedDB) infoCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	if len(tokens) < 1 {
+		logger.Warn("invalid command", zap.Strings("tokens", tokens))
+		return stateful.ErrInvalidCommand
+	}
+	userID, err := strconv.ParseInt(tokens[0], 10, 64)
+	if err != nil {
+		logger.Warn("invalid user id", zap.Strings("tokens", tokens), zap.Error(err))
+		return stateful.ErrUserIDInvalid
+	}
+	record, err := r.GetBan(userID)
+	if errors.Is(err, ErrNotBanned) {
+		return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID,
+			fmt.Sprintf("user %v is not banned", userID))
+	}
+	if err != nil {
+		logger.Error("failed to get ban", zap.Int64("userID", userID), zap.Error(err))
+		return err
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString(fmt.Sprintf("User %v is banned, %v\n", userID, expiry(record)))
+	if record.BannedAt == nil {
+		buf.WriteString("No details, ban was issued by an older version\n")
+	} else {
+		buf.WriteString(fmt.Sprintf("Banned at: %v\n", record.BannedAt.AsTime().Format(time.RFC3339)))
+	}
+	if record.ChatId != 0 {
+		buf.WriteString(fmt.Sprintf("Chat: %v\n", record.ChatId))
+	}
+	if record.AdminId != 0 {
+		buf.WriteString(fmt.Sprintf("Admin: %v\n", record.AdminId))
+	}
+	if record.Source != "" {
+		buf.WriteString(fmt.Sprintf("Source: %v\n", record.Source))
+	}
+	if record.ChainName != "" {
+		buf.WriteString(fmt.Sprintf("Chain: %v\n", record.ChainName))
+	}
+	if record.RuleName != "" {
+		buf.WriteString(fmt.Sprintf("Rule: %v\n", record.RuleName))
+	}
+	if record.Reason != "" {
+		buf.WriteString(fmt.Sprintf("Reason: %v\n", record.Reason))
+	}
+	if record.MessageExcerpt != "" {
+		buf.WriteString(fmt.Sprintf("Message: %v\n", record.MessageExcerpt))
 	}
 	err = tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
 	if err != nil {
@@ -177,7 +711,7 @@ func (r *BannedDB) listCmd(logger *zap.Logger, bot *telego.Bot, message *telego.
 	return err
 }
 
-func (r *BannedDB) unbanCmd(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error {
+func (r *BannedDB) unbanCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
 	if len(tokens) < 1 {
 		logger.Warn("invalid command", zap.Strings("tokens", tokens))
 		return stateful.ErrNotSupported
@@ -188,6 +722,21 @@ func (r *BannedDB) unbanCmd(logger *zap.Logger, bot *telego.Bot, message *telego
 		logger.Warn("invalid user id", zap.Strings("tokens", tokens), zap.Error(err))
 		return stateful.ErrUserIDInvalid
 	}
+	chatIDs, err := r.ChatsFor(message.Chat.ID)
+	if err != nil {
+		logger.Warn("no chats to unban user in", zap.Error(err))
+		_ = tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID,
+			fmt.Sprintf("cannot unban user: %s",
+				err.Error()))
+		return err
+	}
+	if record, err := r.GetBan(userIDInt); err == nil {
+		for _, chatID := range record.ChatIds {
+			if !slices.Contains(chatIDs, chatID) {
+				chatIDs = append(chatIDs, chatID)
+			}
+		}
+	}
 	err = r.UnbanUser(userIDInt)
 	if err != nil {
 		logger.Error("failed to unban user", zap.String("userID", userID), zap.Error(err))
@@ -196,20 +745,42 @@ func (r *BannedDB) unbanCmd(logger *zap.Logger, bot *telego.Bot, message *telego
 				err.Error()))
 		return err
 	}
+	r.record(&auditEvent.AuditEvent{
+		Action:  audit.ActionUnban,
+		ActorId: message.From.ID,
+		UserId:  userIDInt,
+		ChatId:  message.Chat.ID,
+	})
 
+	err = tg.UnbanUserInChats(bot, chatIDs, userIDInt)
+	if err != nil {
+		logger.Error("failed to unban user in telegram", zap.Error(err))
+	}
 	return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID,
-		fmt.Sprintf("user %v unbanned", userIDInt))
+		withChatErrors(fmt.Sprintf("user %v unbanned", userIDInt), len(chatIDs), err))
 }
 
-func (r *BannedDB) bannodelCmd(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error {
+// withChatErrors appends failures of telegram operation to the reply
+func withChatErrors(text string, chats int, err error) string {
+	if err == nil {
+		return text
+	}
+	var chatErrs tg.ChatErrors
+	if errors.As(err, &chatErrs) {
+		return fmt.Sprintf("%v, but failed in %v of %v chats: %v", text, len(chatErrs), chats, chatErrs)
+	}
+	return fmt.Sprintf("%v, but telegram returned an error: %v", text, err)
+}
+
+func (r *BannedDB) bannodelCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
 	return r.ban(logger, bot, message, tokens, false)
 }
 
-func (r *BannedDB) banCmd(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error {
+func (r *BannedDB) banCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
 	return r.ban(logger, bot, message, tokens, true)
 }
 
-func (r *BannedDB) ban(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string, deleteAll bool) error {
+func (r *BannedDB) ban(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string, deleteAll bool) error {
 	if len(tokens) < 1 {
 		logger.Warn("invalid command", zap.Strings("tokens", tokens))
 		return stateful.ErrInvalidCommand
@@ -220,7 +791,21 @@ func (r *BannedDB) ban(logger *zap.Logger, bot *telego.Bot, message *telego.Mess
 		logger.Warn("invalid user id", zap.Strings("tokens", tokens), zap.Error(err))
 		return err
 	}
-	err = r.BanUser(userIDInt)
+	var duration time.Duration
+	if len(tokens) > 1 {
+		duration, err = config2.ParseDuration(tokens[1])
+		if err != nil {
+			logger.Warn("invalid ban duration", zap.Strings("tokens", tokens), zap.Error(err))
+			return err
+		}
+	}
+	chatIDs, err := r.ChatsFor(message.Chat.ID)
+	if err == nil {
+		err = r.BanUser(userIDInt, &banRecord.BanRecord{
+			ChatId:  message.Chat.ID,
+			AdminId: message.From.ID,
+		})
+	}
 	if err != nil {
 		logger.Error("failed to add user to bandb", zap.String("userID", userID), zap.Error(err))
 		_ = tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID,
@@ -228,22 +813,34 @@ func (r *BannedDB) ban(logger *zap.Logger, bot *telego.Bot, message *telego.Mess
 				err.Error()))
 		return err
 	}
-	err = tg.BanUser(bot, message.Chat.ChatID(), userIDInt, deleteAll)
+	err = tg.BanUserInChats(bot, chatIDs, userIDInt, deleteAll)
 	if err != nil {
 		logger.Error("failed to ban user in telegram", zap.Error(err))
-		return err
 	}
-	return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID,
-		fmt.Sprintf("user %v banned", userIDInt))
+	if duration > 0 {
+		// Ban is lifted only where it was applied
+		durationErr := r.BanUserFor(userIDInt, tg.Succeeded(chatIDs, err), duration)
+		if durationErr != nil {
+			logger.Error("failed to set ban duration", zap.String("userID", userID), zap.Error(durationErr))
+			return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID,
+				fmt.Sprintf("user %v banned, but ban duration was not set: %v", userIDInt, durationErr))
+		}
+	}
+	text := fmt.Sprintf("user %v banned", userIDInt)
+	if duration > 0 {
+		text = fmt.Sprintf("user %v banned for %v", userIDInt, config2.FormatDuration(duration))
+	}
+	return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, withChatErrors(text, len(chatIDs), err))
 }
 
-func (r *BannedDB) helpCmd(logger *zap.Logger, bot *telego.Bot, message *telego.Message, _ []string) error {
+func (r *BannedDB) helpCmd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
 	buf := bytes.NewBuffer([]byte{})
 	buf.WriteString("Available commands:\n")
-	buf.WriteString(" - `list` - list all banned users (IDs only)\n")
-	buf.WriteString(" - `ban` - ban user by ID and delete all messages\n")
-	buf.WriteString(" - `banNoDel` - ban user by ID but keep all messages\n")
-	buf.WriteString(" - `unban` - unban user by ID\n")
+	buf.WriteString(" - `list` - list all banned users and time left until their bans expire\n")
+	buf.WriteString(" - `ban <id> [duration]` - ban user by ID and delete all messages, e.g. `ban 123 7d`. Ban is permanent if duration is not set\n")
+	buf.WriteString(" - `banNoDel <id> [duration]` - ban user by ID but keep all messages\n")
+	buf.WriteString(" - `info <id>` - show when, where and why user was banned\n")
+	buf.WriteString(" - `unban <id>` - unban user by ID, blocklists and peers won't ban them again\n")
 	buf.WriteString(" - `help` - this help\n")
 
 	err := tg.SendMarkdownMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
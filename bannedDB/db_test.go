@@ -0,0 +1,182 @@
+package bannedDB
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+)
+
+const testAdmin = 42
+
+// recordingFilter records which users had their state changed by BannedDB
+type recordingFilter struct {
+	interfaces.StatefulFilter
+	removed  []int64
+	unbanned []int64
+}
+
+func (f *recordingFilter) GetName() string {
+	return "recording"
+}
+
+func (f *recordingFilter) RemoveState(userID int64) error {
+	f.removed = append(f.removed, userID)
+	return nil
+}
+
+func (f *recordingFilter) UnbanUser(userID int64) error {
+	f.unbanned = append(f.unbanned, userID)
+	return nil
+}
+
+// failingBot fails to ban users in one of the chats
+type failingBot struct {
+	*fakeBot.Bot
+	chatID int64
+}
+
+func (b *failingBot) BanChatMember(params *telego.BanChatMemberParams) error {
+	err := b.Bot.BanChatMember(params)
+	if params.ChatID.ID == b.chatID {
+		return errors.New("not enough rights")
+	}
+	return err
+}
+
+func newTestDB(t *testing.T, config map[string]any) *BannedDB {
+	t.Helper()
+	if config == nil {
+		config = map[string]any{}
+	}
+	config["state_dir"] = t.TempDir()
+	db, err := New(zap.NewNop(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db.(*BannedDB)
+}
+
+func TestSweepIntervalMustBePositive(t *testing.T) {
+	_, err := New(zap.NewNop(), map[string]any{"state_dir": t.TempDir(), "sweep_interval": "0s"})
+	if !errors.Is(err, ErrSweepIntervalNotPositive) {
+		t.Errorf("got %v, want %v", err, ErrSweepIntervalNotPositive)
+	}
+}
+
+func TestExpiredBanResetsState(t *testing.T) {
+	db := newTestDB(t, nil)
+	filter := &recordingFilter{}
+	db.SetStatefulFilters([]interfaces.StatefulFilter{filter})
+	bot := fakeBot.New()
+	db.SetBot(bot, []int64{-100, -200})
+
+	err := db.BanUser(1000, &banRecord.BanRecord{ChatId: -100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.BanUserFor(1000, []int64{-100}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	db.sweep()
+
+	if db.IsBanned(1000) {
+		t.Errorf("expired ban was not removed")
+	}
+	if !slices.Equal(filter.removed, []int64{1000}) || len(filter.unbanned) != 0 {
+		t.Errorf("state was not reset: removed %v, verified %v", filter.removed, filter.unbanned)
+	}
+	unbans := bot.CallsTo(fakeBot.MethodUnbanChatMember)
+	if len(unbans) != 1 || unbans[0].Params.(*telego.UnbanChatMemberParams).ChatID.ID != -100 {
+		t.Errorf("ban was not lifted only where it was applied: %+v", unbans)
+	}
+}
+
+func TestUnbanVerifiesUser(t *testing.T) {
+	db := newTestDB(t, nil)
+	filter := &recordingFilter{}
+	db.SetStatefulFilters([]interfaces.StatefulFilter{filter})
+
+	err := db.BanUser(1000, &banRecord.BanRecord{ChatId: -100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.UnbanUser(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(filter.unbanned, []int64{1000}) || len(filter.removed) != 0 {
+		t.Errorf("user was not verified: removed %v, verified %v", filter.removed, filter.unbanned)
+	}
+}
+
+func TestBanCmdRecordsOnlyBannedChats(t *testing.T) {
+	db := newTestDB(t, map[string]any{"propagate_to_all_chats": true})
+	bot := &failingBot{Bot: fakeBot.New(), chatID: -200}
+	db.SetBot(bot, []int64{-100, -200})
+
+	msg := &telego.Message{
+		MessageID: 1,
+		From:      &telego.User{ID: testAdmin},
+		Chat:      telego.Chat{ID: -100, Type: telego.ChatTypeSupergroup},
+	}
+	err := db.banCmd(zap.NewNop(), bot, msg, []string{"1000", "1d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(bot.CallsTo(fakeBot.MethodBanChatMember)); n != 2 {
+		t.Errorf("user was banned in %v chats, want 2", n)
+	}
+	record, err := db.GetBan(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.ExpiresAt == nil {
+		t.Errorf("ban duration was not set")
+	}
+	if !slices.Equal(record.ChatIds, []int64{-100}) {
+		t.Errorf("got chats %v, want only the one where ban succeeded", record.ChatIds)
+	}
+}
+
+func TestChatsFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		propagate bool
+		allowed   []int64
+		chatID    int64
+		want      []int64
+		wantErr   error
+	}{
+		{name: "chat", chatID: -100, want: []int64{-100}},
+		{name: "no chat", wantErr: ErrChatRequired},
+		{name: "propagated", propagate: true, allowed: []int64{-100, -200}, chatID: -100, want: []int64{-100, -200}},
+		{name: "propagated without chat", propagate: true, allowed: []int64{-100, -200}, want: []int64{-100, -200}},
+		{name: "no chats configured", propagate: true, chatID: -100, want: []int64{-100}},
+		{name: "no chats configured without chat", propagate: true, wantErr: ErrNoChats},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t, map[string]any{"propagate_to_all_chats": tt.propagate})
+			db.SetBot(fakeBot.New(), tt.allowed)
+			got, err := db.ChatsFor(tt.chatID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got chats %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package bannedDB
+
+import (
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+)
+
+// SetEvents sets hub where new bans are published, the database becomes source of bans issued before rules that
+// learn from them were created. Imported bans are not published.
+func (r *BannedDB) SetEvents(hub *events.Hub) {
+	r.mu.Lock()
+	r.events = hub
+	r.mu.Unlock()
+	hub.SetBanHistory(r)
+}
+
+// publishBan passes the ban to the hub, if it is set
+func (r *BannedDB) publishBan(userID int64, record *banRecord.BanRecord) {
+	r.mu.RLock()
+	hub := r.events
+	r.mu.RUnlock()
+	hub.PublishBan(userID, record)
+}
+
+// ForEachBan calls fn for every ban that was issued locally, bans from blocklists and peers are skipped
+func (r *BannedDB) ForEachBan(fn events.BanObserver) error {
+	bans, err := r.listBans()
+	if err != nil {
+		return err
+	}
+	for _, b := range bans {
+		if b.record.Source != "" {
+			continue
+		}
+		fn(b.userID, b.record)
+	}
+	return nil
+}
@@ -0,0 +1,495 @@
+package bannedDB
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Civil/tg-simple-regex-antispam/audit"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	badgerHelper "github.com/Civil/tg-simple-regex-antispam/helper/badger"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+)
+
+var (
+	ErrFeedNotAMap         = errors.New("feed must have `listen_address` and `tokens` parameters")
+	ErrFeedTokensEmpty     = errors.New("feed requires at least one token in `tokens`")
+	ErrPeersNotAList       = errors.New("peers must be a list")
+	ErrPeerNotAMap         = errors.New("peer must have `source`, `url` and `token` parameters")
+	ErrPeerSourceEmpty     = errors.New("peer source cannot be empty")
+	ErrUnknownTrust        = errors.New("unknown trust, supported values are `all` and `manual`")
+	ErrUnexpectedStatus    = errors.New("unexpected response status")
+	ErrSourceAlreadyExists = errors.New("peer and blocklist sources must be unique")
+)
+
+const (
+	// TrustAll imports every ban of the peer
+	TrustAll = "all"
+	// TrustManual imports only bans issued by admins of the peer
+	TrustManual = "manual"
+)
+
+// feedConfig describes HTTP endpoint that serves local bans to peers
+type feedConfig struct {
+	listenAddress string
+	path          string
+	tokens        []string
+	// Bans imported from blocklists and peers are not served unless it is set
+	shareImported bool
+}
+
+// peer is another instance of the bot, its feed is polled and merged into local bans
+type peer struct {
+	source   string
+	url      string
+	token    string
+	trust    string
+	interval time.Duration
+	// timeout limits a single request to the feed
+	timeout time.Duration
+	// Full snapshot is requested that often, it removes bans that were lifted while incremental updates were missed
+	fullSyncInterval time.Duration
+}
+
+// FeedEntry is a ban (or its removal) in the feed
+type FeedEntry struct {
+	UserID  int64           `json:"user_id"`
+	Record  json.RawMessage `json:"record,omitempty"`
+	Removed bool            `json:"removed,omitempty"`
+}
+
+// FeedResponse contains changes since the cursor of the request. If Full is set, entries contain every ban and
+// anything else from the same source must be removed.
+type FeedResponse struct {
+	Cursor  uint64      `json:"cursor"`
+	Full    bool        `json:"full"`
+	Entries []FeedEntry `json:"entries"`
+}
+
+func parseFeed(config map[string]any) (*feedConfig, error) {
+	feedI, ok := config["feed"]
+	if !ok {
+		return nil, nil
+	}
+	cfg, ok := feedI.(map[string]any)
+	if !ok {
+		return nil, ErrFeedNotAMap
+	}
+	listenAddress, err := config2.GetOptionString(cfg, "listen_address")
+	if err != nil {
+		return nil, err
+	}
+	tokensI, _ := cfg["tokens"].([]any)
+	tokens := make([]string, 0, len(tokensI))
+	for _, t := range tokensI {
+		if token, ok := t.(string); ok && token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, ErrFeedTokensEmpty
+	}
+	shareImported, err := config2.GetOptionBoolWithDefault(cfg, "share_imported", false)
+	if err != nil {
+		return nil, err
+	}
+	return &feedConfig{
+		listenAddress: listenAddress,
+		path:          config2.GetOptionStringWithDefault(cfg, "path", "/bans"),
+		tokens:        tokens,
+		shareImported: shareImported,
+	}, nil
+}
+
+func parsePeers(config map[string]any) ([]peer, error) {
+	peersI, ok := config["peers"]
+	if !ok {
+		return nil, nil
+	}
+	peers, ok := peersI.([]any)
+	if !ok {
+		return nil, ErrPeersNotAList
+	}
+
+	res := make([]peer, 0, len(peers))
+	for _, p := range peers {
+		cfg, ok := p.(map[string]any)
+		if !ok {
+			return nil, ErrPeerNotAMap
+		}
+		source, err := config2.GetOptionString(cfg, "source")
+		if err != nil {
+			return nil, err
+		}
+		if source == "" {
+			return nil, ErrPeerSourceEmpty
+		}
+		feedURL, err := config2.GetOptionString(cfg, "url")
+		if err != nil {
+			return nil, err
+		}
+		token, err := config2.GetOptionString(cfg, "token")
+		if err != nil {
+			return nil, err
+		}
+		trust := config2.GetOptionStringWithDefault(cfg, "trust", TrustAll)
+		if trust != TrustAll && trust != TrustManual {
+			return nil, ErrUnknownTrust
+		}
+		interval, err := config2.GetOptionDurationWithDefault(cfg, "interval", time.Minute)
+		if err != nil {
+			return nil, err
+		}
+		fullSyncInterval, err := config2.GetOptionDurationWithDefault(cfg, "full_sync_interval", 24*time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		timeout, err := config2.GetOptionDurationWithDefault(cfg, "timeout", 30*time.Second)
+		if err != nil {
+			return nil, err
+		}
+		if interval <= 0 || fullSyncInterval <= 0 || timeout <= 0 {
+			return nil, ErrDurationNotPositive
+		}
+		res = append(res, peer{
+			source:           source,
+			url:              feedURL,
+			token:            token,
+			trust:            trust,
+			interval:         interval,
+			timeout:          timeout,
+			fullSyncInterval: fullSyncInterval,
+		})
+	}
+	return res, nil
+}
+
+// changesSince returns bans that were changed after the cursor. Removals are known only until the database is
+// compacted, that's why peers request full snapshot from time to time.
+func (r *BannedDB) changesSince(since uint64, shareImported bool) (*FeedResponse, error) {
+	res := &FeedResponse{
+		Cursor:  since,
+		Full:    since == 0,
+		Entries: make([]FeedEntry, 0),
+	}
+	err := r.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.AllVersions = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		var lastKey []byte
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			// Versions of the key are iterated from the newest one, only it matters
+			if lastKey != nil && string(item.Key()) == string(lastKey) {
+				continue
+			}
+			lastKey = item.KeyCopy(nil)
+			res.Cursor = max(res.Cursor, item.Version())
+			if item.Version() <= since || !badgerHelper.IsUserIDKey(item.Key()) {
+				continue
+			}
+
+			userID, err := badgerHelper.KeyToUserID(item.Key())
+			if err != nil {
+				return err
+			}
+			if item.IsDeletedOrExpired() {
+				if !res.Full {
+					res.Entries = append(res.Entries, FeedEntry{UserID: userID, Removed: true})
+				}
+				continue
+			}
+			var record *banRecord.BanRecord
+			err = item.Value(func(val []byte) error {
+				record, err = decodeRecord(val)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if record.Source != "" && !shareImported {
+				continue
+			}
+			data, err := protojson.Marshal(record)
+			if err != nil {
+				return err
+			}
+			res.Entries = append(res.Entries, FeedEntry{UserID: userID, Record: data})
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (r *BannedDB) authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	for _, t := range r.feed.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *BannedDB) serveFeed(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !r.authorized(req) {
+		r.logger.Warn("unauthorized feed request", zap.String("remote_addr", req.RemoteAddr))
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var since uint64
+	if s := req.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := r.changesSince(since, r.feed.shareImported)
+	if err != nil {
+		r.logger.Error("failed to build feed", zap.Error(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		r.logger.Warn("failed to send feed", zap.Error(err))
+	}
+}
+
+// StartFeed starts HTTP feed and polling of peers, if they are configured
+func (r *BannedDB) StartFeed() error {
+	for _, p := range r.peers {
+		r.wg.Add(1)
+		go r.peerLoop(p)
+	}
+	if r.feed == nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", r.feed.listenAddress)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(r.feed.path, r.serveFeed)
+	r.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	r.logger.Info("serving ban feed", zap.String("listen_address", listener.Addr().String()), zap.String("path", r.feed.path))
+	go func() {
+		err := r.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			r.logger.Error("ban feed server failed", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (r *BannedDB) stopFeed() {
+	if r.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := r.server.Shutdown(ctx)
+	if err != nil {
+		r.logger.Warn("failed to stop ban feed server", zap.Error(err))
+	}
+}
+
+func (r *BannedDB) fetchFeed(ctx context.Context, p peer, since uint64) (*FeedResponse, error) {
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	q.Set("since", strconv.FormatUint(since, 10))
+	u.RawQuery = q.Encode()
+
+	// Peer that accepted connection but never responds must not stop polling
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %v", ErrUnexpectedStatus, resp.Status)
+	}
+	var res FeedResponse
+	err = json.NewDecoder(resp.Body).Decode(&res)
+	return &res, err
+}
+
+// applyFeed merges bans of the peer into local ones. Local bans and bans from other sources are never changed, users
+// that were unbanned explicitly are not banned again.
+func (r *BannedDB) applyFeed(p peer, feed *FeedResponse) (added, removed int, err error) {
+	records := make(map[int64]*banRecord.BanRecord, len(feed.Entries))
+	removals := make([]int64, 0)
+	for _, e := range feed.Entries {
+		if e.Removed {
+			removals = append(removals, e.UserID)
+			continue
+		}
+		record := &banRecord.BanRecord{}
+		err = protojson.Unmarshal(e.Record, record)
+		if err != nil {
+			return 0, 0, fmt.Errorf("user %v: %w", e.UserID, err)
+		}
+		if p.trust == TrustManual && record.AdminId == 0 {
+			removals = append(removals, e.UserID)
+			continue
+		}
+		// Chats of the peer are not ours, ban must not be lifted there once it expires
+		record.ChatIds = nil
+		record.Source = p.source
+		records[e.UserID] = record
+	}
+
+	if feed.Full {
+		bans, err := r.listBans()
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, b := range bans {
+			if _, ok := records[b.userID]; !ok && b.record.Source == p.source {
+				removals = append(removals, b.userID)
+			}
+		}
+	}
+
+	removedIDs := make([]int64, 0, len(removals))
+	err = r.updateEach(removals, func(txn *badger.Txn, userID int64) error {
+		record, err := getRecord(txn, userID)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil
+		}
+		if err != nil || record.Source != p.source {
+			return err
+		}
+		err = txn.Delete(badgerHelper.UserIDToKey(userID))
+		if err == nil {
+			removedIDs = append(removedIDs, userID)
+		}
+		return err
+	})
+	r.recordSourceChanges(audit.ActionUnban, "unbanned by peer "+p.source, removedIDs)
+	if err != nil {
+		return 0, len(removedIDs), err
+	}
+
+	userIDs := make([]int64, 0, len(records))
+	for userID := range records {
+		userIDs = append(userIDs, userID)
+	}
+	// Updates of bans that were already merged are not audited, only new ones
+	newIDs := make([]int64, 0)
+	err = r.updateEach(userIDs, func(txn *badger.Txn, userID int64) error {
+		existing, err := getRecord(txn, userID)
+		if err == nil && existing.Source != p.source {
+			return nil
+		}
+		isNew := errors.Is(err, badger.ErrKeyNotFound)
+		if err != nil && !isNew {
+			return err
+		}
+		unbanned, err := hasTombstone(txn, userID)
+		if err != nil || unbanned {
+			return err
+		}
+		val, err := proto.Marshal(records[userID])
+		if err != nil {
+			return err
+		}
+		err = txn.Set(badgerHelper.UserIDToKey(userID), val)
+		if err == nil {
+			added++
+			if isNew {
+				newIDs = append(newIDs, userID)
+			}
+		}
+		return err
+	})
+	r.recordSourceChanges(audit.ActionBan, "banned by peer "+p.source, newIDs)
+	return added, len(removedIDs), err
+}
+
+func (r *BannedDB) peerLoop(p peer) {
+	defer r.wg.Done()
+	logger := r.logger.With(zap.String("peer", p.source), zap.String("url", p.url))
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var cursor uint64
+	var lastFullSync time.Time
+	for {
+		since := cursor
+		if time.Since(lastFullSync) >= p.fullSyncInterval {
+			since = 0
+		}
+		feed, err := r.fetchFeed(ctx, p, since)
+		if err == nil {
+			var added, removed int
+			added, removed, err = r.applyFeed(p, feed)
+			if err == nil {
+				cursor = feed.Cursor
+				if feed.Full {
+					lastFullSync = time.Now()
+				}
+				logger.Debug("ban feed merged", zap.Bool("full", feed.Full), zap.Int("updated", added), zap.Int("removed", removed))
+			}
+		}
+		if err != nil && ctx.Err() == nil {
+			logger.Error("failed to merge ban feed", zap.Error(err))
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package bannedDB
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+)
+
+const feedToken = "secret"
+
+// newFeedServer serves feed of the instance over local HTTP
+func newFeedServer(t *testing.T, db *BannedDB) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(db.serveFeed))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newPeer(url, token string) peer {
+	return peer{
+		source:           "partner",
+		url:              url,
+		token:            token,
+		trust:            TrustAll,
+		interval:         time.Minute,
+		timeout:          time.Second,
+		fullSyncInterval: time.Hour,
+	}
+}
+
+// syncPeer merges feed of the peer since the cursor and returns new cursor
+func syncPeer(t *testing.T, db *BannedDB, p peer, since uint64) uint64 {
+	t.Helper()
+	feed, err := db.fetchFeed(context.Background(), p, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = db.applyFeed(p, feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed.Cursor
+}
+
+func TestFeedRejectsInvalidToken(t *testing.T) {
+	origin := newTestDB(t, map[string]any{"feed": map[string]any{"listen_address": "127.0.0.1:0", "tokens": []any{feedToken}}})
+	err := origin.BanUser(1000, &banRecord.BanRecord{AdminId: testAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newFeedServer(t, origin)
+	db := newTestDB(t, nil)
+
+	for _, token := range []string{"", "wrong"} {
+		_, err = db.fetchFeed(context.Background(), newPeer(srv.URL, token), 0)
+		if !errors.Is(err, ErrUnexpectedStatus) {
+			t.Errorf("token %q: got %v, want %v", token, err, ErrUnexpectedStatus)
+		}
+	}
+	if db.IsBanned(1000) {
+		t.Errorf("ban was imported without authorization")
+	}
+}
+
+func TestFeedPropagatesExpiry(t *testing.T) {
+	origin := newTestDB(t, map[string]any{"feed": map[string]any{"listen_address": "127.0.0.1:0", "tokens": []any{feedToken}}})
+	origin.SetBot(fakeBot.New(), []int64{-100})
+	srv := newFeedServer(t, origin)
+	db := newTestDB(t, nil)
+	p := newPeer(srv.URL, feedToken)
+
+	err := origin.BanUser(1000, &banRecord.BanRecord{ChatId: -100, AdminId: testAdmin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = origin.BanUserFor(1000, []int64{-100}, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := syncPeer(t, db, p, 0)
+
+	record, err := db.GetBan(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Source != "partner" || record.ExpiresAt == nil || len(record.ChatIds) != 0 {
+		t.Errorf("unexpected imported ban: %+v", record)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	origin.sweep()
+	syncPeer(t, db, p, cursor)
+
+	if _, err := db.GetBan(1000); !errors.Is(err, ErrNotBanned) {
+		t.Errorf("expired ban was not removed from the peer: %v", err)
+	}
+}
+
+func TestFeedRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+	db := newTestDB(t, nil)
+	p := newPeer(srv.URL, feedToken)
+	p.timeout = 50 * time.Millisecond
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := db.fetchFeed(context.Background(), p, 0)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("request to unresponsive peer didn't time out")
+	}
+}
@@ -1,15 +1,46 @@
 package bannedDB
 
 import (
+	"time"
+
+	"github.com/Civil/tg-simple-regex-antispam/audit"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
 	"github.com/Civil/tg-simple-regex-antispam/helper/stateful"
 )
 
 type BanDB interface {
 	stateful.Stateful
-	BanUser(userID int64) error
+	// BanUser bans user permanently, info describes why and where
+	BanUser(userID int64, info *banRecord.BanRecord) error
+	// BanUserFor bans user for the duration, ban is lifted in chats where user was banned once it expires
+	BanUserFor(userID int64, chatIDs []int64, duration time.Duration) error
 	UnbanUser(userID int64) error
+	// RemoveBan removes the ban as if it expired: user is not marked as explicitly unbanned or verified
+	RemoveBan(userID int64) error
 	IsBanned(userID int64) bool
+	GetBan(userID int64) (*banRecord.BanRecord, error)
+	// SetBan stores the record as is, replacing existing one
+	SetBan(userID int64, record *banRecord.BanRecord) error
 	ListUserIDs() ([]int64, error)
 	SetStatefulFilters(filters []interfaces.StatefulFilter)
+	// IsVerified returns true if any of the stateful filters verified the user, see interfaces.Verifier
+	IsVerified(userID int64) bool
+	// SetBot sets bot that is used to lift expired bans in telegram and chats where bans can be propagated
+	SetBot(bot botAPI.BotAPI, allowedChats []int64)
+	// ChatsFor returns chats where ban or unban issued in the chat should be applied, chatID is 0 if it was issued
+	// outside of any chat
+	ChatsFor(chatID int64) ([]int64, error)
+	// ForEachBan calls fn for every ban that was issued locally
+	ForEachBan(fn events.BanObserver) error
+	// SetEvents sets hub where new bans are published
+	SetEvents(hub *events.Hub)
+	// SetAuditLog sets log where bans and unbans are recorded, they are not recorded until it is set
+	SetAuditLog(log *audit.Log)
+	// Start starts lifting expired bans and importing blocklists in background
+	Start()
+	// StartFeed starts HTTP feed of bans and polling of peer feeds, if they are configured
+	StartFeed() error
 }
@@ -0,0 +1,395 @@
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/message"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/metrics"
+)
+
+var (
+	ErrStateDirEmpty = errors.New("capture.state_dir cannot be empty")
+	ErrStopIteration = errors.New("stop iteration")
+)
+
+const (
+	prefixMessage byte = 'm'
+	prefixChat    byte = 'c'
+	prefixUser    byte = 'u'
+
+	deleteBatchSize = 1000
+)
+
+// Store keeps copies of incoming messages.
+//
+// Every message is stored once under a primary key ordered by time and indexed by chat and by user. All keys
+// expire after retention period, on top of that oldest messages are removed when total size exceeds the limit.
+type Store struct {
+	logger *zap.Logger
+	db     *badger.DB
+
+	retention time.Duration
+	maxSize   int64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Query selects stored messages, zero values mean "any"
+type Query struct {
+	ChatID int64
+	UserID int64
+	Since  time.Time
+	Until  time.Time
+}
+
+func open(logger *zap.Logger, cfg config.CaptureConfig, readOnly bool) (*Store, error) {
+	if cfg.StateDir == "" {
+		return nil, ErrStateDirEmpty
+	}
+	opts := badgerOpts.GetBadgerOptions(logger, "capture", cfg.StateDir)
+	opts.ReadOnly = readOnly
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	metrics.TrackBadger("capture", db)
+
+	return &Store{
+		logger:    logger.With(zap.String("component", "capture")),
+		db:        db,
+		retention: cfg.Retention,
+		maxSize:   cfg.MaxSizeMB * 1024 * 1024,
+		stop:      make(chan struct{}),
+	}, nil
+}
+
+// New opens the store and starts background cleanup
+func New(logger *zap.Logger, cfg config.CaptureConfig) (*Store, error) {
+	s, err := open(logger, cfg, false)
+	if err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.cleanupLoop(cfg.CleanupInterval)
+	return s, nil
+}
+
+// OpenReadOnly opens the store for export, it fails if the store is used by the running bot
+func OpenReadOnly(logger *zap.Logger, cfg config.CaptureConfig) (*Store, error) {
+	return open(logger, cfg, true)
+}
+
+// sortableInt converts signed int to unsigned one that keeps the order when encoded as big endian
+func sortableInt(i int64) uint64 {
+	return uint64(i) ^ (1 << 63)
+}
+
+func appendInt(buf []byte, i int64) []byte {
+	return binary.BigEndian.AppendUint64(buf, sortableInt(i))
+}
+
+func readInt(buf []byte) int64 {
+	return int64(binary.BigEndian.Uint64(buf) ^ (1 << 63))
+}
+
+func messageKey(date, chatID, messageID int64) []byte {
+	key := make([]byte, 0, 25)
+	key = append(key, prefixMessage)
+	key = appendInt(key, date)
+	key = appendInt(key, chatID)
+	return appendInt(key, messageID)
+}
+
+func chatKey(chatID, date, messageID int64) []byte {
+	key := make([]byte, 0, 25)
+	key = append(key, prefixChat)
+	key = appendInt(key, chatID)
+	key = appendInt(key, date)
+	return appendInt(key, messageID)
+}
+
+func userKey(userID, date, chatID, messageID int64) []byte {
+	key := make([]byte, 0, 33)
+	key = append(key, prefixUser)
+	key = appendInt(key, userID)
+	key = appendInt(key, date)
+	key = appendInt(key, chatID)
+	return appendInt(key, messageID)
+}
+
+// Capture stores the message. Edited messages replace previously stored version.
+func (s *Store) Capture(msg *telego.Message) error {
+	m := message.FromTelego(msg)
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	var userID int64
+	if msg.From != nil {
+		userID = msg.From.ID
+	}
+	date := msg.Date
+	chatID := msg.Chat.ID
+	messageID := int64(msg.MessageID)
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		entries := []*badger.Entry{
+			badger.NewEntry(messageKey(date, chatID, messageID), b),
+			badger.NewEntry(chatKey(chatID, date, messageID), nil),
+			badger.NewEntry(userKey(userID, date, chatID, messageID), nil),
+		}
+		for _, e := range entries {
+			if s.retention > 0 {
+				e = e.WithTTL(s.retention)
+			}
+			err := txn.SetEntry(e)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (q *Query) match(date int64) bool {
+	if !q.Since.IsZero() && date < q.Since.Unix() {
+		return false
+	}
+	if !q.Until.IsZero() && date > q.Until.Unix() {
+		return false
+	}
+	return true
+}
+
+// scanRange returns prefix of the index that should be used for the query and key to start iteration from
+func (q *Query) scanRange() ([]byte, []byte) {
+	var since int64
+	if !q.Since.IsZero() {
+		since = q.Since.Unix()
+	}
+	switch {
+	case q.UserID != 0:
+		prefix := appendInt([]byte{prefixUser}, q.UserID)
+		return prefix, appendInt(append([]byte{}, prefix...), since)
+	case q.ChatID != 0:
+		prefix := appendInt([]byte{prefixChat}, q.ChatID)
+		return prefix, appendInt(append([]byte{}, prefix...), since)
+	default:
+		return []byte{prefixMessage}, appendInt([]byte{prefixMessage}, since)
+	}
+}
+
+// primaryKey converts index key to the key of the message and returns date of the message
+func primaryKey(key []byte) ([]byte, int64) {
+	switch key[0] {
+	case prefixUser:
+		date, chatID, messageID := readInt(key[9:17]), readInt(key[17:25]), readInt(key[25:33])
+		return messageKey(date, chatID, messageID), date
+	case prefixChat:
+		chatID, date, messageID := readInt(key[1:9]), readInt(key[9:17]), readInt(key[17:25])
+		return messageKey(date, chatID, messageID), date
+	default:
+		return key, readInt(key[1:9])
+	}
+}
+
+// ForEach calls fn for every message that matches the query in chronological order (per chat or per user, if
+// they are set). Returning ErrStopIteration from fn stops iteration without an error.
+func (s *Store) ForEach(q Query, fn func(*message.Message) error) error {
+	prefix, start := q.scanRange()
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.PrefetchValues = prefix[0] == prefixMessage
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(start); it.Valid(); it.Next() {
+			key, date := primaryKey(it.Item().KeyCopy(nil))
+			if !q.Until.IsZero() && date > q.Until.Unix() {
+				return nil
+			}
+			if !q.match(date) {
+				continue
+			}
+
+			item, err := txn.Get(key)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			var m message.Message
+			err = item.Value(func(val []byte) error {
+				return proto.Unmarshal(val, &m)
+			})
+			if err != nil {
+				return err
+			}
+			if q.ChatID != 0 && m.GetChat().GetId() != q.ChatID {
+				continue
+			}
+
+			err = fn(&m)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// deleteMessages removes messages and their indexes
+func (s *Store) deleteMessages(msgs []*message.Message) error {
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, m := range msgs {
+		date, chatID, messageID := int64(m.GetDate()), m.GetChat().GetId(), int64(m.GetMessageId())
+		for _, key := range [][]byte{
+			messageKey(date, chatID, messageID),
+			chatKey(chatID, date, messageID),
+			userKey(int64(m.GetFrom().GetId()), date, chatID, messageID),
+		} {
+			err := wb.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return wb.Flush()
+}
+
+// Purge removes all messages that match the query and returns amount of removed messages
+func (s *Store) Purge(q Query) (int, error) {
+	toDelete := make([]*message.Message, 0)
+	err := s.ForEach(q, func(m *message.Message) error {
+		toDelete = append(toDelete, m)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(toDelete), s.deleteMessages(toDelete)
+}
+
+// messageSize estimates amount of space that message takes, including its indexes
+func messageSize(valueSize int64) int64 {
+	return valueSize + 25 + 25 + 33
+}
+
+// dataSize returns size of stored messages
+func (s *Store) dataSize() (int64, error) {
+	var size int64
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte{prefixMessage}
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			size += messageSize(int64(it.Item().ValueSize()))
+		}
+		return nil
+	})
+	return size, err
+}
+
+// enforceSizeLimit removes oldest messages until stored data fits into the limit
+func (s *Store) enforceSizeLimit() error {
+	if s.maxSize <= 0 {
+		return nil
+	}
+	size, err := s.dataSize()
+	if err != nil {
+		return err
+	}
+	if size <= s.maxSize {
+		return nil
+	}
+
+	toFree := size - s.maxSize
+	s.logger.Info("capture store exceeds size limit, removing oldest messages",
+		zap.Int64("size", size),
+		zap.Int64("max_size", s.maxSize),
+	)
+	batch := make([]*message.Message, 0, deleteBatchSize)
+	removed := 0
+	err = s.ForEach(Query{}, func(m *message.Message) error {
+		batch = append(batch, m)
+		toFree -= messageSize(int64(proto.Size(m)))
+		if len(batch) >= deleteBatchSize || toFree <= 0 {
+			err := s.deleteMessages(batch)
+			if err != nil {
+				return err
+			}
+			removed += len(batch)
+			batch = batch[:0]
+		}
+		if toFree <= 0 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		err = s.deleteMessages(batch)
+		removed += len(batch)
+	}
+	s.logger.Info("removed oldest messages", zap.Int("count", removed))
+	return err
+}
+
+func (s *Store) cleanupLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			err := s.enforceSizeLimit()
+			if err != nil {
+				s.logger.Error("failed to enforce size limit", zap.Error(err))
+			}
+			for {
+				// Returns an error once there is nothing left to collect
+				if s.db.RunValueLogGC(0.5) != nil {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (s *Store) Close() error {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	s.wg.Wait()
+	metrics.UntrackBadger(s.db)
+	return s.db.Close()
+}
@@ -0,0 +1,250 @@
+package capture
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/message"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := New(zap.NewNop(), config.CaptureConfig{StateDir: t.TempDir(), CleanupInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+	return s
+}
+
+func testMessage(minute int, chatID, userID int64, text string) *telego.Message {
+	return &telego.Message{
+		MessageID: minute,
+		Date:      testStart.Add(time.Duration(minute) * time.Minute).Unix(),
+		Chat:      telego.Chat{ID: chatID},
+		From:      &telego.User{ID: userID},
+		Text:      text,
+	}
+}
+
+// testMessages are captured out of order, texts are used to identify them. Most of the chats have negative IDs, as
+// supergroups do.
+var testMessages = []*telego.Message{
+	testMessage(1, -100, 1, "1"),
+	testMessage(3, -200, 2, "3"),
+	testMessage(2, 100, 1, "2"),
+	testMessage(4, -100, 2, "4"),
+	testMessage(5, -200, 1, "5"),
+}
+
+func captureTestMessages(t *testing.T, s *Store) {
+	t.Helper()
+	for _, m := range testMessages {
+		err := s.Capture(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func texts(t *testing.T, s *Store, q Query) []string {
+	t.Helper()
+	res := make([]string, 0)
+	err := s.ForEach(q, func(m *message.Message) error {
+		res = append(res, m.GetText())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestSortableInt(t *testing.T) {
+	values := []int64{-1 << 63, -1001234567890, -1, 0, 1, 1001234567890, 1<<63 - 1}
+	for i, v := range values {
+		if got := readInt(appendInt(nil, v)); got != v {
+			t.Errorf("%v was decoded as %v", v, got)
+		}
+		if i > 0 && bytes.Compare(appendInt(nil, values[i-1]), appendInt(nil, v)) >= 0 {
+			t.Errorf("order of %v and %v is not kept", values[i-1], v)
+		}
+	}
+}
+
+func TestPrimaryKey(t *testing.T) {
+	const (
+		date      = 1700000000
+		chatID    = -1001234567890
+		userID    = 1000
+		messageID = 42
+	)
+	want := messageKey(date, chatID, messageID)
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{name: "message", key: want},
+		{name: "chat index", key: chatKey(chatID, date, messageID)},
+		{name: "user index", key: userKey(userID, date, chatID, messageID)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, gotDate := primaryKey(tt.key)
+			if !bytes.Equal(key, want) || gotDate != date {
+				t.Errorf("got key %x and date %v, want %x and %v", key, gotDate, want, date)
+			}
+		})
+	}
+}
+
+func TestForEach(t *testing.T) {
+	s := newTestStore(t)
+	captureTestMessages(t, s)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []string
+	}{
+		{name: "all messages by time", want: []string{"1", "2", "3", "4", "5"}},
+		{name: "by chat", query: Query{ChatID: -100}, want: []string{"1", "4"}},
+		{name: "by chat with positive id", query: Query{ChatID: 100}, want: []string{"2"}},
+		{name: "by user", query: Query{UserID: 1}, want: []string{"1", "2", "5"}},
+		{name: "by user and chat", query: Query{UserID: 1, ChatID: -200}, want: []string{"5"}},
+		{name: "unknown chat", query: Query{ChatID: -300}, want: []string{}},
+		{
+			name:  "time range",
+			query: Query{Since: testStart.Add(2 * time.Minute), Until: testStart.Add(4 * time.Minute)},
+			want:  []string{"2", "3", "4"},
+		},
+		{name: "chat until", query: Query{ChatID: -200, Until: testStart.Add(4 * time.Minute)}, want: []string{"3"}},
+		{name: "user since", query: Query{UserID: 2, Since: testStart.Add(4 * time.Minute)}, want: []string{"4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := texts(t, s, tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("got messages %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForEachStopsAtUntil(t *testing.T) {
+	s := newTestStore(t)
+	captureTestMessages(t, s)
+
+	var visited int
+	err := s.ForEach(Query{Until: testStart.Add(2 * time.Minute)}, func(*message.Message) error {
+		visited++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visited != 2 {
+		t.Errorf("visited %v messages, want 2", visited)
+	}
+
+	err = s.ForEach(Query{}, func(*message.Message) error {
+		visited++
+		return ErrStopIteration
+	})
+	if err != nil || visited != 3 {
+		t.Errorf("iteration was not stopped: visited %v, error %v", visited, err)
+	}
+}
+
+func TestEditedMessageReplacesCaptured(t *testing.T) {
+	s := newTestStore(t)
+	for _, text := range []string{"original", "edited"} {
+		err := s.Capture(testMessage(1, -100, 1, text))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := texts(t, s, Query{}); !slices.Equal(got, []string{"edited"}) {
+		t.Errorf("got messages %v, want only edited one", got)
+	}
+}
+
+// keyCount returns number of keys with the prefix
+func keyCount(t *testing.T, s *Store, prefix byte) int {
+	t.Helper()
+	var n int
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte{prefix}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestPurge(t *testing.T) {
+	s := newTestStore(t)
+	captureTestMessages(t, s)
+
+	removed, err := s.Purge(Query{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("removed %v messages, want 3", removed)
+	}
+	if got := texts(t, s, Query{}); !slices.Equal(got, []string{"3", "4"}) {
+		t.Errorf("got messages %v, want [3 4]", got)
+	}
+	// Indexes are removed together with messages
+	for _, prefix := range []byte{prefixMessage, prefixChat, prefixUser} {
+		if n := keyCount(t, s, prefix); n != 2 {
+			t.Errorf("got %v keys with prefix %q, want 2", n, prefix)
+		}
+	}
+}
+
+func TestEnforceSizeLimit(t *testing.T) {
+	s := newTestStore(t)
+	captureTestMessages(t, s)
+
+	size, err := s.dataSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.enforceSizeLimit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(t, s, Query{}); len(got) != len(testMessages) {
+		t.Fatalf("messages were removed without limit: %v", got)
+	}
+
+	// Removal of the oldest message is enough to fit into the limit
+	s.maxSize = size - 1
+	err = s.enforceSizeLimit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(t, s, Query{}); !slices.Equal(got, []string{"2", "3", "4", "5"}) {
+		t.Errorf("got messages %v, want the newest [2 3 4 5]", got)
+	}
+	if n := keyCount(t, s, prefixUser); n != 4 {
+		t.Errorf("got %v user index keys, want 4", n)
+	}
+}
@@ -0,0 +1,138 @@
+package chains
+
+import (
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/actions"
+	actionsInterfaces "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/metrics"
+)
+
+// ActionWrapper allows to decorate every action of a chain, e.g. to record which actions were applied
+type ActionWrapper func(chainName string, action actionsInterfaces.Action) actionsInterfaces.Action
+
+// RuleWrapper allows to decorate every filtering rule of a chain
+type RuleWrapper func(chainName string, rule interfaces.FilteringRule) interfaces.FilteringRule
+
+// Builder creates stateful filters (chains) with their filtering rules and actions from configuration
+type Builder struct {
+	Logger *zap.Logger
+	BanDB  bannedDB.BanDB
+	Bot    botAPI.BotAPI
+	Deps   interfaces.Deps
+
+	WrapAction ActionWrapper
+	WrapRule   RuleWrapper
+}
+
+// Build creates all chains in order they are specified. If any of them fails, already created ones are closed.
+func (b *Builder) Build(cfgs []config.StatefulFilterConfig) ([]interfaces.StatefulFilter, error) {
+	res := make([]interfaces.StatefulFilter, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		f, err := b.BuildChain(cfg)
+		if err != nil {
+			Close(b.Logger, res)
+			return nil, err
+		}
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+// BuildChain creates single stateful filter with its filtering rules and actions
+func (b *Builder) BuildChain(cfg config.StatefulFilterConfig) (interfaces.StatefulFilter, error) {
+	sfLogger := b.Logger.With(zap.String("filter", cfg.Name))
+	f, err := filters.GetStatefulFilter(cfg.Name)
+	if err != nil {
+		sfLogger.Error("error creating stateful filter", zap.String("name", cfg.Name), zap.Error(err))
+		return nil, err
+	}
+
+	ruleTypes := make([]string, 0, len(cfg.StatelessFilters))
+	for _, rule := range cfg.StatelessFilters {
+		ruleTypes = append(ruleTypes, rule.Name)
+	}
+	ruleNames := interfaces.RuleNames(cfg.FilterName, ruleTypes)
+	filteringRules := make([]interfaces.FilteringRule, 0, len(cfg.StatelessFilters))
+	for i, rule := range cfg.StatelessFilters {
+		r, err := filters.NewFilteringRule(sfLogger, b.Deps, ruleNames[i], rule)
+		if err != nil {
+			_ = interfaces.CloseRules(filteringRules)
+			return nil, err
+		}
+		if b.WrapRule != nil {
+			r = b.WrapRule(cfg.FilterName, r)
+		}
+		filteringRules = append(filteringRules, r)
+	}
+
+	actionsObjs := make([]actionsInterfaces.Action, 0, len(cfg.Actions))
+	for _, action := range cfg.Actions {
+		actionInit, err := actions.GetAction(action.Name)
+		if err != nil {
+			sfLogger.Error("error creating action", zap.Error(err))
+			_ = interfaces.CloseRules(filteringRules)
+			return nil, err
+		}
+
+		actionObj, err := actionInit(sfLogger, b.Deps, b.BanDB, b.Bot, action.Arguments)
+		if err != nil {
+			sfLogger.Error("error initializing action", zap.Error(err))
+			_ = interfaces.CloseRules(filteringRules)
+			return nil, err
+		}
+
+		if b.WrapAction != nil {
+			actionObj = b.WrapAction(cfg.FilterName, actionObj)
+		}
+		actionsObjs = append(actionsObjs, actionObj)
+	}
+
+	statefulFilter, err := f(b.Logger, b.Deps, cfg.FilterName, b.BanDB, b.Bot, cfg.Arguments, filteringRules, actionsObjs)
+	if err != nil {
+		sfLogger.Error("error initializing stateful filter", zap.Error(err))
+		_ = interfaces.CloseRules(filteringRules)
+		return nil, err
+	}
+	return statefulFilter, nil
+}
+
+// Close closes all chains, logging errors if any
+func Close(logger *zap.Logger, chains []interfaces.StatefulFilter) {
+	for _, f := range chains {
+		err := f.Close()
+		if err != nil {
+			logger.Error("failed to close stateful filter", zap.String("filter", f.GetFilterName()), zap.Error(err))
+		}
+	}
+}
+
+// Result is a score that a single chain gave to the message
+type Result struct {
+	Chain interfaces.StatefulFilter
+	Score *scoringResult.ScoringResult
+}
+
+// Apply runs message through chains in order, stopping after the first final chain which score reached its threshold
+func Apply(bot botAPI.BotAPI, chains []interfaces.StatefulFilter, message *telego.Message) []Result {
+	res := make([]Result, 0, len(chains))
+	for _, f := range chains {
+		start := time.Now()
+		score := f.Score(bot, message)
+		metrics.ScoringDuration.WithLabelValues(f.GetFilterName()).Observe(time.Since(start).Seconds())
+		res = append(res, Result{Chain: f, Score: score})
+		if score.Score >= f.GetThreshold() && f.IsFinal() {
+			break
+		}
+	}
+	return res
+}
@@ -0,0 +1,233 @@
+package chains
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+)
+
+// Manager owns chains that are currently in use and replaces them when configuration is reloaded.
+//
+// Messages and admin commands are processed under read lock, so chains are never closed while they are in use.
+type Manager struct {
+	logger  *zap.Logger
+	builder *Builder
+
+	mu       sync.RWMutex
+	cfg      *config.Config
+	registry *Registry
+}
+
+// NewManager builds chains from configuration and registers them in BanDB
+func (b *Builder) NewManager(cfg *config.Config) (*Manager, error) {
+	registry, err := b.BuildRegistry(cfg)
+	if err != nil {
+		return nil, err
+	}
+	b.BanDB.SetStatefulFilters(registry.All)
+
+	return &Manager{
+		logger:   b.Logger.With(zap.String("component", "chains")),
+		builder:  b,
+		cfg:      cfg,
+		registry: registry,
+	}, nil
+}
+
+// Apply runs message through chains of its chat
+func (m *Manager) Apply(bot botAPI.BotAPI, message *telego.Message) []Result {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return Apply(bot, m.registry.ForChat(message.Chat.ID), message)
+}
+
+// All returns all chains that are currently in use
+func (m *Manager) All() []interfaces.StatefulFilter {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.registry.All
+}
+
+// AdminPrefixes returns admin command prefixes of all chains
+func (m *Manager) AdminPrefixes() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]string, 0, len(m.registry.All))
+	for _, f := range m.registry.All {
+		if prefix := f.TGAdminPrefix(); prefix != "" {
+			res = append(res, prefix)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ChainInfo describes chain that is currently in use
+type ChainInfo struct {
+	Name        string  `json:"name"`
+	Type        string  `json:"type"`
+	AdminPrefix string  `json:"admin_prefix,omitempty"`
+	Default     bool    `json:"default"`
+	Chats       []int64 `json:"chats,omitempty"`
+}
+
+// Describe returns chains in order they are specified in configuration, with chats where they are applied
+func (m *Manager) Describe() []ChainInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := make([]ChainInfo, 0, len(m.registry.All))
+	for _, f := range m.registry.All {
+		info := ChainInfo{
+			Name:        f.GetFilterName(),
+			Type:        f.GetName(),
+			AdminPrefix: f.TGAdminPrefix(),
+			Default:     slices.Contains(m.registry.Default, f),
+		}
+		for chatID, chains := range m.registry.PerChat {
+			if slices.Contains(chains, f) {
+				info.Chats = append(info.Chats, chatID)
+			}
+		}
+		slices.Sort(info.Chats)
+		res = append(res, info)
+	}
+	return res
+}
+
+// HandleTGCommands passes admin command to the chain with the prefix. Returns false if there is no such chain.
+func (m *Manager) HandleTGCommands(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, prefix string, tokens []string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, f := range m.registry.All {
+		if f.TGAdminPrefix() == prefix {
+			return true, f.HandleTGCommands(logger, bot, message, tokens)
+		}
+	}
+	return false, nil
+}
+
+// MarkVerified makes all chains treat the user as verified
+func (m *Manager) MarkVerified(userID int64) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var errs []error
+	for _, f := range m.registry.All {
+		err := f.UnbanUser(userID)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func chainConfigs(cfg *config.Config) map[string]config.StatefulFilterConfig {
+	res := make(map[string]config.StatefulFilterConfig)
+	for _, f := range cfg.StatefulFilters {
+		res[f.FilterName] = f
+	}
+	for _, chat := range cfg.Chats {
+		for _, f := range chat.StatefulFilters {
+			res[f.FilterName] = f
+		}
+	}
+	return res
+}
+
+// Reload replaces chains with the ones from the new configuration. Chains with unchanged configuration are kept
+// as is, together with their state. Changed and removed chains are closed before new ones are created, so new chains
+// load the state that replaced ones have saved; their databases are handed off without reopening (see
+// badgerOpts.StartHandoff). Messages are not processed during reload. If new chains can't be created, replaced ones
+// are created again from the current configuration.
+func (m *Manager) Reload(cfg *config.Config) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldCfgs := chainConfigs(m.cfg)
+	newCfgs := chainConfigs(cfg)
+	unchanged := make(map[string]interfaces.StatefulFilter)
+	toClose := make([]interfaces.StatefulFilter, 0)
+	for name, f := range m.registry.byName {
+		if newCfg, ok := newCfgs[name]; ok && reflect.DeepEqual(newCfg, oldCfgs[name]) {
+			unchanged[name] = f
+			continue
+		}
+		toClose = append(toClose, f)
+	}
+
+	badgerOpts.StartHandoff()
+	defer func() {
+		err := badgerOpts.FinishHandoff()
+		if err != nil {
+			m.logger.Error("failed to close databases of replaced chains", zap.Error(err))
+		}
+	}()
+
+	for _, f := range toClose {
+		m.logger.Info("chain was changed or removed, closing it", zap.String("chain", f.GetFilterName()))
+	}
+	Close(m.logger, toClose)
+
+	registry, err := m.builder.buildRegistry(cfg, unchanged)
+	if err != nil {
+		m.logger.Error("failed to create new chains, restoring current ones", zap.Error(err))
+		registry, restoreErr := m.builder.buildRegistry(m.cfg, unchanged)
+		if restoreErr != nil {
+			m.logger.Error("failed to restore current chains", zap.Error(restoreErr))
+			return errors.Join(err, restoreErr)
+		}
+		m.registry = registry
+		m.builder.BanDB.SetStatefulFilters(m.registry.All)
+		return err
+	}
+
+	m.cfg = cfg
+	m.registry = registry
+	m.builder.BanDB.SetStatefulFilters(m.registry.All)
+
+	m.logger.Info("chains reloaded",
+		zap.Int("chains", len(registry.All)),
+		zap.Int("unchanged", len(unchanged)),
+	)
+	return nil
+}
+
+// Close closes all chains that are currently in use
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.registry.Close(m.logger)
+}
+
+// HandleCallbackQuery passes callback query to the chain that owns the prefix. Returns false if there is no such
+// chain.
+func (m *Manager) HandleCallbackQuery(logger *zap.Logger, bot botAPI.BotAPI, query *telego.CallbackQuery, prefix string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, f := range m.registry.All {
+		if h, ok := f.(interfaces.CallbackHandler); ok && h.CallbackPrefix() == prefix {
+			return true, h.HandleCallbackQuery(logger, bot, query)
+		}
+	}
+	return false, nil
+}
+
+// HandleNewMember notifies chains of the chat that the user joined it
+func (m *Manager) HandleNewMember(logger *zap.Logger, bot botAPI.BotAPI, chat telego.Chat, user telego.User) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, f := range m.registry.ForChat(chat.ID) {
+		if h, ok := f.(interfaces.MemberJoinHandler); ok {
+			h.HandleNewMember(logger, bot, chat, user)
+		}
+	}
+}
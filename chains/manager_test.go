@@ -0,0 +1,186 @@
+package chains
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+)
+
+const testChatID = -100
+
+func newTestManager(t *testing.T, cfg *config.Config) (*Manager, *fakeBot.Bot) {
+	t.Helper()
+	logger := zap.NewNop()
+	banDB, err := bannedDB.New(logger, map[string]any{"state_dir": t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = banDB.Close() })
+
+	bot := fakeBot.New()
+	builder := &Builder{Logger: logger, BanDB: banDB, Bot: bot}
+	m, err := builder.NewManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, bot
+}
+
+func spamConfig(stateDir, match string) *config.Config {
+	return &config.Config{
+		StatefulFilters: []config.StatefulFilterConfig{
+			{
+				Name:       "checkNevents",
+				FilterName: "spam_filter",
+				Arguments:  map[string]any{"n": 3, "state_dir": stateDir},
+				StatelessFilters: []config.StatelessFilteringRules{
+					{Name: "partialMatch", Arguments: map[string]any{"match": match}},
+				},
+			},
+		},
+	}
+}
+
+func message(id int, userID int64, text string) *telego.Message {
+	return &telego.Message{
+		MessageID: id,
+		From:      &telego.User{ID: userID, FirstName: "user"},
+		Chat:      telego.Chat{ID: testChatID, Type: telego.ChatTypeSupergroup},
+		Date:      time.Now().Unix(),
+		Text:      text,
+	}
+}
+
+func score(m *Manager, bot *fakeBot.Bot, msg *telego.Message) int32 {
+	var res int32
+	for _, r := range m.Apply(bot, msg) {
+		res = max(res, r.Score.Score)
+	}
+	return res
+}
+
+func TestReloadChangedChainWithSameStateDir(t *testing.T) {
+	stateDir := t.TempDir()
+	m, bot := newTestManager(t, spamConfig(stateDir, "buy crypto"))
+	old := m.All()[0]
+
+	err := m.Reload(spamConfig(stateDir, "free money"))
+	if err != nil {
+		t.Fatalf("failed to reload chain that uses the same state_dir: %v", err)
+	}
+	if m.All()[0] == old {
+		t.Fatalf("changed chain was not replaced")
+	}
+	if got := score(m, bot, message(1, 1000, "free money")); got <= 0 {
+		t.Errorf("new chain doesn't match, score %v", got)
+	}
+	if got := score(m, bot, message(2, 1001, "buy crypto")); got > 0 {
+		t.Errorf("old rule still matches, score %v", got)
+	}
+
+	// Every user of the database is closed, so it can be opened again
+	m.Close()
+	m, _ = newTestManager(t, spamConfig(stateDir, "free money"))
+	m.Close()
+}
+
+func TestReloadKeepsUnchangedChain(t *testing.T) {
+	cfg := spamConfig(t.TempDir(), "buy crypto")
+	m, _ := newTestManager(t, cfg)
+	t.Cleanup(m.Close)
+	old := m.All()[0]
+
+	err := m.Reload(spamConfig(cfg.StatefulFilters[0].Arguments["state_dir"].(string), "buy crypto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.All()[0] != old {
+		t.Errorf("unchanged chain was recreated")
+	}
+}
+
+func TestFailedReloadKeepsCurrentChains(t *testing.T) {
+	stateDir := t.TempDir()
+	m, bot := newTestManager(t, spamConfig(stateDir, "buy crypto"))
+	t.Cleanup(m.Close)
+
+	cfg := spamConfig(stateDir, "free money")
+	cfg.StatefulFilters = append(cfg.StatefulFilters, config.StatefulFilterConfig{
+		Name:       "checkNevents",
+		FilterName: "broken",
+		Arguments:  map[string]any{"n": 3, "state_dir": t.TempDir()},
+		StatelessFilters: []config.StatelessFilteringRules{
+			{Name: "unknown"},
+		},
+	})
+	err := m.Reload(cfg)
+	if err == nil {
+		t.Fatal("reload with unknown rule succeeded")
+	}
+
+	if all := m.All(); len(all) != 1 || all[0].GetFilterName() != "spam_filter" {
+		t.Fatalf("current chains were not restored: %v", all)
+	}
+	if got := score(m, bot, message(1, 1000, "buy crypto")); got <= 0 {
+		t.Errorf("current chain stopped working, score %v", got)
+	}
+}
+
+func TestSameStateDirIsRejected(t *testing.T) {
+	stateDir := t.TempDir()
+	cfg := spamConfig(stateDir, "buy crypto")
+	other := cfg.StatefulFilters[0]
+	other.FilterName = "other"
+	cfg.StatefulFilters = append(cfg.StatefulFilters, other)
+
+	logger := zap.NewNop()
+	banDB, err := bannedDB.New(logger, map[string]any{"state_dir": t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = banDB.Close() })
+	builder := &Builder{Logger: logger, BanDB: banDB, Bot: fakeBot.New()}
+	_, err = builder.NewManager(cfg)
+	if !errors.Is(err, badgerOpts.ErrDirInUse) {
+		t.Fatalf("got error %v, want %v", err, badgerOpts.ErrDirInUse)
+	}
+
+	// Reload can't add chain that uses state of another one either
+	m, _ := newTestManager(t, spamConfig(stateDir, "buy crypto"))
+	t.Cleanup(m.Close)
+	err = m.Reload(cfg)
+	if !errors.Is(err, badgerOpts.ErrDirInUse) {
+		t.Fatalf("got error %v, want %v", err, badgerOpts.ErrDirInUse)
+	}
+}
+
+func TestReloadedChainGetsStateOfReplacedOne(t *testing.T) {
+	stateDir := t.TempDir()
+	m, _ := newTestManager(t, spamConfig(stateDir, "buy crypto"))
+	t.Cleanup(m.Close)
+
+	err := m.MarkVerified(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = m.Reload(spamConfig(stateDir, "free money"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := m.All()[0].(interfaces.Verifier).IsVerified(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Errorf("state of replaced chain was lost")
+	}
+}
@@ -0,0 +1,65 @@
+package chains
+
+import (
+	"github.com/mymmrac/telego"
+
+	actionsInterfaces "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/scoring"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/metrics"
+)
+
+// InstrumentAction is an ActionWrapper that counts applied and failed actions
+func InstrumentAction(chainName string, action actionsInterfaces.Action) actionsInterfaces.Action {
+	return &instrumentedAction{Action: action, chainName: chainName}
+}
+
+type instrumentedAction struct {
+	actionsInterfaces.Action
+	chainName string
+}
+
+func (a *instrumentedAction) count(err error) error {
+	status := "applied"
+	if err != nil {
+		status = "failed"
+	}
+	metrics.Actions.WithLabelValues(a.chainName, a.GetName(), status).Inc()
+	return err
+}
+
+func (a *instrumentedAction) Apply(callbackStatefulFilter interfaces.StatefulFilter, score *scoringResult.ScoringResult, chatID telego.ChatID, messageIDs []int64, userID int64) error {
+	return a.count(a.Action.Apply(callbackStatefulFilter, score, chatID, messageIDs, userID))
+}
+
+func (a *instrumentedAction) ApplyToMessage(callbackStatefulFilter interfaces.StatefulFilter, score *scoringResult.ScoringResult, message *telego.Message) error {
+	return a.count(a.Action.ApplyToMessage(callbackStatefulFilter, score, message))
+}
+
+// InstrumentRule is a RuleWrapper that counts messages that got positive score from the rule
+func InstrumentRule(chainName string, rule interfaces.FilteringRule) interfaces.FilteringRule {
+	return &instrumentedRule{FilteringRule: rule, chainName: chainName}
+}
+
+type instrumentedRule struct {
+	interfaces.FilteringRule
+	chainName string
+}
+
+func (r *instrumentedRule) Score(bot botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	res := r.FilteringRule.Score(bot, msg)
+	if res.Score > 0 {
+		metrics.RuleHits.WithLabelValues(r.chainName, r.DisplayName()).Inc()
+	}
+	return res
+}
+
+func (r *instrumentedRule) DisplayName() string {
+	return scoring.DisplayName(r.FilteringRule)
+}
+
+func (r *instrumentedRule) Close() error {
+	return interfaces.CloseRules([]interfaces.FilteringRule{r.FilteringRule})
+}
@@ -0,0 +1,89 @@
+package chains
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+)
+
+// Registry keeps chains that should be applied to messages of every chat
+type Registry struct {
+	// Default chains are used for chats that don't have own configuration
+	Default []interfaces.StatefulFilter
+	PerChat map[int64][]interfaces.StatefulFilter
+	// All contains every chain once, in order they are specified in configuration
+	All []interfaces.StatefulFilter
+
+	byName map[string]interfaces.StatefulFilter
+}
+
+// ForChat returns chains that should be applied to messages in the chat
+func (r *Registry) ForChat(chatID int64) []interfaces.StatefulFilter {
+	if chains, ok := r.PerChat[chatID]; ok {
+		return chains
+	}
+	return r.Default
+}
+
+// Close closes every chain of the registry
+func (r *Registry) Close(logger *zap.Logger) {
+	Close(logger, r.All)
+}
+
+// BuildRegistry creates global chains and chains of every chat. If any of them fails, already created ones are
+// closed.
+func (b *Builder) BuildRegistry(cfg *config.Config) (*Registry, error) {
+	return b.buildRegistry(cfg, nil)
+}
+
+// buildRegistry creates registry, taking chains from existing (by name) instead of building them if possible.
+// If any of the chains fails, chains that were created by this call are closed, existing ones are kept open.
+func (b *Builder) buildRegistry(cfg *config.Config, existing map[string]interfaces.StatefulFilter) (*Registry, error) {
+	r := &Registry{
+		PerChat: make(map[int64][]interfaces.StatefulFilter),
+		byName:  make(map[string]interfaces.StatefulFilter),
+	}
+	created := make([]interfaces.StatefulFilter, 0)
+	get := func(chainCfg config.StatefulFilterConfig) (interfaces.StatefulFilter, error) {
+		if f, ok := existing[chainCfg.FilterName]; ok {
+			return f, nil
+		}
+		f, err := b.BuildChain(chainCfg)
+		if err != nil {
+			Close(b.Logger, created)
+			return nil, err
+		}
+		created = append(created, f)
+		return f, nil
+	}
+
+	for _, chainCfg := range cfg.StatefulFilters {
+		f, err := get(chainCfg)
+		if err != nil {
+			return nil, err
+		}
+		r.byName[chainCfg.FilterName] = f
+		r.Default = append(r.Default, f)
+		r.All = append(r.All, f)
+	}
+
+	for _, chat := range cfg.Chats {
+		chatChains := make([]interfaces.StatefulFilter, 0, len(chat.Chains)+len(chat.StatefulFilters))
+		for _, name := range chat.Chains {
+			chatChains = append(chatChains, r.byName[name])
+		}
+
+		for _, chainCfg := range chat.StatefulFilters {
+			f, err := get(chainCfg)
+			if err != nil {
+				return nil, err
+			}
+			chatChains = append(chatChains, f)
+			r.byName[chainCfg.FilterName] = f
+			r.All = append(r.All, f)
+		}
+		r.PerChat[chat.ChatID] = chatChains
+	}
+	return r, nil
+}
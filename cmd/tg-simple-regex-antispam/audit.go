@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/Civil/tg-simple-regex-antispam/audit"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
+)
+
+func auditExport(logger *zap.Logger, c *cli.Context) error {
+	cfg, err := config.Load(c.String("config"))
+	if err != nil {
+		logger.Error("failed to load configuration", zap.Error(err))
+		return err
+	}
+
+	q := audit.Query{
+		UserID: c.Int64("user"),
+		Chain:  c.String("chain"),
+	}
+	q.Since, err = parseTimeFlag(c, "since")
+	if err != nil {
+		return err
+	}
+	q.Until, err = parseTimeFlag(c, "until")
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if c.String("output") != "" && c.String("output") != "-" {
+		f, err := os.Create(c.String("output"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer func() { _ = w.Flush() }()
+
+	var write func(e *auditEvent.AuditEvent) error
+	switch c.String("format") {
+	case "jsonl":
+		write = func(e *auditEvent.AuditEvent) error {
+			b, err := protojson.Marshal(e)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(append(b, '\n'))
+			return err
+		}
+	case "proto":
+		write = func(e *auditEvent.AuditEvent) error {
+			_, err := protodelim.MarshalTo(w, e)
+			return err
+		}
+	default:
+		return ErrUnknownOutputFormat
+	}
+
+	// Export can be written to stdout, logs would only clutter it
+	log, err := audit.OpenReadOnly(logger.WithOptions(zap.IncreaseLevel(zap.ErrorLevel)), cfg.Audit)
+	if err != nil {
+		logger.Error("failed to open audit log, it cannot be exported while bot is running", zap.Error(err))
+		return err
+	}
+	defer func() { _ = log.Close() }()
+
+	return log.ForEach(q, write)
+}
+
+func auditCommand(logger *zap.Logger) *cli.Command {
+	return &cli.Command{
+		Name:  "audit",
+		Usage: "Work with moderation audit log",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "export",
+				Usage: "Export moderation events in chronological order",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "config",
+						Value: configFile,
+						Usage: "configuration file",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "output file, stdout if not set",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "jsonl",
+						Usage: "output format: `jsonl` (one event per line) or `proto` (length-delimited auditEvent.proto)",
+					},
+					&cli.Int64Flag{
+						Name:  "user",
+						Usage: "export only events that affected that user",
+					},
+					&cli.StringFlag{
+						Name:  "chain",
+						Usage: "export only events caused by that chain",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "export only events that happened after that time (RFC3339 or duration relative to now, e.g. 168h)",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "export only events that happened before that time (RFC3339 or duration relative to now)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return auditExport(logger, c)
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"github.com/Civil/tg-simple-regex-antispam/capture"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/message"
+)
+
+var ErrUnknownOutputFormat = errors.New("unknown output format, supported formats are `jsonl` and `proto`")
+
+func parseTimeFlag(c *cli.Context, name string) (time.Time, error) {
+	v := c.String(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func captureExport(logger *zap.Logger, c *cli.Context) error {
+	cfg, err := config.Load(c.String("config"))
+	if err != nil {
+		logger.Error("failed to load configuration", zap.Error(err))
+		return err
+	}
+
+	q := capture.Query{
+		ChatID: c.Int64("chat"),
+		UserID: c.Int64("user"),
+	}
+	q.Since, err = parseTimeFlag(c, "since")
+	if err != nil {
+		return err
+	}
+	q.Until, err = parseTimeFlag(c, "until")
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if c.String("output") != "" && c.String("output") != "-" {
+		f, err := os.Create(c.String("output"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer func() { _ = w.Flush() }()
+
+	var write func(m *message.Message) error
+	switch c.String("format") {
+	case "jsonl":
+		// Messages are written in Bot API format, so they can be fed back to `replay`
+		encoder := json.NewEncoder(w)
+		write = func(m *message.Message) error {
+			return encoder.Encode(m.ToTelego())
+		}
+	case "proto":
+		write = func(m *message.Message) error {
+			_, err := protodelim.MarshalTo(w, m)
+			return err
+		}
+	default:
+		return ErrUnknownOutputFormat
+	}
+
+	// Export can be written to stdout, logs would only clutter it
+	store, err := capture.OpenReadOnly(logger.WithOptions(zap.IncreaseLevel(zap.ErrorLevel)), cfg.Capture)
+	if err != nil {
+		logger.Error("failed to open capture store, it cannot be exported while bot is running", zap.Error(err))
+		return err
+	}
+	defer func() { _ = store.Close() }()
+
+	return store.ForEach(q, write)
+}
+
+func captureCommand(logger *zap.Logger) *cli.Command {
+	return &cli.Command{
+		Name:  "capture",
+		Usage: "Work with captured messages",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "export",
+				Usage: "Export captured messages",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "config",
+						Value: configFile,
+						Usage: "configuration file",
+					},
+					&cli.StringFlag{
+						Name:  "output",
+						Usage: "output file, stdout if not set",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Value: "jsonl",
+						Usage: "output format: `jsonl` (telegram messages, one per line) or `proto` (length-delimited message.proto)",
+					},
+					&cli.Int64Flag{
+						Name:  "chat",
+						Usage: "export only messages from that chat",
+					},
+					&cli.Int64Flag{
+						Name:  "user",
+						Usage: "export only messages from that user",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "export only messages sent after that time (RFC3339 or duration relative to now, e.g. 168h)",
+					},
+					&cli.StringFlag{
+						Name:  "until",
+						Usage: "export only messages sent before that time (RFC3339 or duration relative to now)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return captureExport(logger, c)
+				},
+			},
+		},
+	}
+}
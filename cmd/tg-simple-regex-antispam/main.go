@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
@@ -10,15 +12,22 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"github.com/Civil/tg-simple-regex-antispam/actions"
-	actionsInterfaces "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/adminAPI"
+	"github.com/Civil/tg-simple-regex-antispam/audit"
 	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/capture"
+	"github.com/Civil/tg-simple-regex-antispam/chains"
 	"github.com/Civil/tg-simple-regex-antispam/config"
 	"github.com/Civil/tg-simple-regex-antispam/filters"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
 	"github.com/Civil/tg-simple-regex-antispam/helper/logs"
+	"github.com/Civil/tg-simple-regex-antispam/helper/metrics"
 	"github.com/Civil/tg-simple-regex-antispam/tg"
 )
 
+const configFile = "config.yaml"
+
 func main() {
 	atom := zap.NewAtomicLevel()
 	encoderCfg := zap.NewProductionEncoderConfig()
@@ -46,7 +55,7 @@ func main() {
 				Name:  "start",
 				Usage: "Start the bot",
 				Action: func(c *cli.Context) error {
-					cfg, err := config.Load("config.yaml")
+					cfg, err := config.Load(configFile)
 					if err != nil {
 						logger.Error("failed to load configuration", zap.Error(err))
 						return err
@@ -66,71 +75,98 @@ func main() {
 						}
 					}(logger)
 
-					statefulFilters := make([]interfaces.StatefulFilter, 0)
-					statelessFilters := filters.GetFilteringRules()
+					var auditLog *audit.Log
+					if cfg.Audit.Enabled {
+						auditLog, err = audit.New(logger, cfg.Audit)
+						if err != nil {
+							logs.ErrNST(logger, "failed initializing audit log", err)
+							return err
+						}
+						banDB.SetAuditLog(auditLog)
+						// banDB outlives the log, it must stop recording before the log is closed
+						defer func() {
+							banDB.SetAuditLog(nil)
+							_ = auditLog.Close()
+						}()
+					}
 
-					tbot, err := tg.New(logger, cfg.TelegramToken, &statefulFilters, cfg.AdminIDs, cfg.AllowedChatIDs, cfg.AdminUsernames, banDB)
+					tbot, err := tg.New(logger, cfg.TelegramToken, cfg.AdminIDs, cfg.AllowedChatIDs, cfg.AdminUsernames, banDB, cfg.Webhook, cfg.Pipeline)
 					if err != nil {
 						logger.Error("error creating bot", zap.Error(err))
 						return err
 					}
 					defer tbot.Stop()
+					banDB.SetBot(tbot.GetBot(), cfg.AllowedChatIDs)
+					hub := events.NewHub()
+					banDB.SetEvents(hub)
+					tbot.SetEvents(hub)
+					banDB.Start()
+					err = banDB.StartFeed()
+					if err != nil {
+						logs.ErrNST(logger, "failed starting ban feed", err)
+						return err
+					}
+
+					if auditLog != nil {
+						tbot.SetAuditLog(auditLog)
+					}
 
-					for _, filter := range cfg.StatefulFilters {
-						sfLogger := logger.With(zap.String("filter", filter.Name))
-						f, err := filters.GetStatefulFilter(filter.Name)
+					if cfg.Capture.Enabled {
+						captureStore, err := capture.New(logger, cfg.Capture)
 						if err != nil {
-							sfLogger.Error("error creating stateful filter", zap.String("name", filter.Name), zap.Error(err))
+							logs.ErrNST(logger, "failed initializing capture store", err)
 							return err
 						}
+						defer func() { _ = captureStore.Close() }()
+						tbot.SetMessageRecorder(captureStore)
+					}
 
-						filteringRules := make([]interfaces.FilteringRule, 0)
-						for _, rule := range filter.StatelessFilters {
-							fInit, ok := statelessFilters[rule.Name]
-							if !ok {
-								sfLogger.Error("unsupported filtering rule", zap.String("rule", rule.Name), zap.Error(err))
-								return err
-							}
-
-							f, err := fInit(sfLogger, rule.Arguments, rule.Name)
-							if err != nil {
-								sfLogger.Error("error initializing filtering rule", zap.Error(err))
-								return err
-							}
+					builder := &chains.Builder{
+						Logger:     logger,
+						BanDB:      banDB,
+						Bot:        tbot.GetBot(),
+						Deps:       interfaces.Deps{Audit: auditLog, Events: hub},
+						WrapAction: chains.InstrumentAction,
+						WrapRule:   chains.InstrumentRule,
+					}
+					chainManager, err := builder.NewManager(cfg)
+					if err != nil {
+						return err
+					}
+					defer chainManager.Close()
 
-							filteringRules = append(filteringRules, f)
+					tbot.SetChains(chainManager)
+					reload := func() error {
+						newCfg, err := config.Load(configFile)
+						if err != nil {
+							return err
 						}
-
-						actionsObjs := make([]actionsInterfaces.Action, 0)
-						for _, action := range filter.Actions {
-							actionInit, err := actions.GetAction(action.Name)
-							if err != nil {
-								logger.Error("error creating action", zap.Error(err))
-								return err
-							}
-
-							actionObj, err := actionInit(sfLogger, tbot.GetBot(), action.Arguments)
-							if err != nil {
-								logger.Error("error initializing action", zap.Error(err))
-								return err
-							}
-
-							actionsObjs = append(actionsObjs, actionObj)
-
+						if !cfg.OnlyChainsDiffer(newCfg) {
+							logger.Warn("configuration changes outside of stateful_filters and chats require restart")
 						}
+						return chainManager.Reload(newCfg)
+					}
+					tbot.SetReloadFunc(reload)
 
-						statefulFilter, err := f(logger, filter.FilterName, banDB, tbot.GetBot(), filter.Arguments, filteringRules, actionsObjs)
+					if cfg.Metrics.Enabled {
+						metricsServer := metrics.NewServer(logger, cfg.Metrics.ListenAddress, cfg.Metrics.Path)
+						err = metricsServer.Start()
 						if err != nil {
-							logger.Error("error initializing stateful filter", zap.Error(err))
+							logs.ErrNST(logger, "failed starting metrics server", err)
 							return err
 						}
-						defer func() { _ = statefulFilter.Close() }()
-						statefulFilters = append(statefulFilters, statefulFilter)
+						defer metricsServer.Stop()
 					}
 
-					banDB.SetStatefulFilters(statefulFilters)
-
-					tbot.UpdatePrefixes()
+					if cfg.AdminAPI.Enabled {
+						api := adminAPI.New(logger, cfg.AdminAPI, tbot, tbot.GetBot(), banDB, chainManager)
+						err = api.Start()
+						if err != nil {
+							logs.ErrNST(logger, "failed starting admin api", err)
+							return err
+						}
+						defer api.Stop()
+					}
 
 					logger.Info("starting bot",
 						zap.Int64s("allowed_chat_ids", cfg.AllowedChatIDs),
@@ -139,8 +175,36 @@ func main() {
 						zap.Any("banned_db_config", cfg.BannedDBConfig),
 						zap.String("log_level", cfg.LogLevel.String()),
 						zap.Any("stateful_filters", cfg.StatefulFilters),
+						zap.Any("chats", cfg.Chats),
+						zap.Bool("webhook", cfg.Webhook.Enabled),
+						zap.Any("pipeline", cfg.Pipeline),
+						zap.Any("capture", cfg.Capture),
+						zap.Any("audit", cfg.Audit),
+						zap.Bool("admin_api", cfg.AdminAPI.Enabled),
+						zap.Bool("metrics", cfg.Metrics.Enabled),
 					)
 
+					ctx, stop := signal.NotifyContext(c.Context, syscall.SIGINT, syscall.SIGTERM)
+					defer stop()
+					go func() {
+						<-ctx.Done()
+						logger.Info("shutting down, waiting for pending updates to be processed")
+						tbot.Stop()
+					}()
+
+					hup := make(chan os.Signal, 1)
+					signal.Notify(hup, syscall.SIGHUP)
+					defer signal.Stop(hup)
+					go func() {
+						for range hup {
+							logger.Info("got SIGHUP, reloading configuration")
+							err := reload()
+							if err != nil {
+								logger.Error("failed to reload configuration, previous one is still in use", zap.Error(err))
+							}
+						}
+					}()
+
 					tbot.Start()
 
 					err = banDB.SaveState()
@@ -148,7 +212,7 @@ func main() {
 						logger.Error("error saving banDB state", zap.Error(err))
 					}
 
-					for _, statefulFilter := range statefulFilters {
+					for _, statefulFilter := range chainManager.All() {
 						err = statefulFilter.SaveState()
 						if err != nil {
 							logger.Error("error saving stateful filter state", zap.Error(err))
@@ -157,6 +221,11 @@ func main() {
 					return nil
 				},
 			},
+			replayCommand(logger),
+			captureCommand(logger),
+			auditCommand(logger),
+			exportCommand(logger),
+			importCommand(logger),
 			{
 				Name:  "rules",
 				Usage: "List available stateless filtering rules",
@@ -194,7 +263,7 @@ func main() {
 				Name:  "config",
 				Usage: "Prints current configuration, as parsed from config.yaml",
 				Action: func(c *cli.Context) error {
-					cfg, err := config.Load("config.yaml")
+					cfg, err := config.Load(configFile)
 					if err != nil {
 						cfg = config.DefaultConfig()
 					}
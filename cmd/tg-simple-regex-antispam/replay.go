@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mymmrac/telego"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	actionsInterfaces "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/chains"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/message"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+)
+
+var ErrUnknownInputFormat = errors.New("unknown input format, supported formats are `jsonl` and `proto`")
+
+// firedAction is an action that chain applied (or tried to apply) to the message
+type firedAction struct {
+	chain  string
+	action string
+	err    error
+}
+
+type actionRecorder struct {
+	sync.Mutex
+	fired []firedAction
+}
+
+func (r *actionRecorder) add(chain, action string, err error) {
+	r.Lock()
+	defer r.Unlock()
+	r.fired = append(r.fired, firedAction{chain: chain, action: action, err: err})
+}
+
+func (r *actionRecorder) reset() []firedAction {
+	r.Lock()
+	defer r.Unlock()
+	res := r.fired
+	r.fired = nil
+	return res
+}
+
+// recordedAction passes calls to the original action (which talks to the fake bot) and records them
+type recordedAction struct {
+	actionsInterfaces.Action
+	chain    string
+	recorder *actionRecorder
+}
+
+func (r *recordedAction) Apply(callback interfaces.StatefulFilter, score *scoringResult.ScoringResult, chatID telego.ChatID, messageIDs []int64, userID int64) error {
+	err := r.Action.Apply(callback, score, chatID, messageIDs, userID)
+	r.recorder.add(r.chain, r.GetName(), err)
+	return err
+}
+
+func (r *recordedAction) ApplyToMessage(callback interfaces.StatefulFilter, score *scoringResult.ScoringResult, msg *telego.Message) error {
+	err := r.Action.ApplyToMessage(callback, score, msg)
+	r.recorder.add(r.chain, r.GetName(), err)
+	return err
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o750)
+		}
+		// Lock is held by the running bot, copy must not inherit it
+		if d.Name() == "LOCK" {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0o600)
+	})
+}
+
+// isolateRuleConfig copies configuration directory of the rule (and of its nested rules, if any) to dir
+func isolateRuleConfig(args map[string]any, dir string) error {
+	if configDir, ok := args["config_dir"].(string); ok && configDir != "" {
+		err := copyDir(configDir, dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("copying %v: %w", configDir, err)
+		}
+		args["config_dir"] = dir
+	}
+	nested, _ := args["rules"].([]any)
+	for i, r := range nested {
+		rule, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		nestedArgs, ok := rule["arguments"].(map[string]any)
+		if !ok {
+			continue
+		}
+		err := isolateRuleConfig(nestedArgs, filepath.Join(dir, fmt.Sprintf("%v_%v", i, rule["name"])))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isolateState points all state directories to stateDir, so replay never touches state of the running bot.
+// Directories with configuration (e.g. regex lists) are copied, as replay must use the same rules.
+func isolateState(cfg *config.Config, stateDir string) error {
+	cfg.DatabaseStateDirectory = stateDir
+	cfg.BannedDBConfig["state_dir"] = filepath.Join(stateDir, "BannedDB")
+	statefulFilters := make([]*config.StatefulFilterConfig, 0, len(cfg.StatefulFilters))
+	for i := range cfg.StatefulFilters {
+		statefulFilters = append(statefulFilters, &cfg.StatefulFilters[i])
+	}
+	for i := range cfg.Chats {
+		for j := range cfg.Chats[i].StatefulFilters {
+			statefulFilters = append(statefulFilters, &cfg.Chats[i].StatefulFilters[j])
+		}
+	}
+	for _, f := range statefulFilters {
+		f.Arguments["state_dir"] = filepath.Join(stateDir, f.FilterName)
+		for j := range f.StatelessFilters {
+			rule := &f.StatelessFilters[j]
+			if rule.Arguments == nil {
+				continue
+			}
+			err := isolateRuleConfig(rule.Arguments, filepath.Join(stateDir, "config", f.FilterName, fmt.Sprintf("%v_%v", j, rule.Name)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readJSONLMessages(r io.Reader, fn func(*telego.Message) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		// Both raw messages and whole updates are accepted
+		var update telego.Update
+		err := json.Unmarshal(data, &update)
+		if err != nil {
+			return fmt.Errorf("line %v: %w", line, err)
+		}
+		msg := update.Message
+		if msg == nil {
+			msg = update.EditedMessage
+		}
+		if msg == nil {
+			msg = &telego.Message{}
+			err = json.Unmarshal(data, msg)
+			if err != nil {
+				return fmt.Errorf("line %v: %w", line, err)
+			}
+		}
+		err = fn(msg)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func readProtoMessages(r io.Reader, fn func(*telego.Message) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		var m message.Message
+		err := protodelim.UnmarshalFrom(reader, &m)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(m.ToTelego())
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func printReplayResult(w io.Writer, msg *telego.Message, results []chains.Result, fired []firedAction, calls []fakeBot.Call) {
+	var userID int64
+	if msg.From != nil {
+		userID = msg.From.ID
+	}
+
+	var winner *chains.Result
+	verdict := "ham"
+	for i := range results {
+		if results[i].Score.Score > 0 && (winner == nil || results[i].Score.Score > winner.Score.Score) {
+			winner = &results[i]
+		}
+		if results[i].Score.Score >= results[i].Chain.GetThreshold() {
+			verdict = "spam"
+		}
+	}
+	_, _ = fmt.Fprintf(w, "message_id=%v chat_id=%v user_id=%v: %v\n", msg.MessageID, msg.Chat.ID, userID, verdict)
+	if winner != nil {
+		_, _ = fmt.Fprintf(w, "    winner: chain=%v score=%v reason=%q\n", winner.Chain.GetFilterName(), winner.Score.Score,
+			winner.Score.Reason)
+	}
+	for _, a := range fired {
+		if a.err != nil {
+			_, _ = fmt.Fprintf(w, "    action: chain=%v action=%v error=%q\n", a.chain, a.action, a.err.Error())
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "    action: chain=%v action=%v\n", a.chain, a.action)
+	}
+	for _, c := range calls {
+		_, _ = fmt.Fprintf(w, "    bot api call: %v\n", c.Method)
+	}
+}
+
+func replayCommand(logger *zap.Logger) *cli.Command {
+	return &cli.Command{
+		Name:  "replay",
+		Usage: "Run recorded messages through configured chains without reaching Telegram",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "input",
+				Usage:    "file with recorded messages",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "format",
+				Usage: "input format: `jsonl` (telegram messages or updates, one per line) or `proto` (length-delimited message.proto); guessed from the file extension if not set",
+			},
+			&cli.StringFlag{
+				Name:  "state-dir",
+				Usage: "directory for state that is created during replay, temporary directory is used if not set",
+			},
+			&cli.StringFlag{
+				Name:  "config",
+				Value: configFile,
+				Usage: "configuration file",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			cfg, err := config.Load(c.String("config"))
+			if err != nil {
+				logger.Error("failed to load configuration", zap.Error(err))
+				return err
+			}
+
+			format := c.String("format")
+			if format == "" {
+				format = "jsonl"
+				if strings.HasSuffix(c.String("input"), ".pb") || strings.HasSuffix(c.String("input"), ".proto") {
+					format = "proto"
+				}
+			}
+			var read func(io.Reader, func(*telego.Message) error) error
+			switch format {
+			case "jsonl":
+				read = readJSONLMessages
+			case "proto":
+				read = readProtoMessages
+			default:
+				return ErrUnknownInputFormat
+			}
+
+			stateDir := c.String("state-dir")
+			if stateDir == "" {
+				stateDir, err = os.MkdirTemp("", "tg-simple-regex-antispam-replay-")
+				if err != nil {
+					return err
+				}
+				defer func() { _ = os.RemoveAll(stateDir) }()
+			}
+			err = isolateState(cfg, stateDir)
+			if err != nil {
+				return err
+			}
+
+			// Replay output goes to stdout, logs would only clutter it
+			replayLogger := logger.WithOptions(zap.IncreaseLevel(zap.ErrorLevel))
+
+			banDB, err := bannedDB.New(replayLogger, cfg.BannedDBConfig)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = banDB.Close() }()
+			// Rules learn from bans issued during replay the same way they do in the running bot
+			hub := events.NewHub()
+			banDB.SetEvents(hub)
+
+			bot := fakeBot.New()
+			recorder := &actionRecorder{}
+			builder := &chains.Builder{
+				Logger: replayLogger,
+				BanDB:  banDB,
+				Bot:    bot,
+				Deps:   interfaces.Deps{Events: hub},
+				WrapAction: func(chainName string, action actionsInterfaces.Action) actionsInterfaces.Action {
+					return &recordedAction{Action: action, chain: chainName, recorder: recorder}
+				},
+			}
+			registry, err := builder.BuildRegistry(cfg)
+			if err != nil {
+				return err
+			}
+			defer registry.Close(replayLogger)
+			banDB.SetStatefulFilters(registry.All)
+
+			f, err := os.Open(c.String("input"))
+			if err != nil {
+				return err
+			}
+			defer func() { _ = f.Close() }()
+
+			allowedChats := make(map[int64]struct{})
+			for _, id := range cfg.AllowedChatIDs {
+				allowedChats[id] = struct{}{}
+			}
+
+			return read(f, func(msg *telego.Message) error {
+				if _, ok := allowedChats[msg.Chat.ID]; !ok {
+					_, _ = fmt.Fprintf(os.Stdout, "message_id=%v chat_id=%v: skipped, chat is not allowed\n", msg.MessageID, msg.Chat.ID)
+					return nil
+				}
+				if msg.From == nil {
+					_, _ = fmt.Fprintf(os.Stdout, "message_id=%v chat_id=%v: skipped, message has no sender\n", msg.MessageID, msg.Chat.ID)
+					return nil
+				}
+				bot.Reset()
+				results := chains.Apply(bot, registry.ForChat(msg.Chat.ID), msg)
+				printReplayResult(os.Stdout, msg, results, recorder.reset(), bot.Calls())
+				return nil
+			})
+		},
+	}
+}
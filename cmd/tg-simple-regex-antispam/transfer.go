@@ -0,0 +1,630 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/checkNeventsState"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/regexConfig"
+	badgerHelper "github.com/Civil/tg-simple-regex-antispam/helper/badger"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+)
+
+var (
+	ErrUnknownDumpFormat      = errors.New("unknown format, supported formats are `json` and `csv`")
+	ErrUnknownImportMode      = errors.New("unknown import mode, supported modes are `merge` and `replace`")
+	ErrUnsupportedDumpVersion = errors.New("unsupported dump version")
+)
+
+const (
+	dumpVersion = 1
+
+	importMerge   = "merge"
+	importReplace = "replace"
+
+	// Key of the regex list in the database of regex rule
+	regexConfigKey = "config"
+)
+
+// dump is a portable representation of the state. Records are encoded with protojson, so they stay readable.
+type dump struct {
+	Version     int         `json:"version"`
+	BannedUsers []dumpedBan `json:"banned_users"`
+	// States of checkNevents chains, by chain name
+	ChainStates map[string][]dumpedState `json:"chain_states,omitempty"`
+	// Regex lists, by rule path (see regexLocations)
+	RegexConfigs map[string][]string `json:"regex_configs,omitempty"`
+}
+
+type dumpedBan struct {
+	UserID int64           `json:"user_id"`
+	Record json.RawMessage `json:"record"`
+}
+
+type dumpedState struct {
+	UserID int64           `json:"user_id"`
+	State  json.RawMessage `json:"state"`
+}
+
+var banCSVHeader = []string{
+	"user_id", "banned_at", "expires_at", "chat_id", "chain_name", "rule_name", "reason", "admin_id", "message_excerpt",
+}
+
+// chainStateDirs returns state directories of checkNevents chains by chain name
+func chainStateDirs(cfg *config.Config) map[string]string {
+	res := make(map[string]string)
+	for name, f := range chainConfigsByName(cfg) {
+		if f.Name != "checkNevents" {
+			continue
+		}
+		if dir, ok := f.Arguments["state_dir"].(string); ok && dir != "" {
+			res[name] = dir
+		}
+	}
+	return res
+}
+
+func chainConfigsByName(cfg *config.Config) map[string]config.StatefulFilterConfig {
+	res := make(map[string]config.StatefulFilterConfig)
+	for _, f := range cfg.StatefulFilters {
+		res[f.FilterName] = f
+	}
+	for _, chat := range cfg.Chats {
+		for _, f := range chat.StatefulFilters {
+			res[f.FilterName] = f
+		}
+	}
+	return res
+}
+
+// regexLocations returns config directories of regex rules, including nested ones. Rules are identified by the
+// chain name and their position, e.g. `spam_filter/0_regex` or `spam_filter/2_allOf/1_regex`.
+func regexLocations(cfg *config.Config) map[string]string {
+	res := make(map[string]string)
+	var walk func(path, name string, args map[string]any)
+	walk = func(path, name string, args map[string]any) {
+		if args == nil {
+			return
+		}
+		if dir, ok := args["config_dir"].(string); ok && dir != "" && name == "regex" {
+			res[path] = dir
+		}
+		nested, _ := args["rules"].([]any)
+		for i, r := range nested {
+			rule, ok := r.(map[string]any)
+			if !ok {
+				continue
+			}
+			nestedName, _ := rule["name"].(string)
+			nestedArgs, _ := rule["arguments"].(map[string]any)
+			walk(fmt.Sprintf("%v/%v_%v", path, i, nestedName), nestedName, nestedArgs)
+		}
+	}
+	for chain, f := range chainConfigsByName(cfg) {
+		for j, rule := range f.StatelessFilters {
+			walk(fmt.Sprintf("%v/%v_%v", chain, j, rule.Name), rule.Name, rule.Arguments)
+		}
+	}
+	return res
+}
+
+// openDB opens database in the directory. If mustExist is set and there is no such directory, nil is returned,
+// so export never creates empty databases.
+func openDB(logger *zap.Logger, name, dir string, mustExist bool) (*badger.DB, error) {
+	if mustExist {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+	}
+	return badger.Open(badgerOpts.GetBadgerOptions(logger, name, dir))
+}
+
+func exportBans(banDB bannedDB.BanDB) ([]int64, map[int64]*banRecord.BanRecord, error) {
+	userIDs, err := banDB.ListUserIDs()
+	if err != nil {
+		return nil, nil, err
+	}
+	records := make(map[int64]*banRecord.BanRecord, len(userIDs))
+	for _, userID := range userIDs {
+		records[userID], err = banDB.GetBan(userID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("user %v: %w", userID, err)
+		}
+	}
+	return userIDs, records, nil
+}
+
+func exportChainState(logger *zap.Logger, chain, dir string) ([]dumpedState, error) {
+	db, err := openDB(logger, chain+"_DB", dir, true)
+	if err != nil || db == nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	res := make([]dumpedState, 0)
+	err = db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			userID, err := badgerHelper.KeyToUserID(it.Item().Key())
+			if err != nil {
+				return err
+			}
+			var state checkNeventsState.State
+			err = it.Item().Value(func(val []byte) error {
+				return proto.Unmarshal(val, &state)
+			})
+			if err != nil {
+				return err
+			}
+			data, err := protojson.Marshal(&state)
+			if err != nil {
+				return err
+			}
+			res = append(res, dumpedState{UserID: userID, State: data})
+		}
+		return nil
+	})
+	return res, err
+}
+
+func readRegexConfig(db *badger.DB) (*regexConfig.Config, error) {
+	var reConfig regexConfig.Config
+	err := db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(regexConfigKey))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return proto.Unmarshal(val, &reConfig)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return &reConfig, nil
+	}
+	return &reConfig, err
+}
+
+func exportRegexConfig(logger *zap.Logger, dir string) ([]string, error) {
+	db, err := openDB(logger, "regex_DB", dir, true)
+	if err != nil || db == nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+	reConfig, err := readRegexConfig(db)
+	if err != nil {
+		return nil, err
+	}
+	return reConfig.Regex, nil
+}
+
+func formatTimestamp(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return ""
+	}
+	return ts.AsTime().Format(time.RFC3339)
+}
+
+func writeBansCSV(out io.Writer, userIDs []int64, records map[int64]*banRecord.BanRecord) error {
+	w := csv.NewWriter(out)
+	err := w.Write(banCSVHeader)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		r := records[userID]
+		err = w.Write([]string{
+			strconv.FormatInt(userID, 10),
+			formatTimestamp(r.BannedAt),
+			formatTimestamp(r.ExpiresAt),
+			strconv.FormatInt(r.ChatId, 10),
+			r.ChainName,
+			r.RuleName,
+			r.Reason,
+			strconv.FormatInt(r.AdminId, 10),
+			r.MessageExcerpt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func stateExport(logger *zap.Logger, c *cli.Context) error {
+	format := c.String("format")
+	if format != "json" && format != "csv" {
+		return ErrUnknownDumpFormat
+	}
+	cfg, err := config.Load(c.String("config"))
+	if err != nil {
+		logger.Error("failed to load configuration", zap.Error(err))
+		return err
+	}
+
+	banDB, err := bannedDB.New(logger, cfg.BannedDBConfig)
+	if err != nil {
+		return err
+	}
+	userIDs, records, err := exportBans(banDB)
+	_ = banDB.Close()
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if c.String("output") != "" && c.String("output") != "-" {
+		f, err := os.Create(c.String("output"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+
+	if format == "csv" {
+		return writeBansCSV(out, userIDs, records)
+	}
+
+	d := dump{
+		Version:      dumpVersion,
+		BannedUsers:  make([]dumpedBan, 0, len(userIDs)),
+		ChainStates:  make(map[string][]dumpedState),
+		RegexConfigs: make(map[string][]string),
+	}
+	for _, userID := range userIDs {
+		data, err := protojson.Marshal(records[userID])
+		if err != nil {
+			return err
+		}
+		d.BannedUsers = append(d.BannedUsers, dumpedBan{UserID: userID, Record: data})
+	}
+	for chain, dir := range chainStateDirs(cfg) {
+		states, err := exportChainState(logger, chain, dir)
+		if err != nil {
+			return fmt.Errorf("chain %v: %w", chain, err)
+		}
+		if states != nil {
+			d.ChainStates[chain] = states
+		}
+	}
+	for path, dir := range regexLocations(cfg) {
+		regex, err := exportRegexConfig(logger, dir)
+		if err != nil {
+			return fmt.Errorf("regex %v: %w", path, err)
+		}
+		if regex != nil {
+			d.RegexConfigs[path] = regex
+		}
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+func parseTimestamp(s string) (*timestamppb.Timestamp, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, err
+	}
+	return timestamppb.New(t), nil
+}
+
+// readBansCSV reads bans in the format of export. Header is optional, so plain lists of user IDs are accepted too.
+func readBansCSV(in io.Reader) (map[int64]*banRecord.BanRecord, error) {
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := banCSVHeader
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		if _, err := strconv.ParseInt(rows[0][0], 10, 64); err != nil {
+			columns = rows[0]
+			rows = rows[1:]
+		}
+	}
+
+	res := make(map[int64]*banRecord.BanRecord, len(rows))
+	for i, row := range rows {
+		fields := make(map[string]string, len(row))
+		for j, v := range row {
+			if j < len(columns) {
+				fields[columns[j]] = v
+			}
+		}
+		userID, err := strconv.ParseInt(fields["user_id"], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("row %v: invalid user_id: %w", i+1, err)
+		}
+		record := &banRecord.BanRecord{
+			ChainName:      fields["chain_name"],
+			RuleName:       fields["rule_name"],
+			Reason:         fields["reason"],
+			MessageExcerpt: fields["message_excerpt"],
+		}
+		record.BannedAt, err = parseTimestamp(fields["banned_at"])
+		if err != nil {
+			return nil, fmt.Errorf("row %v: invalid banned_at: %w", i+1, err)
+		}
+		record.ExpiresAt, err = parseTimestamp(fields["expires_at"])
+		if err != nil {
+			return nil, fmt.Errorf("row %v: invalid expires_at: %w", i+1, err)
+		}
+		for _, name := range []string{"chat_id", "admin_id"} {
+			if fields[name] == "" {
+				continue
+			}
+			v, err := strconv.ParseInt(fields[name], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("row %v: invalid %v: %w", i+1, name, err)
+			}
+			if name == "chat_id" {
+				record.ChatId = v
+			} else {
+				record.AdminId = v
+			}
+		}
+		res[userID] = record
+	}
+	return res, nil
+}
+
+func importBans(banDB bannedDB.BanDB, records map[int64]*banRecord.BanRecord, mode string) error {
+	if mode == importReplace {
+		userIDs, err := banDB.ListUserIDs()
+		if err != nil {
+			return err
+		}
+		for _, userID := range userIDs {
+			if _, ok := records[userID]; ok {
+				continue
+			}
+			// Dropped bans are not explicit unbans, blocklists and peers may ban these users again
+			err = banDB.RemoveBan(userID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for userID, record := range records {
+		err := banDB.SetBan(userID, record)
+		if err != nil {
+			return fmt.Errorf("user %v: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+func importChainState(logger *zap.Logger, chain, dir string, states []dumpedState, mode string) error {
+	db, err := openDB(logger, chain+"_DB", dir, false)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	if mode == importReplace {
+		err = db.DropAll()
+		if err != nil {
+			return err
+		}
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		for _, s := range states {
+			var state checkNeventsState.State
+			err := protojson.Unmarshal(s.State, &state)
+			if err != nil {
+				return fmt.Errorf("user %v: %w", s.UserID, err)
+			}
+			val, err := proto.Marshal(&state)
+			if err != nil {
+				return err
+			}
+			err = txn.Set(badgerHelper.UserIDToKey(s.UserID), val)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func importRegexConfig(logger *zap.Logger, dir string, regex []string, mode string) error {
+	db, err := openDB(logger, "regex_DB", dir, false)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	reConfig := &regexConfig.Config{}
+	if mode == importMerge {
+		reConfig, err = readRegexConfig(db)
+		if err != nil {
+			return err
+		}
+	}
+	for _, re := range regex {
+		if !slices.Contains(reConfig.Regex, re) {
+			reConfig.Regex = append(reConfig.Regex, re)
+		}
+	}
+	val, err := proto.Marshal(reConfig)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte(regexConfigKey), val)
+	})
+}
+
+func stateImport(logger *zap.Logger, c *cli.Context) error {
+	format := c.String("format")
+	if format != "json" && format != "csv" {
+		return ErrUnknownDumpFormat
+	}
+	mode := c.String("mode")
+	if mode != importMerge && mode != importReplace {
+		return ErrUnknownImportMode
+	}
+	cfg, err := config.Load(c.String("config"))
+	if err != nil {
+		logger.Error("failed to load configuration", zap.Error(err))
+		return err
+	}
+
+	var in io.Reader = os.Stdin
+	if c.String("input") != "" && c.String("input") != "-" {
+		f, err := os.Open(c.String("input"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	var d dump
+	records := make(map[int64]*banRecord.BanRecord)
+	if format == "csv" {
+		records, err = readBansCSV(in)
+		if err != nil {
+			return err
+		}
+	} else {
+		err = json.NewDecoder(in).Decode(&d)
+		if err != nil {
+			return err
+		}
+		if d.Version != dumpVersion {
+			return fmt.Errorf("%w: %v", ErrUnsupportedDumpVersion, d.Version)
+		}
+		for _, b := range d.BannedUsers {
+			record := &banRecord.BanRecord{}
+			err = protojson.Unmarshal(b.Record, record)
+			if err != nil {
+				return fmt.Errorf("user %v: %w", b.UserID, err)
+			}
+			records[b.UserID] = record
+		}
+	}
+
+	// Databases are noisy on open and close
+	dbLogger := logger.WithOptions(zap.IncreaseLevel(zap.WarnLevel))
+	banDB, err := bannedDB.New(dbLogger, cfg.BannedDBConfig)
+	if err != nil {
+		return err
+	}
+	err = importBans(banDB, records, mode)
+	_ = banDB.Close()
+	if err != nil {
+		return err
+	}
+	logger.Info("imported bans", zap.Int("count", len(records)))
+
+	stateDirs := chainStateDirs(cfg)
+	for chain, states := range d.ChainStates {
+		dir, ok := stateDirs[chain]
+		if !ok {
+			logger.Warn("there is no checkNevents chain with that name, skipping its state", zap.String("chain", chain))
+			continue
+		}
+		err = importChainState(dbLogger, chain, dir, states, mode)
+		if err != nil {
+			return fmt.Errorf("chain %v: %w", chain, err)
+		}
+		logger.Info("imported chain state", zap.String("chain", chain), zap.Int("users", len(states)))
+	}
+
+	regexDirs := regexLocations(cfg)
+	for path, regex := range d.RegexConfigs {
+		dir, ok := regexDirs[path]
+		if !ok {
+			logger.Warn("there is no regex rule at that path, skipping its config", zap.String("path", path))
+			continue
+		}
+		err = importRegexConfig(dbLogger, dir, regex, mode)
+		if err != nil {
+			return fmt.Errorf("regex %v: %w", path, err)
+		}
+		logger.Info("imported regex config", zap.String("path", path), zap.Int("regex", len(regex)))
+	}
+	return nil
+}
+
+var dumpFormatFlag = &cli.StringFlag{
+	Name:  "format",
+	Value: "json",
+	Usage: "`json` (bans, checkNevents states and regex lists) or `csv` (bans only)",
+}
+
+func exportCommand(logger *zap.Logger) *cli.Command {
+	return &cli.Command{
+		Name:  "export",
+		Usage: "Export banned users, checkNevents states and regex lists, the bot must be stopped",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "config",
+				Value: configFile,
+				Usage: "configuration file",
+			},
+			dumpFormatFlag,
+			&cli.StringFlag{
+				Name:  "output",
+				Usage: "output file, stdout if not set",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return stateExport(logger.WithOptions(zap.IncreaseLevel(zap.WarnLevel)), c)
+		},
+	}
+}
+
+func importCommand(logger *zap.Logger) *cli.Command {
+	return &cli.Command{
+		Name:  "import",
+		Usage: "Import data produced by export, the bot must be stopped",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "config",
+				Value: configFile,
+				Usage: "configuration file",
+			},
+			dumpFormatFlag,
+			&cli.StringFlag{
+				Name:  "input",
+				Usage: "input file, stdin if not set",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Value: importMerge,
+				Usage: "`merge` adds imported data to existing one, `replace` removes existing data of imported sections first",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			return stateImport(logger.WithOptions(zap.IncreaseLevel(zap.InfoLevel)), c)
+		},
+	}
+}
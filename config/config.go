@@ -2,7 +2,13 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/yaml.v3"
@@ -24,9 +30,183 @@ type StatefulFilterConfig struct {
 }
 
 type StatelessFilteringRules struct {
-	Name       string         `yaml:"name"`
-	FilterName string         `yaml:"filter_name"`
-	Arguments  map[string]any `yaml:"arguments"`
+	Name       string `yaml:"name"`
+	FilterName string `yaml:"filter_name"`
+	// Score of the rule is multiplied by the weight, 0 (not set) means 1
+	Weight    float64        `yaml:"weight,omitempty"`
+	Arguments map[string]any `yaml:"arguments"`
+}
+
+func (r *StatelessFilteringRules) Validate() error {
+	if math.IsNaN(r.Weight) || r.Weight < 0 {
+		return fmt.Errorf("rule %q: weight must be a non-negative number, got %v", r.FilterName, r.Weight)
+	}
+	return nil
+}
+
+type WebhookConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ListenAddress string `yaml:"listen_address"`
+	PublicURL     string `yaml:"public_url"`
+	Path          string `yaml:"path"`
+	// SecretToken is sent by Telegram in X-Telegram-Bot-Api-Secret-Token header with every update
+	SecretToken string `yaml:"secret_token"`
+}
+
+var webhookSecretTokenRE = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+func (w *WebhookConfig) Validate() error {
+	if !w.Enabled {
+		return nil
+	}
+	if w.ListenAddress == "" {
+		return errors.New("webhook.listen_address is required")
+	}
+	if w.PublicURL == "" {
+		return errors.New("webhook.public_url is required")
+	}
+	if !strings.HasPrefix(w.PublicURL, "https://") {
+		return errors.New("webhook.public_url must be an https url")
+	}
+	if !strings.HasPrefix(w.Path, "/") {
+		return errors.New("webhook.path must start with '/'")
+	}
+	if w.SecretToken != "" && !webhookSecretTokenRE.MatchString(w.SecretToken) {
+		return errors.New("webhook.secret_token must be 1-256 characters long and contain only A-Z, a-z, 0-9, _ and -")
+	}
+	return nil
+}
+
+// URL returns full url that will be registered in Telegram
+func (w *WebhookConfig) URL() string {
+	return strings.TrimSuffix(w.PublicURL, "/") + w.Path
+}
+
+type PipelineConfig struct {
+	// Workers is a number of updates that can be processed in parallel
+	Workers int `yaml:"workers"`
+	// QueueSize is a maximum number of updates waiting for a worker, receiving new updates blocks when it is reached
+	QueueSize int `yaml:"queue_size"`
+	// PerKeyQueueSize is a maximum number of waiting updates from a single chat or a single user
+	PerKeyQueueSize int `yaml:"per_key_queue_size"`
+	// DrainTimeout limits time spent on processing queued updates on shutdown, queued updates are dropped after it
+	DrainTimeout time.Duration `yaml:"drain_timeout"`
+}
+
+func (p *PipelineConfig) Validate() error {
+	if p.Workers <= 0 {
+		return errors.New("pipeline.workers must be positive")
+	}
+	if p.QueueSize <= 0 {
+		return errors.New("pipeline.queue_size must be positive")
+	}
+	if p.PerKeyQueueSize <= 0 {
+		return errors.New("pipeline.per_key_queue_size must be positive")
+	}
+	if p.DrainTimeout <= 0 {
+		return errors.New("pipeline.drain_timeout must be positive")
+	}
+	return nil
+}
+
+type CaptureConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	StateDir string `yaml:"state_dir"`
+	// Retention is a time after which captured message is removed
+	Retention time.Duration `yaml:"retention"`
+	// MaxSizeMB limits size of captured messages, oldest messages are removed first, 0 means no limit
+	MaxSizeMB       int64         `yaml:"max_size_mb"`
+	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+}
+
+func (c *CaptureConfig) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Retention < 0 {
+		return errors.New("capture.retention cannot be negative")
+	}
+	if c.MaxSizeMB < 0 {
+		return errors.New("capture.max_size_mb cannot be negative")
+	}
+	if c.CleanupInterval <= 0 {
+		return errors.New("capture.cleanup_interval must be positive")
+	}
+	return nil
+}
+
+// AuditConfig describes append-only log of moderation events. Bans imported with `import` command are not recorded,
+// as it is done while the bot is stopped.
+type AuditConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	StateDir string `yaml:"state_dir"`
+}
+
+// AdminAPIConfig describes local HTTP API that executes the same commands as `/admin` messages
+type AdminAPIConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ListenAddress string `yaml:"listen_address"`
+	// Token must be sent in `Authorization: Bearer <token>` header
+	Token string `yaml:"token"`
+	// AdminID is recorded as an author of commands, first of admin_ids by default
+	AdminID int64 `yaml:"admin_id"`
+}
+
+func (a *AdminAPIConfig) Validate() error {
+	if !a.Enabled {
+		return nil
+	}
+	if a.ListenAddress == "" {
+		return errors.New("admin_api.listen_address is required")
+	}
+	if a.Token == "" {
+		return errors.New("admin_api.token is required")
+	}
+	return nil
+}
+
+// MetricsConfig describes HTTP endpoint with prometheus metrics
+type MetricsConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	ListenAddress string `yaml:"listen_address"`
+	Path          string `yaml:"path"`
+}
+
+func (m *MetricsConfig) Validate() error {
+	if !m.Enabled {
+		return nil
+	}
+	if m.ListenAddress == "" {
+		return errors.New("metrics.listen_address is required")
+	}
+	if !strings.HasPrefix(m.Path, "/") {
+		return errors.New("metrics.path must start with '/'")
+	}
+	return nil
+}
+
+// ChatConfig overrides chains for a single chat
+type ChatConfig struct {
+	ChatID int64 `yaml:"chat_id"`
+	// Chains are names of chains from global stateful_filters that run in the chat, order matters
+	Chains []string `yaml:"chains"`
+	// StatefulFilters are chains that run only in the chat, after the ones listed in Chains
+	StatefulFilters []StatefulFilterConfig `yaml:"stateful_filters"`
+}
+
+func (c *ChatConfig) Validate(allowedChats map[int64]struct{}, globalChains map[string]struct{}) error {
+	if _, ok := allowedChats[c.ChatID]; !ok {
+		return fmt.Errorf("chats: chat %v is not in allowed_chat_ids", c.ChatID)
+	}
+	if len(c.Chains) == 0 && len(c.StatefulFilters) == 0 {
+		return fmt.Errorf("chats: chat %v must specify chains or stateful_filters", c.ChatID)
+	}
+	for _, name := range c.Chains {
+		if _, ok := globalChains[name]; !ok {
+			return fmt.Errorf("chats: chat %v refers to unknown chain %q", c.ChatID, name)
+		}
+	}
+	return nil
 }
 
 type Config struct {
@@ -35,9 +215,22 @@ type Config struct {
 	AdminIDs               []int64  `yaml:"admin_ids"`
 	AdminUsernames         []string `yaml:"admin_usernames"`
 	DatabaseStateDirectory string   `yaml:"database_state_directory"`
-	// Order matters
+	// Order matters. Chains are applied to every chat that is not mentioned in Chats.
 	StatefulFilters []StatefulFilterConfig `yaml:"stateful_filters"`
-	BannedDBConfig  map[string]any         `yaml:"banned_db_config"`
+	// Chats allow to use different chains in some chats
+	Chats          []ChatConfig   `yaml:"chats"`
+	BannedDBConfig map[string]any `yaml:"banned_db_config"`
+	// Webhook is used instead of long polling if enabled
+	Webhook  WebhookConfig  `yaml:"webhook"`
+	Pipeline PipelineConfig `yaml:"pipeline"`
+	// Capture stores copies of all incoming messages from allowed chats
+	Capture CaptureConfig `yaml:"capture"`
+	// Audit records bans, unbans and other moderation events
+	Audit AuditConfig `yaml:"audit"`
+	// AdminAPI exposes admin commands over HTTP
+	AdminAPI AdminAPIConfig `yaml:"admin_api"`
+	// Metrics are served in prometheus format
+	Metrics MetricsConfig `yaml:"metrics"`
 
 	LogLevel zapcore.Level `yaml:"log_level"`
 }
@@ -55,18 +248,105 @@ func (c *Config) Validate() error {
 	if len(c.AdminIDs) == 0 {
 		return errors.New("admin_ids is required")
 	}
+	err := c.validateChains()
+	if err != nil {
+		return err
+	}
+	err = c.Pipeline.Validate()
+	if err != nil {
+		return err
+	}
+	err = c.Capture.Validate()
+	if err != nil {
+		return err
+	}
+	err = c.AdminAPI.Validate()
+	if err != nil {
+		return err
+	}
+	err = c.Metrics.Validate()
+	if err != nil {
+		return err
+	}
+	return c.Webhook.Validate()
+}
+
+// validateChains checks that chain names are unique, as they are used as admin command prefixes and state
+// directories, that rules of the chains are valid and that chat overrides are consistent
+func (c *Config) validateChains() error {
+	names := make(map[string]struct{})
+	checkChains := func(cfgs []StatefulFilterConfig) error {
+		for _, f := range cfgs {
+			if _, ok := names[f.FilterName]; ok {
+				return fmt.Errorf("duplicate filter_name %q", f.FilterName)
+			}
+			names[f.FilterName] = struct{}{}
+			for i := range f.StatelessFilters {
+				err := f.StatelessFilters[i].Validate()
+				if err != nil {
+					return fmt.Errorf("chain %q: %w", f.FilterName, err)
+				}
+			}
+		}
+		return nil
+	}
+	err := checkChains(c.StatefulFilters)
+	if err != nil {
+		return err
+	}
+	globalChains := make(map[string]struct{}, len(names))
+	for name := range names {
+		globalChains[name] = struct{}{}
+	}
+
+	allowedChats := make(map[int64]struct{})
+	for _, id := range c.AllowedChatIDs {
+		allowedChats[id] = struct{}{}
+	}
+	chats := make(map[int64]struct{})
+	for i := range c.Chats {
+		chat := &c.Chats[i]
+		if _, ok := chats[chat.ChatID]; ok {
+			return fmt.Errorf("chats: duplicate chat %v", chat.ChatID)
+		}
+		chats[chat.ChatID] = struct{}{}
+		err = chat.Validate(allowedChats, globalChains)
+		if err != nil {
+			return err
+		}
+		err = checkChains(chat.StatefulFilters)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (c *Config) FillDefaults() error {
-	for i := range c.StatefulFilters {
-		if c.StatefulFilters[i].Arguments == nil || c.StatefulFilters[i].Arguments["state_dir"] == nil {
-			if c.StatefulFilters[i].Arguments == nil {
-				c.StatefulFilters[i].Arguments = map[string]any{}
+// OnlyChainsDiffer returns true if other configuration differs from this one only by chains, which is the only
+// part that can be changed without restart
+func (c *Config) OnlyChainsDiffer(other *Config) bool {
+	a, b := *c, *other
+	a.StatefulFilters, b.StatefulFilters = nil, nil
+	a.Chats, b.Chats = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+func (c *Config) fillStatefulFilterDefaults(cfgs []StatefulFilterConfig) {
+	for i := range cfgs {
+		if cfgs[i].Arguments == nil || cfgs[i].Arguments["state_dir"] == nil {
+			if cfgs[i].Arguments == nil {
+				cfgs[i].Arguments = map[string]any{}
 			}
-			c.StatefulFilters[i].Arguments["state_dir"] = c.DatabaseStateDirectory + "/" + c.StatefulFilters[i].FilterName
+			cfgs[i].Arguments["state_dir"] = c.DatabaseStateDirectory + "/" + cfgs[i].FilterName
 		}
 	}
+}
+
+func (c *Config) FillDefaults() error {
+	c.fillStatefulFilterDefaults(c.StatefulFilters)
+	for i := range c.Chats {
+		c.fillStatefulFilterDefaults(c.Chats[i].StatefulFilters)
+	}
 
 	if c.BannedDBConfig == nil {
 		c.BannedDBConfig = map[string]any{}
@@ -76,6 +356,45 @@ func (c *Config) FillDefaults() error {
 		c.BannedDBConfig["state_dir"] = c.DatabaseStateDirectory + "/BannedDB"
 	}
 
+	if c.Webhook.Path == "" {
+		c.Webhook.Path = "/webhook"
+	}
+
+	if c.Metrics.Path == "" {
+		c.Metrics.Path = "/metrics"
+	}
+
+	if c.AdminAPI.AdminID == 0 && len(c.AdminIDs) > 0 {
+		c.AdminAPI.AdminID = c.AdminIDs[0]
+	}
+
+	if c.Pipeline.Workers == 0 {
+		c.Pipeline.Workers = 4
+	}
+	if c.Pipeline.QueueSize == 0 {
+		c.Pipeline.QueueSize = 1000
+	}
+	if c.Pipeline.PerKeyQueueSize == 0 {
+		c.Pipeline.PerKeyQueueSize = 100
+	}
+	if c.Pipeline.DrainTimeout == 0 {
+		c.Pipeline.DrainTimeout = 30 * time.Second
+	}
+
+	if c.Capture.StateDir == "" {
+		c.Capture.StateDir = c.DatabaseStateDirectory + "/Capture"
+	}
+	if c.Capture.Retention == 0 {
+		c.Capture.Retention = 30 * 24 * time.Hour
+	}
+	if c.Capture.CleanupInterval == 0 {
+		c.Capture.CleanupInterval = 10 * time.Minute
+	}
+
+	if c.Audit.StateDir == "" {
+		c.Audit.StateDir = c.DatabaseStateDirectory + "/Audit"
+	}
+
 	return nil
 }
 
@@ -127,6 +446,7 @@ func SampleConfig() *Config {
 						"match":         "bad_substring",
 						"isFinal":       true,
 						"caseSensitive": false,
+						"normalize":     true,
 					},
 				},
 				{
@@ -134,12 +454,48 @@ func SampleConfig() *Config {
 					FilterName: "contains_regex",
 					Arguments:  map[string]any{"regex": ".*[Ss]pam.*"},
 				},
+				{
+					Name:       "nearDuplicate",
+					FilterName: "similar to banned spam",
+					Arguments: map[string]any{
+						"config_dir":       "/path/to/common/database/state/nearDuplicate",
+						"threshold":        90,
+						"max_fingerprints": 1000,
+						"ttl":              "30d",
+					},
+				},
+				{
+					Name:       "bayes",
+					FilterName: "learnt spam words",
+					Arguments: map[string]any{
+						"config_dir":   "/path/to/common/database/state/bayes",
+						"min_messages": 10,
+					},
+				},
+				{
+					Name:       "allOf",
+					FilterName: "forwarded link not from partner",
+					Arguments: map[string]any{
+						"rules": []any{
+							map[string]any{"name": "isForward"},
+							map[string]any{"name": "hasLinks"},
+							map[string]any{
+								"name": "not",
+								"arguments": map[string]any{
+									"rules": []any{
+										map[string]any{"name": "partialMatch", "arguments": map[string]any{"match": "partner"}},
+									},
+								},
+							},
+						},
+					},
+				},
 			},
 			Actions: []ActionCfg{
 				{
 					Name:       "deleteAndBan",
 					ActionName: "ban user and delete their messages",
-					Arguments:  nil,
+					Arguments:  map[string]any{"trainSpam": true},
 				},
 			},
 		},
@@ -147,8 +503,10 @@ func SampleConfig() *Config {
 			FilterName: "moderation_filter",
 			Name:       "checkNevents",
 			Arguments: map[string]any{
-				"n":       2,
-				"isFinal": false,
+				"n":           2,
+				"isFinal":     false,
+				"threshold":   100,
+				"aggregation": "sum",
 			},
 			StatelessFilters: []StatelessFilteringRules{
 				{
@@ -156,6 +514,17 @@ func SampleConfig() *Config {
 					FilterName: "contains a regex",
 					Arguments:  map[string]any{"regex": ".*[Bb]ad.*"},
 				},
+				{
+					Name:       "hasLinks",
+					FilterName: "has 2 links",
+					Weight:     0.6,
+					Arguments:  map[string]any{"numLinks": 2},
+				},
+				{
+					Name:       "isForward",
+					FilterName: "is forward",
+					Weight:     0.5,
+				},
 			},
 			Actions: []ActionCfg{
 				{
@@ -177,11 +546,143 @@ func SampleConfig() *Config {
 				},
 			},
 		},
+		{
+			FilterName: "flood",
+			Name:       "flood",
+			Arguments: map[string]any{
+				"n":          5,
+				"window":     "10s",
+				"escalate":   true,
+				"strike_ttl": "24h",
+			},
+			Actions: []ActionCfg{
+				{
+					Name:       "kick",
+					ActionName: "kick on first violation",
+					Arguments:  map[string]any{"dryRun": false},
+				},
+				{
+					Name:       "deleteAndBan",
+					ActionName: "ban for a day on further violations",
+					Arguments:  map[string]any{"banDuration": "1d", "dryRun": false},
+				},
+			},
+		},
+		{
+			FilterName: "campaign",
+			Name:       "campaign",
+			Arguments: map[string]any{
+				"k":          3,
+				"window":     "10m",
+				"flag_ttl":   "24h",
+				"min_length": 20,
+				"recordBan":  false,
+			},
+			Actions: []ActionCfg{
+				{
+					Name:      "deleteAndBan",
+					Arguments: map[string]any{"dryRun": true},
+				},
+			},
+		},
+	}
+	res.Chats = []ChatConfig{
+		{
+			ChatID: 2345678901,
+			Chains: []string{"moderation_filter", "report"},
+			StatefulFilters: []StatefulFilterConfig{
+				{
+					FilterName: "links_filter",
+					Name:       "checkNevents",
+					Arguments: map[string]any{
+						"n": 3,
+					},
+					StatelessFilters: []StatelessFilteringRules{
+						{
+							Name:      "hasLinks",
+							Arguments: map[string]any{"isFinal": true},
+						},
+					},
+					Actions: []ActionCfg{
+						{
+							Name:      "deleteAndBan",
+							Arguments: map[string]any{"banDuration": "7d"},
+						},
+					},
+				},
+				{
+					FilterName: "captcha",
+					Name:       "captcha",
+					Arguments: map[string]any{
+						"type":     "math",
+						"timeout":  "5m",
+						"attempts": 2,
+					},
+					Actions: []ActionCfg{
+						{
+							Name:      "kick",
+							Arguments: map[string]any{"dryRun": false},
+						},
+					},
+				},
+			},
+		},
+	}
+	res.Webhook = WebhookConfig{
+		Enabled:       false,
+		ListenAddress: "127.0.0.1:8443",
+		PublicURL:     "https://bot.example.com",
+		Path:          "/webhook",
+		SecretToken:   "some_random_secret",
+	}
+	res.Capture = CaptureConfig{
+		Enabled:   false,
+		Retention: 7 * 24 * time.Hour,
+		MaxSizeMB: 1024,
+	}
+	res.Audit = AuditConfig{
+		Enabled: true,
+	}
+	res.AdminAPI = AdminAPIConfig{
+		Enabled:       false,
+		ListenAddress: "127.0.0.1:8091",
+		Token:         "some_random_admin_token",
+	}
+	res.Metrics = MetricsConfig{
+		Enabled:       false,
+		ListenAddress: "127.0.0.1:9090",
+		Path:          "/metrics",
 	}
 	res.LogLevel = zapcore.DebugLevel
 	_ = res.FillDefaults()
 	res.BannedDBConfig = map[string]any{
-		"state_dir": "/path/to/banned_db_state/dir",
+		"state_dir":              "/path/to/banned_db_state/dir",
+		"sweep_interval":         "1m",
+		"propagate_to_all_chats": false,
+		"blocklists": []any{
+			map[string]any{
+				"source":   "shared",
+				"path":     "/path/to/blocklists/shared.csv",
+				"interval": "1h",
+			},
+		},
+		"feed": map[string]any{
+			"listen_address": "127.0.0.1:8090",
+			"path":           "/bans",
+			"tokens":         []any{"secret-for-peers"},
+			"share_imported": false,
+		},
+		"peers": []any{
+			map[string]any{
+				"source":             "partner",
+				"url":                "http://partner.example.com:8090/bans",
+				"token":              "secret-from-partner",
+				"interval":           "1m",
+				"full_sync_interval": "24h",
+				"timeout":            "30s",
+				"trust":              "manual",
+			},
+		},
 	}
 	return res
 }
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWebhookConfigValidate(t *testing.T) {
+	valid := WebhookConfig{
+		Enabled:       true,
+		ListenAddress: ":8443",
+		PublicURL:     "https://example.com",
+		Path:          "/webhook",
+		SecretToken:   "secret_token-1",
+	}
+	tests := []struct {
+		name    string
+		modify  func(w *WebhookConfig)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(w *WebhookConfig) {}},
+		{name: "disabled is not validated", modify: func(w *WebhookConfig) { *w = WebhookConfig{} }},
+		{name: "no secret token", modify: func(w *WebhookConfig) { w.SecretToken = "" }},
+		{name: "no listen address", modify: func(w *WebhookConfig) { w.ListenAddress = "" }, wantErr: true},
+		{name: "no public url", modify: func(w *WebhookConfig) { w.PublicURL = "" }, wantErr: true},
+		{name: "plain http", modify: func(w *WebhookConfig) { w.PublicURL = "http://example.com" }, wantErr: true},
+		{name: "relative path", modify: func(w *WebhookConfig) { w.Path = "webhook" }, wantErr: true},
+		{name: "invalid secret token", modify: func(w *WebhookConfig) { w.SecretToken = "not allowed!" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := valid
+			tt.modify(&w)
+			err := w.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookConfigURL(t *testing.T) {
+	tests := []struct {
+		publicURL string
+		path      string
+		want      string
+	}{
+		{publicURL: "https://example.com", path: "/webhook", want: "https://example.com/webhook"},
+		{publicURL: "https://example.com/", path: "/webhook", want: "https://example.com/webhook"},
+		{publicURL: "https://example.com/bot", path: "/hook", want: "https://example.com/bot/hook"},
+	}
+	for _, tt := range tests {
+		w := WebhookConfig{PublicURL: tt.publicURL, Path: tt.path}
+		if got := w.URL(); got != tt.want {
+			t.Errorf("URL() = %v, want %v", got, tt.want)
+		}
+	}
+}
+
+func TestPipelineConfigValidate(t *testing.T) {
+	valid := PipelineConfig{Workers: 1, QueueSize: 1, PerKeyQueueSize: 1, DrainTimeout: time.Second}
+	tests := []struct {
+		name    string
+		modify  func(p *PipelineConfig)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(p *PipelineConfig) {}},
+		{name: "no workers", modify: func(p *PipelineConfig) { p.Workers = 0 }, wantErr: true},
+		{name: "no queue", modify: func(p *PipelineConfig) { p.QueueSize = 0 }, wantErr: true},
+		{name: "no per key queue", modify: func(p *PipelineConfig) { p.PerKeyQueueSize = 0 }, wantErr: true},
+		{name: "zero drain timeout", modify: func(p *PipelineConfig) { p.DrainTimeout = 0 }, wantErr: true},
+		{name: "negative drain timeout", modify: func(p *PipelineConfig) { p.DrainTimeout = -time.Second }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid
+			tt.modify(&p)
+			err := p.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateChainsWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weight  float64
+		wantErr bool
+	}{
+		{name: "not set", weight: 0},
+		{name: "fraction", weight: 0.5},
+		{name: "negative", weight: -1, wantErr: true},
+		{name: "NaN", weight: math.NaN(), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := func(name string) []StatefulFilterConfig {
+				return []StatefulFilterConfig{{
+					FilterName:       name,
+					StatelessFilters: []StatelessFilteringRules{{FilterName: "rule", Weight: tt.weight}},
+				}}
+			}
+			global := Config{AllowedChatIDs: []int64{-100}, StatefulFilters: chain("spam")}
+			chat := Config{
+				AllowedChatIDs: []int64{-100},
+				Chats:          []ChatConfig{{ChatID: -100, StatefulFilters: chain("spam")}},
+			}
+			for _, c := range []*Config{&global, &chat} {
+				err := c.validateChains()
+				if (err != nil) != tt.wantErr {
+					t.Errorf("validateChains() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
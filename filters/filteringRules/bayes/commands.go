@@ -0,0 +1,107 @@
+package bayes
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+	"github.com/Civil/tg-simple-regex-antispam/helper/stateful"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+// statsTopTokens is a number of the most spammy tokens shown in stats
+const statsTopTokens = 10
+
+func reply(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, text string) error {
+	err := tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, text)
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
+
+func (r *Filter) tgTrain(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	if len(tokens) < 1 {
+		logger.Warn("invalid command", zap.Strings("tokens", tokens))
+		return stateful.ErrInvalidCommand
+	}
+	label, ok := events.ParseLabel(tokens[0])
+	if !ok {
+		logger.Warn("invalid label", zap.Strings("tokens", tokens))
+		return stateful.ErrInvalidCommand
+	}
+	if message.ReplyToMessage == nil {
+		return reply(logger, bot, message, "Reply to a message to train on it")
+	}
+	err := r.train(label, tg.MessageText(message.ReplyToMessage))
+	if errors.Is(err, ErrNoTokens) {
+		return reply(logger, bot, message, "Message has no words to train on")
+	}
+	if err != nil {
+		logger.Error("failed to train", zap.Error(err))
+		return err
+	}
+	return reply(logger, bot, message, fmt.Sprintf("Trained as %v", label))
+}
+
+func (r *Filter) tgStats(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	r.RLock()
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString(fmt.Sprintf("Trained on %v spam and %v ham messages, %v known words\n", r.totals.Spam, r.totals.Ham, len(r.tokens)))
+	if r.totals.Spam < r.minMessages || r.totals.Ham < r.minMessages {
+		buf.WriteString(fmt.Sprintf("Messages are not scored until there are at least %v of each\n", r.minMessages))
+	}
+	scores := make([]tokenScore, 0, len(r.tokens))
+	for t, counts := range r.tokens {
+		if counts.Spam == 0 {
+			continue
+		}
+		scores = append(scores, tokenScore{
+			token:    t,
+			logRatio: logRatio(counts.Spam, counts.Ham, r.totals.Spam, r.totals.Ham),
+		})
+	}
+	slices.SortFunc(scores, func(a, b tokenScore) int {
+		return cmp.Compare(b.logRatio, a.logRatio)
+	})
+	if len(scores) > 0 {
+		buf.WriteString("\nWords typical for spam:\n")
+	}
+	for _, s := range scores[:min(len(scores), statsTopTokens)] {
+		counts := r.tokens[s.token]
+		buf.WriteString(fmt.Sprintf(" - %v: %v spam, %v ham\n", s.token, counts.Spam, counts.Ham))
+	}
+	r.RUnlock()
+	return reply(logger, bot, message, buf.String())
+}
+
+func (r *Filter) tgReset(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	err := r.reset()
+	if err != nil {
+		logger.Error("failed to reset model", zap.Error(err))
+		return err
+	}
+	return reply(logger, bot, message, "Model is reset")
+}
+
+func (r *Filter) tgHelp(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("Available commands:\n")
+	buf.WriteString(" - `train spam|ham` - train on the message, command must be a reply to it\n")
+	buf.WriteString(" - `stats` - show number of trained messages and words typical for spam\n")
+	buf.WriteString(" - `reset` - forget everything that was learnt\n")
+	buf.WriteString(" - `help` - this help\n")
+
+	err := tg.SendMarkdownMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
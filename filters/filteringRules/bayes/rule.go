@@ -0,0 +1,375 @@
+package bayes
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/bayesState"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+	"github.com/Civil/tg-simple-regex-antispam/helper/textnorm"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+var (
+	ErrConfigDirEmpty      = errors.New("config_dir cannot be empty")
+	ErrMinMessagesNegative = errors.New("min_messages cannot be negative")
+	ErrMinTokensInvalid    = errors.New("min_tokens must be positive")
+	ErrMaxTokensInvalid    = errors.New("max_tokens must be positive and not less than min_tokens")
+	ErrNoTokens            = errors.New("message has no words")
+)
+
+const (
+	prefixToken  byte = 't'
+	prefixTotals byte = 'n'
+)
+
+// totalsKey must not start with prefixToken, otherwise it would be loaded as a token
+var totalsKey = []byte{prefixTotals}
+
+// Filter is a naive Bayes classifier. It learns which words are common in spam and in ham from messages that were
+// classified by chains and admins, and scores messages by probability of them being a spam.
+type Filter struct {
+	sync.RWMutex
+	logger    *zap.Logger
+	chainName string
+
+	db *badger.DB
+	// totals are numbers of trained messages, tokens are numbers of trained messages that contain the token
+	totals bayesState.Counts
+	tokens map[string]*bayesState.Counts
+
+	minMessages uint64
+	minTokens   int
+	maxTokens   int
+	isFinal     bool
+	// normalize enables tokenizing normalized text, see textnorm.Normalize
+	normalize bool
+
+	stopTraining func()
+
+	tg.TGHaveAdminCommands
+}
+
+func New(logger *zap.Logger, deps interfaces.Deps, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
+	logger = logger.With(zap.String("filter", chainName), zap.String("filter_type", "bayes"))
+	configDir, err := config2.GetOptionString(config, "config_dir")
+	if err != nil {
+		return nil, err
+	}
+	if configDir == "" {
+		return nil, ErrConfigDirEmpty
+	}
+
+	minMessages, err := config2.GetOptionIntWithDefault(config, "min_messages", 10)
+	if err != nil {
+		return nil, err
+	}
+	if minMessages < 0 {
+		return nil, ErrMinMessagesNegative
+	}
+
+	minTokens, err := config2.GetOptionIntWithDefault(config, "min_tokens", 3)
+	if err != nil {
+		return nil, err
+	}
+	if minTokens <= 0 {
+		return nil, ErrMinTokensInvalid
+	}
+
+	maxTokens, err := config2.GetOptionIntWithDefault(config, "max_tokens", 20)
+	if err != nil {
+		return nil, err
+	}
+	if maxTokens <= 0 || maxTokens < minTokens {
+		return nil, ErrMaxTokensInvalid
+	}
+
+	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
+	if err != nil {
+		return nil, err
+	}
+
+	learn, err := config2.GetOptionBoolWithDefault(config, "learn", true)
+	if err != nil {
+		return nil, err
+	}
+
+	normalize, err := config2.GetOptionBoolWithDefault(config, "normalize", false)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := badgerOpts.Open(logger, chainName+"_DB", configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		logger:      logger,
+		chainName:   chainName,
+		db:          db,
+		tokens:      make(map[string]*bayesState.Counts),
+		minMessages: uint64(minMessages),
+		minTokens:   minTokens,
+		maxTokens:   maxTokens,
+		isFinal:     isFinal,
+		normalize:   normalize,
+	}
+	err = f.load()
+	if err != nil {
+		_ = badgerOpts.Close(db)
+		return nil, err
+	}
+
+	if learn {
+		f.stopTraining = deps.Events.ObserveTraining(f.learn)
+	}
+
+	f.TGHaveAdminCommands.Handlers = map[string]tg.AdminCMDHandlerFunc{
+		"train": f.tgTrain,
+		"stats": f.tgStats,
+		"reset": f.tgReset,
+		"help":  f.tgHelp,
+	}
+	return f, nil
+}
+
+func Help() string {
+	return "bayes requires `config_dir` parameter, optional: `min_messages` (number of both spam and ham messages to train on before scoring, default 10), `min_tokens` (messages with fewer known words are not scored, default 3), `max_tokens` (number of the most telling words used for scoring, default 20), `learn` (train on messages of users banned by deleteAndBan with `trainSpam` or from moderation cards and of verified users, default true), `normalize` (tokenize text with homoglyphs and invisible characters normalized, default false)"
+}
+
+func tokenKey(token string) []byte {
+	return append([]byte{prefixToken}, token...)
+}
+
+func (r *Filter) load() error {
+	return r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(totalsKey)
+		if err == nil {
+			err = item.Value(func(val []byte) error {
+				return proto.Unmarshal(val, &r.totals)
+			})
+		}
+		if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte{prefixToken}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var counts bayesState.Counts
+			err := it.Item().Value(func(val []byte) error {
+				return proto.Unmarshal(val, &counts)
+			})
+			if err != nil {
+				return err
+			}
+			r.tokens[string(it.Item().Key()[1:])] = &counts
+		}
+		return nil
+	})
+}
+
+func increment(counts *bayesState.Counts, label events.Label) {
+	if label == events.Spam {
+		counts.Spam++
+	} else {
+		counts.Ham++
+	}
+}
+
+// train updates the model with the text of known class and stores changed counters
+func (r *Filter) train(label events.Label, text string) error {
+	tokens := r.tokensOf(text)
+	if len(tokens) == 0 {
+		return ErrNoTokens
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	totals := proto.Clone(&r.totals).(*bayesState.Counts)
+	increment(totals, label)
+	updated := make(map[string]*bayesState.Counts, len(tokens))
+	for _, t := range tokens {
+		counts := &bayesState.Counts{}
+		if c, ok := r.tokens[t]; ok {
+			counts = proto.Clone(c).(*bayesState.Counts)
+		}
+		increment(counts, label)
+		updated[t] = counts
+	}
+
+	err := r.db.Update(func(txn *badger.Txn) error {
+		b, err := proto.Marshal(totals)
+		if err != nil {
+			return err
+		}
+		err = txn.Set(totalsKey, b)
+		if err != nil {
+			return err
+		}
+		for t, counts := range updated {
+			b, err := proto.Marshal(counts)
+			if err != nil {
+				return err
+			}
+			err = txn.Set(tokenKey(t), b)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.totals.Spam, r.totals.Ham = totals.Spam, totals.Ham
+	for t, counts := range updated {
+		r.tokens[t] = counts
+	}
+	return nil
+}
+
+// tokensOf returns tokens of the text, normalized if normalization is enabled
+func (r *Filter) tokensOf(text string) []string {
+	if r.normalize {
+		text = textnorm.Normalize(text)
+	}
+	return tokenize(text)
+}
+
+// learn trains on messages that were classified by chains and admins
+func (r *Filter) learn(label events.Label, text string) {
+	err := r.train(label, text)
+	if err != nil && !errors.Is(err, ErrNoTokens) {
+		r.logger.Error("failed to train", zap.String("label", string(label)), zap.Error(err))
+	}
+}
+
+// reset forgets everything that was learnt. Only keys of the model are removed rather than the whole database.
+func (r *Filter) reset() error {
+	r.Lock()
+	defer r.Unlock()
+	err := r.db.DropPrefix(totalsKey, []byte{prefixToken})
+	if err != nil {
+		return err
+	}
+	r.totals.Spam, r.totals.Ham = 0, 0
+	r.tokens = make(map[string]*bayesState.Counts)
+	return nil
+}
+
+type tokenScore struct {
+	token    string
+	logRatio float64
+}
+
+// spamProbability combines the most telling known tokens of the text, ok is false if model doesn't know enough about
+// the text. Must be called with mutex held.
+func (r *Filter) spamProbability(tokens []string) (float64, []tokenScore, bool) {
+	if r.totals.Spam < r.minMessages || r.totals.Ham < r.minMessages {
+		return 0, nil, false
+	}
+	scores := make([]tokenScore, 0, len(tokens))
+	for _, t := range tokens {
+		counts, ok := r.tokens[t]
+		if !ok {
+			continue
+		}
+		scores = append(scores, tokenScore{
+			token:    t,
+			logRatio: logRatio(counts.Spam, counts.Ham, r.totals.Spam, r.totals.Ham),
+		})
+	}
+	if len(scores) < r.minTokens {
+		return 0, nil, false
+	}
+	slices.SortFunc(scores, func(a, b tokenScore) int {
+		return cmp.Compare(math.Abs(b.logRatio), math.Abs(a.logRatio))
+	})
+	scores = scores[:min(len(scores), r.maxTokens)]
+
+	// Priors are equal, as the number of trained messages depends on the moderation rather than on the share of spam
+	var sum float64
+	for _, s := range scores {
+		sum += s.logRatio
+	}
+	return sigmoid(sum), scores, true
+}
+
+func (r *Filter) Score(_ botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	res := &scoringResult.ScoringResult{}
+	tokens := r.tokensOf(tg.MessageText(msg))
+	if len(tokens) == 0 {
+		return res
+	}
+
+	r.RLock()
+	defer r.RUnlock()
+	p, scores, ok := r.spamProbability(tokens)
+	if !ok {
+		return res
+	}
+	res.Score = int32(p * 100)
+	if res.Score == 0 {
+		return res
+	}
+
+	spammy := make([]string, 0, 5)
+	for _, s := range scores {
+		if s.logRatio > 0 && len(spammy) < cap(spammy) {
+			spammy = append(spammy, s.token)
+		}
+	}
+	r.logger.Debug("scored message", zap.Float64("probability", p), zap.Strings("spammy_tokens", spammy))
+	res.Reason = fmt.Sprintf("Spam probability is %v%%", res.Score)
+	if len(spammy) > 0 {
+		res.Reason += ", words typical for spam: " + strings.Join(spammy, ", ")
+	}
+	return res
+}
+
+func (r *Filter) IsStateful() bool {
+	return false
+}
+
+func (r *Filter) GetName() string {
+	return "bayes"
+}
+
+func (r *Filter) GetFilterName() string {
+	return ""
+}
+
+func (r *Filter) IsFinal() bool {
+	return r.isFinal
+}
+
+func (r *Filter) TGAdminPrefix() string {
+	return r.chainName
+}
+
+func (r *Filter) Close() error {
+	if r.stopTraining != nil {
+		r.stopTraining()
+	}
+	return badgerOpts.Close(r.db)
+}
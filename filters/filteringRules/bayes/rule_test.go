@@ -0,0 +1,238 @@
+package bayes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+)
+
+const (
+	spamText = "buy cheap crypto signals now"
+	hamText  = "see you at the meeting tomorrow"
+)
+
+func newTestFilter(t *testing.T, configDir string, config map[string]any) *Filter {
+	t.Helper()
+	if config == nil {
+		config = map[string]any{}
+	}
+	config["config_dir"] = configDir
+	r, err := New(zap.NewNop(), interfaces.Deps{}, config, "spam.bayes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.(*Filter)
+}
+
+// trainTimes trains the filter on the text n times
+func trainTimes(t *testing.T, f *Filter, label events.Label, text string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		err := f.train(label, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func score(f *Filter, text string) int32 {
+	return f.Score(nil, &telego.Message{Text: text}).Score
+}
+
+func TestTrain(t *testing.T) {
+	f := newTestFilter(t, t.TempDir(), nil)
+	t.Cleanup(func() { _ = f.Close() })
+
+	trainTimes(t, f, events.Spam, "buy buy crypto", 2)
+	trainTimes(t, f, events.Ham, "crypto news", 1)
+	err := f.train(events.Ham, "!!! ...")
+	if err == nil {
+		t.Errorf("message without words was trained on")
+	}
+
+	if f.totals.Spam != 2 || f.totals.Ham != 1 {
+		t.Errorf("got totals %v", &f.totals)
+	}
+	tests := []struct {
+		token     string
+		spam, ham uint64
+	}{
+		// Tokens are counted once per message
+		{token: "buy", spam: 2},
+		{token: "crypto", spam: 2, ham: 1},
+		{token: "news", ham: 1},
+	}
+	for _, tt := range tests {
+		counts, ok := f.tokens[tt.token]
+		if !ok {
+			t.Errorf("token %q is unknown", tt.token)
+			continue
+		}
+		if counts.Spam != tt.spam || counts.Ham != tt.ham {
+			t.Errorf("token %q: got %v, want spam %v ham %v", tt.token, counts, tt.spam, tt.ham)
+		}
+	}
+}
+
+func TestSpamProbability(t *testing.T) {
+	f := newTestFilter(t, t.TempDir(), map[string]any{"min_messages": 2, "min_tokens": 2, "max_tokens": 4})
+	t.Cleanup(func() { _ = f.Close() })
+	trainTimes(t, f, events.Spam, spamText, 4)
+	trainTimes(t, f, events.Ham, hamText, 4)
+
+	tests := []struct {
+		name   string
+		tokens []string
+		wantOK bool
+		check  func(p float64) bool
+	}{
+		{name: "spam", tokens: tokenize(spamText), wantOK: true, check: func(p float64) bool { return p > 0.99 }},
+		{name: "ham", tokens: tokenize(hamText), wantOK: true, check: func(p float64) bool { return p < 0.01 }},
+		{
+			name:   "equally spammy and hammy",
+			tokens: []string{"buy", "cheap", "meeting", "tomorrow"},
+			wantOK: true,
+			check:  func(p float64) bool { return math.Abs(p-0.5) < 1e-9 },
+		},
+		{name: "too few known tokens", tokens: []string{"buy", "unknown", "words"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, scores, ok := f.spamProbability(tt.tokens)
+			if ok != tt.wantOK {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if !tt.check(p) {
+				t.Errorf("unexpected probability %v", p)
+			}
+			if len(scores) > f.maxTokens {
+				t.Errorf("got %v tokens, want at most %v", len(scores), f.maxTokens)
+			}
+		})
+	}
+}
+
+func TestMinMessages(t *testing.T) {
+	f := newTestFilter(t, t.TempDir(), map[string]any{"min_messages": 3})
+	t.Cleanup(func() { _ = f.Close() })
+
+	trainTimes(t, f, events.Spam, spamText, 5)
+	trainTimes(t, f, events.Ham, hamText, 2)
+	if got := score(f, spamText); got != 0 {
+		t.Errorf("message was scored with too few ham messages: %v", got)
+	}
+	trainTimes(t, f, events.Ham, hamText, 1)
+	if got := score(f, spamText); got < 90 {
+		t.Errorf("spam was not recognized: %v", got)
+	}
+}
+
+func TestMinTokens(t *testing.T) {
+	f := newTestFilter(t, t.TempDir(), map[string]any{"min_messages": 1, "min_tokens": 3})
+	t.Cleanup(func() { _ = f.Close() })
+	trainTimes(t, f, events.Spam, spamText, 3)
+	trainTimes(t, f, events.Ham, hamText, 3)
+
+	tests := []struct {
+		text   string
+		scored bool
+	}{
+		{text: "buy cheap something else entirely"},
+		{text: "buy cheap crypto and something else", scored: true},
+	}
+	for _, tt := range tests {
+		if got := score(f, tt.text); (got > 0) != tt.scored {
+			t.Errorf("%q: got score %v, want scored %v", tt.text, got, tt.scored)
+		}
+	}
+}
+
+func TestStateIsPersisted(t *testing.T) {
+	configDir := t.TempDir()
+	f := newTestFilter(t, configDir, map[string]any{"min_messages": 1})
+	trainTimes(t, f, events.Spam, spamText, 2)
+	trainTimes(t, f, events.Ham, hamText, 1)
+	want := score(f, spamText)
+	err := f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f = newTestFilter(t, configDir, map[string]any{"min_messages": 1})
+	t.Cleanup(func() { _ = f.Close() })
+	if f.totals.Spam != 2 || f.totals.Ham != 1 || len(f.tokens) != len(tokenize(spamText+" "+hamText)) {
+		t.Errorf("state was not loaded: totals %v, %v tokens", &f.totals, len(f.tokens))
+	}
+	if got := score(f, spamText); got != want || got == 0 {
+		t.Errorf("got score %v after reopening, want %v", got, want)
+	}
+}
+
+func TestReset(t *testing.T) {
+	configDir := t.TempDir()
+	f := newTestFilter(t, configDir, map[string]any{"min_messages": 1})
+	trainTimes(t, f, events.Spam, spamText, 2)
+	trainTimes(t, f, events.Ham, hamText, 2)
+	// Keys that don't belong to the model are kept
+	err := f.db.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("other"), []byte("value"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.reset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.totals.Spam != 0 || f.totals.Ham != 0 || len(f.tokens) != 0 {
+		t.Errorf("model was not reset: totals %v, %v tokens", &f.totals, len(f.tokens))
+	}
+	if got := score(f, spamText); got != 0 {
+		t.Errorf("reset model scored message: %v", got)
+	}
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f = newTestFilter(t, configDir, nil)
+	t.Cleanup(func() { _ = f.Close() })
+	if f.totals.Spam != 0 || len(f.tokens) != 0 {
+		t.Errorf("model was not reset in the database: totals %v, %v tokens", &f.totals, len(f.tokens))
+	}
+	err = f.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("other"))
+		return err
+	})
+	if err != nil {
+		t.Errorf("key that doesn't belong to the model was removed: %v", err)
+	}
+}
+
+func TestLearnsFromHub(t *testing.T) {
+	hub := events.NewHub()
+	r, err := New(zap.NewNop(), interfaces.Deps{Events: hub}, map[string]any{"config_dir": t.TempDir()}, "spam.bayes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.(*Filter)
+	hub.PublishTraining(events.Spam, spamText)
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.PublishTraining(events.Ham, hamText)
+	if f.totals.Spam != 1 || f.totals.Ham != 0 {
+		t.Errorf("got totals %v, want only spam message before close", &f.totals)
+	}
+}
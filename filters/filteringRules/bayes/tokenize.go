@@ -0,0 +1,46 @@
+package bayes
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	minTokenLength = 2
+	// maxTokenLength cuts off long strings of garbage, e.g. base64 or tracking ids in links
+	maxTokenLength = 32
+)
+
+// tokenize returns unique lowercase words of the text, each token is counted only once per message
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]struct{}, len(words))
+	res := make([]string, 0, len(words))
+	for _, w := range words {
+		l := len([]rune(w))
+		if l < minTokenLength || l > maxTokenLength {
+			continue
+		}
+		if _, ok := seen[w]; ok {
+			continue
+		}
+		seen[w] = struct{}{}
+		res = append(res, w)
+	}
+	return res
+}
+
+// logRatio returns log of how much more likely token appears in spam than in ham, Laplace smoothing keeps tokens
+// that were seen only in one class finite
+func logRatio(spam, ham, spamMessages, hamMessages uint64) float64 {
+	pSpam := (float64(spam) + 1) / (float64(spamMessages) + 2)
+	pHam := (float64(ham) + 1) / (float64(hamMessages) + 2)
+	return math.Log(pSpam) - math.Log(pHam)
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
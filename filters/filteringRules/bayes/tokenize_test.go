@@ -0,0 +1,48 @@
+package bayes
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{text: "", want: []string{}},
+		{text: "Buy NOW, buy now!!!", want: []string{"buy", "now"}},
+		{text: "a to be or not", want: []string{"to", "be", "or", "not"}},
+		{text: "Заработок 💰 от 100$", want: []string{"заработок", "от", "100"}},
+		{text: "x aGVsbG8gd29ybGQgaGVsbG8gd29ybGQgaGVsbG8 word", want: []string{"word"}},
+	}
+	for _, tt := range tests {
+		got := tokenize(tt.text)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLogRatio(t *testing.T) {
+	tests := []struct {
+		name                                 string
+		spam, ham, spamMessages, hamMessages uint64
+		want                                 float64
+	}{
+		{name: "unknown token", want: 0},
+		{name: "equally common", spam: 5, ham: 5, spamMessages: 10, hamMessages: 10, want: 0},
+		{name: "only in spam", spam: 8, spamMessages: 8, hamMessages: 8, want: math.Log(9) - math.Log(1)},
+		{name: "only in ham", ham: 8, spamMessages: 8, hamMessages: 8, want: math.Log(1) - math.Log(9)},
+		{name: "different number of messages", spam: 1, ham: 1, spamMessages: 2, hamMessages: 8, want: math.Log(2.0/4) - math.Log(2.0/10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := logRatio(tt.spam, tt.ham, tt.spamMessages, tt.hamMessages)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package composite
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/scoring"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+var (
+	ErrRequiresRules   = errors.New("composite rule requires non-empty `rules` parameter")
+	ErrNotRequiresOne  = errors.New("`not` requires exactly one nested rule")
+	ErrNOutOfRange     = errors.New("`n` must be between 1 and number of nested rules")
+	ErrRulesNotAList   = errors.New("`rules` must be a list of filtering rules")
+	ErrUnknownOperator = errors.New("unknown composite operator")
+)
+
+type Operator string
+
+const (
+	AllOf   Operator = "allOf"
+	AnyOf   Operator = "anyOf"
+	Not     Operator = "not"
+	AtLeast Operator = "atLeast"
+)
+
+// Operators lists all supported composite rules
+var Operators = []Operator{AllOf, AnyOf, Not, AtLeast}
+
+// RuleBuilder creates nested rule with the given unique name from its configuration
+type RuleBuilder func(logger *zap.Logger, deps interfaces.Deps, name string, cfg config.StatelessFilteringRules) (interfaces.FilteringRule, error)
+
+// Filter combines scores of nested rules. Nested rule matches if it gives positive score.
+//
+// allOf and atLeast match if at least n nested rules match and score with the lowest of n highest scores, so the
+// composite is as confident as its least confident required part. anyOf is atLeast with n=1. not scores 100 if its
+// only nested rule doesn't match.
+type Filter struct {
+	logger    *zap.Logger
+	chainName string
+	operator  Operator
+	n         int
+	isFinal   bool
+	rules     []interfaces.FilteringRule
+
+	tg.TGHaveAdminCommands
+}
+
+func parseRules(v any) ([]config.StatelessFilteringRules, error) {
+	if _, ok := v.([]any); !ok {
+		return nil, ErrRulesNotAList
+	}
+	// Nested rules are decoded as generic maps, round-trip makes them use the same schema as top-level ones
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var res []config.StatelessFilteringRules
+	err = yaml.Unmarshal(b, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NewInitFunc returns InitFunc for the operator that uses build to create nested rules
+func NewInitFunc(operator Operator, build RuleBuilder) interfaces.InitFunc {
+	return func(logger *zap.Logger, deps interfaces.Deps, cfg map[string]any, chainName string) (interfaces.FilteringRule, error) {
+		return New(logger, deps, operator, build, cfg, chainName)
+	}
+}
+
+func New(logger *zap.Logger, deps interfaces.Deps, operator Operator, build RuleBuilder, cfg map[string]any, chainName string) (interfaces.FilteringRule, error) {
+	logger = logger.With(zap.String("filter", chainName), zap.String("filter_type", string(operator)))
+	isFinal, err := config2.GetOptionBoolWithDefault(cfg, "isFinal", false)
+	if err != nil {
+		return nil, err
+	}
+
+	rulesCfg, err := parseRules(cfg["rules"])
+	if err != nil {
+		return nil, err
+	}
+	if len(rulesCfg) == 0 {
+		return nil, ErrRequiresRules
+	}
+
+	var n int
+	switch operator {
+	case AllOf:
+		n = len(rulesCfg)
+	case AnyOf:
+		n = 1
+	case Not:
+		if len(rulesCfg) != 1 {
+			return nil, ErrNotRequiresOne
+		}
+	case AtLeast:
+		n, err = config2.GetOptionInt(cfg, "n")
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 || n > len(rulesCfg) {
+			return nil, ErrNOutOfRange
+		}
+	default:
+		return nil, ErrUnknownOperator
+	}
+
+	f := &Filter{
+		logger:    logger,
+		chainName: chainName,
+		operator:  operator,
+		n:         n,
+		isFinal:   isFinal,
+		rules:     make([]interfaces.FilteringRule, 0, len(rulesCfg)),
+		TGHaveAdminCommands: tg.TGHaveAdminCommands{
+			Handlers: make(map[string]tg.AdminCMDHandlerFunc),
+		},
+	}
+	ruleTypes := make([]string, 0, len(rulesCfg))
+	for _, ruleCfg := range rulesCfg {
+		ruleTypes = append(ruleTypes, ruleCfg.Name)
+	}
+	names := interfaces.RuleNames(chainName, ruleTypes)
+	for i, ruleCfg := range rulesCfg {
+		r, err := build(logger, deps, names[i], ruleCfg)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		f.rules = append(f.rules, r)
+		prefix := r.TGAdminPrefix()
+		if prefix != "" {
+			f.Handlers[interfaces.LocalPrefix(chainName, prefix)] = r.HandleTGCommands
+		}
+	}
+
+	return f, nil
+}
+
+func Help() string {
+	return "allOf, anyOf, atLeast and not combine nested rules specified in `rules` parameter, atLeast requires `n` parameter"
+}
+
+func (r *Filter) Score(bot botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	res := &scoringResult.ScoringResult{}
+	if r.operator == Not {
+		score := r.rules[0].Score(bot, msg)
+		if score.Score <= 0 {
+			res.Score = scoring.MaxScore
+			res.Reason = fmt.Sprintf("%v did not match", scoring.DisplayName(r.rules[0]))
+		}
+		return res
+	}
+
+	scores := make([]int32, 0, len(r.rules))
+	buf := bytes.NewBuffer([]byte{})
+	for _, rule := range r.rules {
+		score := rule.Score(bot, msg)
+		if score.Score <= 0 {
+			continue
+		}
+		scores = append(scores, score.Score)
+		if buf.Len() > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(fmt.Sprintf("%v: %v", scoring.DisplayName(rule), score.Reason))
+	}
+	if len(scores) < r.n {
+		return res
+	}
+
+	sort.Slice(scores, func(i, j int) bool { return scores[i] > scores[j] })
+	res.Score = scores[r.n-1]
+	res.Reason = fmt.Sprintf("%v matched: %v", r.operator, buf.String())
+	return res
+}
+
+func (r *Filter) IsStateful() bool {
+	return false
+}
+
+func (r *Filter) GetName() string {
+	return string(r.operator)
+}
+
+func (r *Filter) GetFilterName() string {
+	return ""
+}
+
+func (r *Filter) IsFinal() bool {
+	return r.isFinal
+}
+
+func (r *Filter) Close() error {
+	return interfaces.CloseRules(r.rules)
+}
+
+// TGAdminPrefix is set only if any of nested rules have admin commands, they are available as sub-commands
+func (r *Filter) TGAdminPrefix() string {
+	if len(r.Handlers) == 0 {
+		return ""
+	}
+	return r.chainName
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
 )
 
@@ -23,7 +24,7 @@ type Filter struct {
 
 var ErrThresholdTooLow = errors.New("threshold for number of emojis must be positive")
 
-func New(logger *zap.Logger, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
+func New(logger *zap.Logger, _ interfaces.Deps, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
 	logger = logger.With(zap.String("filter", chainName), zap.String("filter_type", "hasEmoji"))
 	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
 	if err != nil {
@@ -55,7 +56,7 @@ func Help() string {
 	return "hasEmoji checks if the message has too much emoji or stickers"
 }
 
-func (r *Filter) Score(_ *telego.Bot, msg *telego.Message) *scoringResult.ScoringResult {
+func (r *Filter) Score(_ botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
 	res := &scoringResult.ScoringResult{}
 	var linkCount int
 	for _, entity := range msg.Entities {
@@ -91,6 +92,6 @@ func (r *Filter) TGAdminPrefix() string {
 	return ""
 }
 
-func (r *Filter) HandleTGCommands(_ *zap.Logger, _ *telego.Bot, _ *telego.Message, _ []string) error {
+func (r *Filter) HandleTGCommands(_ *zap.Logger, _ botAPI.BotAPI, _ *telego.Message, _ []string) error {
 	return nil
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
 )
 
@@ -24,7 +25,7 @@ type Filter struct {
 
 var ErrThresholdTooLow = errors.New("threshold for number of links must be positive")
 
-func New(logger *zap.Logger, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
+func New(logger *zap.Logger, _ interfaces.Deps, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
 	logger = logger.With(zap.String("filter", chainName), zap.String("filter_type", "hasLinks"))
 	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
 	if err != nil {
@@ -66,7 +67,7 @@ func Help() string {
 	return "hasLinks checks if the message have too many links/emails/mentions"
 }
 
-func (r *Filter) Score(bot *telego.Bot, msg *telego.Message) *scoringResult.ScoringResult {
+func (r *Filter) Score(bot botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
 	defer func() {
 		if rec := recover(); rec != nil {
 			r.logger.Error("panic in f", zap.Any("panic", rec))
@@ -141,6 +142,6 @@ func (r *Filter) TGAdminPrefix() string {
 	return ""
 }
 
-func (r *Filter) HandleTGCommands(_ *zap.Logger, _ *telego.Bot, _ *telego.Message, _ []string) error {
+func (r *Filter) HandleTGCommands(_ *zap.Logger, _ botAPI.BotAPI, _ *telego.Message, _ []string) error {
 	return nil
 }
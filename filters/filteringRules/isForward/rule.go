@@ -6,6 +6,7 @@ import (
 
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
 )
 
@@ -15,7 +16,7 @@ type Filter struct {
 	isFinal   bool
 }
 
-func New(logger *zap.Logger, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
+func New(logger *zap.Logger, _ interfaces.Deps, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
 	logger = logger.With(zap.String("filter", chainName), zap.String("filter_type", "isForward"))
 	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
 	if err != nil {
@@ -33,7 +34,7 @@ func Help() string {
 	return "isForward checks if the message is forwarded"
 }
 
-func (r *Filter) Score(_ *telego.Bot, msg *telego.Message) *scoringResult.ScoringResult {
+func (r *Filter) Score(_ botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
 	res := &scoringResult.ScoringResult{}
 	if msg.ForwardOrigin != nil {
 		res.Reason = "this message have forwardOrigin (is forwarded)"
@@ -62,6 +63,6 @@ func (r *Filter) TGAdminPrefix() string {
 	return ""
 }
 
-func (r *Filter) HandleTGCommands(_ *zap.Logger, _ *telego.Bot, _ *telego.Message, _ []string) error {
+func (r *Filter) HandleTGCommands(_ *zap.Logger, _ botAPI.BotAPI, _ *telego.Message, _ []string) error {
 	return nil
 }
@@ -0,0 +1,110 @@
+package nearDuplicate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/stateful"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+func reply(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, text string) error {
+	err := tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, text)
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
+
+func (r *Filter) tgList(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	r.RLock()
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString(fmt.Sprintf("Known spam fingerprints (%v), threshold is %v%%:\n\n", len(r.fingerprints), r.currentThreshold()))
+	for _, fp := range r.fingerprints {
+		buf.WriteString(fmt.Sprintf("%016x - %v, %v:\n   %v\n", fp.Hash, fp.GetAddedAt().AsTime().Format(time.RFC3339),
+			fp.Source, fp.Excerpt))
+	}
+	r.RUnlock()
+	return reply(logger, bot, message, buf.String())
+}
+
+func (r *Filter) tgAdd(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	if message.ReplyToMessage == nil {
+		return reply(logger, bot, message, "Reply to a spam message to add its fingerprint")
+	}
+	fp, err := r.add(tg.MessageExcerpt(message.ReplyToMessage), fmt.Sprintf("added by admin %v", message.From.ID))
+	switch {
+	case errors.Is(err, ErrTooShort):
+		return reply(logger, bot, message, fmt.Sprintf("Message is too short, it must have at least %v letters or digits", r.minLength))
+	case errors.Is(err, ErrFingerprintDuplicate):
+		return reply(logger, bot, message, fmt.Sprintf("Similar fingerprint already exists: %016x", fp.Hash))
+	case err != nil:
+		logger.Error("failed to add fingerprint", zap.Error(err))
+		return err
+	}
+	return reply(logger, bot, message, fmt.Sprintf("Added fingerprint %016x", fp.Hash))
+}
+
+func (r *Filter) tgDel(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	if len(tokens) < 1 {
+		logger.Warn("invalid command", zap.Strings("tokens", tokens))
+		return stateful.ErrInvalidCommand
+	}
+	hash, err := strconv.ParseUint(tokens[0], 16, 64)
+	if err != nil {
+		logger.Warn("invalid fingerprint", zap.Strings("tokens", tokens), zap.Error(err))
+		return stateful.ErrInvalidCommand
+	}
+	err = r.remove(hash)
+	if errors.Is(err, ErrFingerprintNotFound) {
+		return reply(logger, bot, message, fmt.Sprintf("Fingerprint not found: %v", tokens[0]))
+	}
+	if err != nil {
+		logger.Error("failed to remove fingerprint", zap.Error(err))
+		return err
+	}
+	return reply(logger, bot, message, "Done")
+}
+
+func (r *Filter) tgThreshold(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	if len(tokens) == 0 {
+		r.RLock()
+		threshold := r.currentThreshold()
+		r.RUnlock()
+		return reply(logger, bot, message, fmt.Sprintf("Threshold is %v%%", threshold))
+	}
+	threshold, err := strconv.Atoi(tokens[0])
+	if err != nil || threshold <= 0 || threshold > 100 {
+		logger.Warn("invalid threshold", zap.Strings("tokens", tokens))
+		return ErrThresholdInvalid
+	}
+	err = r.setThreshold(threshold)
+	if err != nil {
+		logger.Error("failed to save threshold", zap.Error(err))
+		return err
+	}
+	return reply(logger, bot, message, fmt.Sprintf("Threshold is set to %v%%", threshold))
+}
+
+func (r *Filter) tgHelp(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("Available commands:\n")
+	buf.WriteString(" - `list` - list fingerprints of known spam\n")
+	buf.WriteString(" - `add` - add fingerprint of the message, command must be a reply to it\n")
+	buf.WriteString(" - `del <fingerprint>` - remove fingerprint\n")
+	buf.WriteString(" - `threshold [percent]` - show or set minimal similarity to known spam\n")
+	buf.WriteString(" - `help` - this help\n")
+
+	err := tg.SendMarkdownMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
@@ -0,0 +1,394 @@
+package nearDuplicate
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/nearDuplicateState"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/textnorm"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+var (
+	ErrConfigDirEmpty       = errors.New("config_dir cannot be empty")
+	ErrThresholdInvalid     = errors.New("threshold must be between 1 and 100")
+	ErrMaxFingerprints      = errors.New("max_fingerprints must be positive")
+	ErrTTLInvalid           = errors.New("ttl must be positive")
+	ErrMinLengthNegative    = errors.New("min_length cannot be negative")
+	ErrFingerprintNotFound  = errors.New("fingerprint not found")
+	ErrFingerprintDuplicate = errors.New("similar fingerprint already exists")
+	ErrTooShort             = errors.New("message is too short")
+)
+
+const prefixFingerprint byte = 'f'
+
+var settingsKey = []byte("settings")
+
+// Filter scores messages that are similar to known spam. Fingerprints are learnt from messages of banned users and
+// added by admins, they are forgotten after ttl or once there are more than max_fingerprints of them.
+type Filter struct {
+	sync.RWMutex
+	logger    *zap.Logger
+	chainName string
+
+	db *badger.DB
+	// fingerprints are ordered by time they were added
+	fingerprints []*nearDuplicateState.Fingerprint
+	settings     nearDuplicateState.Settings
+
+	threshold       int
+	maxFingerprints int
+	ttl             time.Duration
+	minLength       int
+	isFinal         bool
+	// normalize enables fingerprinting normalized text, see textnorm.Normalize
+	normalize bool
+
+	stopObserving func()
+
+	tg.TGHaveAdminCommands
+}
+
+func New(logger *zap.Logger, deps interfaces.Deps, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
+	logger = logger.With(zap.String("filter", chainName), zap.String("filter_type", "nearDuplicate"))
+	configDir, err := config2.GetOptionString(config, "config_dir")
+	if err != nil {
+		return nil, err
+	}
+	if configDir == "" {
+		return nil, ErrConfigDirEmpty
+	}
+
+	threshold, err := config2.GetOptionIntWithDefault(config, "threshold", 90)
+	if err != nil {
+		return nil, err
+	}
+	if threshold <= 0 || threshold > 100 {
+		return nil, ErrThresholdInvalid
+	}
+
+	maxFingerprints, err := config2.GetOptionIntWithDefault(config, "max_fingerprints", 1000)
+	if err != nil {
+		return nil, err
+	}
+	if maxFingerprints <= 0 {
+		return nil, ErrMaxFingerprints
+	}
+
+	ttl, err := config2.GetOptionDurationWithDefault(config, "ttl", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, ErrTTLInvalid
+	}
+
+	minLength, err := config2.GetOptionIntWithDefault(config, "min_length", 20)
+	if err != nil {
+		return nil, err
+	}
+	if minLength < 0 {
+		return nil, ErrMinLengthNegative
+	}
+
+	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
+	if err != nil {
+		return nil, err
+	}
+
+	learnFromBans, err := config2.GetOptionBoolWithDefault(config, "learnFromBans", true)
+	if err != nil {
+		return nil, err
+	}
+
+	normalize, err := config2.GetOptionBoolWithDefault(config, "normalize", false)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := badgerOpts.Open(logger, chainName+"_DB", configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		logger:          logger,
+		chainName:       chainName,
+		db:              db,
+		threshold:       threshold,
+		maxFingerprints: maxFingerprints,
+		ttl:             ttl,
+		minLength:       minLength,
+		isFinal:         isFinal,
+		normalize:       normalize,
+	}
+	err = f.load()
+	if err != nil {
+		_ = badgerOpts.Close(db)
+		return nil, err
+	}
+
+	if learnFromBans {
+		// Bans that were issued before the rule was enabled are used only once, later admins may remove fingerprints
+		// that they don't want to be restored
+		if len(f.fingerprints) == 0 {
+			err = deps.Events.ForEachBan(f.learn)
+			if err != nil {
+				logger.Error("failed to learn from existing bans", zap.Error(err))
+			}
+		}
+		f.stopObserving = deps.Events.ObserveBans(f.learn)
+	}
+
+	f.TGHaveAdminCommands.Handlers = map[string]tg.AdminCMDHandlerFunc{
+		"list":      f.tgList,
+		"add":       f.tgAdd,
+		"del":       f.tgDel,
+		"threshold": f.tgThreshold,
+		"help":      f.tgHelp,
+	}
+	return f, nil
+}
+
+func Help() string {
+	return "nearDuplicate requires `config_dir` parameter, optional: `threshold` (minimal similarity to known spam in percents, default 90), `max_fingerprints` (default 1000), `ttl` (default 30d), `min_length` (shorter texts are ignored, default 20), `learnFromBans` (remember messages of banned users, default true), `normalize` (compare text with homoglyphs and invisible characters normalized, default false)"
+}
+
+func fingerprintKey(hash uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte{prefixFingerprint}, hash)
+}
+
+func (r *Filter) load() error {
+	return r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(settingsKey)
+		if err == nil {
+			err = item.Value(func(val []byte) error {
+				return proto.Unmarshal(val, &r.settings)
+			})
+		}
+		if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte{prefixFingerprint}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var fp nearDuplicateState.Fingerprint
+			err := it.Item().Value(func(val []byte) error {
+				return proto.Unmarshal(val, &fp)
+			})
+			if err != nil {
+				return err
+			}
+			r.fingerprints = append(r.fingerprints, &fp)
+		}
+		slices.SortFunc(r.fingerprints, func(a, b *nearDuplicateState.Fingerprint) int {
+			return a.GetAddedAt().AsTime().Compare(b.GetAddedAt().AsTime())
+		})
+		return nil
+	})
+}
+
+// currentThreshold must be called with mutex held
+func (r *Filter) currentThreshold() int {
+	if r.settings.Threshold != 0 {
+		return int(r.settings.Threshold)
+	}
+	return r.threshold
+}
+
+// closest returns the most similar fingerprint that is not expired. Must be called with mutex held.
+func (r *Filter) closest(hash uint64) (*nearDuplicateState.Fingerprint, int) {
+	var (
+		best    *nearDuplicateState.Fingerprint
+		bestSim int
+	)
+	cutoff := time.Now().Add(-r.ttl)
+	for _, fp := range r.fingerprints {
+		if fp.GetAddedAt().AsTime().Before(cutoff) {
+			continue
+		}
+		sim := similarity(hash, fp.Hash)
+		if sim > bestSim {
+			best, bestSim = fp, sim
+		}
+	}
+	return best, bestSim
+}
+
+// canonical returns the form of the text that is fingerprinted
+func (r *Filter) canonical(text string) string {
+	if r.normalize {
+		text = textnorm.Normalize(text)
+	}
+	return normalize(text)
+}
+
+// add stores fingerprint of the text unless similar one is already known, the oldest fingerprints are removed to
+// keep their number within the limit
+func (r *Filter) add(text, source string) (*nearDuplicateState.Fingerprint, error) {
+	normalized := r.canonical(text)
+	if len([]rune(normalized)) < r.minLength {
+		return nil, ErrTooShort
+	}
+	fp := &nearDuplicateState.Fingerprint{
+		Hash:    simhash(normalized),
+		Excerpt: text,
+		Source:  source,
+		AddedAt: timestamppb.Now(),
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	if existing, sim := r.closest(fp.Hash); existing != nil && sim >= r.currentThreshold() {
+		return existing, ErrFingerprintDuplicate
+	}
+
+	// Expired ones are removed by badger
+	cutoff := time.Now().Add(-r.ttl)
+	r.fingerprints = slices.DeleteFunc(r.fingerprints, func(fp *nearDuplicateState.Fingerprint) bool {
+		return fp.GetAddedAt().AsTime().Before(cutoff)
+	})
+	evicted := make([]*nearDuplicateState.Fingerprint, 0)
+	if len(r.fingerprints) >= r.maxFingerprints {
+		n := len(r.fingerprints) - r.maxFingerprints + 1
+		evicted = append(evicted, r.fingerprints[:n]...)
+	}
+
+	b, err := proto.Marshal(fp)
+	if err != nil {
+		return nil, err
+	}
+	err = r.db.Update(func(txn *badger.Txn) error {
+		for _, e := range evicted {
+			err := txn.Delete(fingerprintKey(e.Hash))
+			if err != nil {
+				return err
+			}
+		}
+		return txn.SetEntry(badger.NewEntry(fingerprintKey(fp.Hash), b).WithTTL(r.ttl))
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.fingerprints = append(r.fingerprints[len(evicted):], fp)
+	return fp, nil
+}
+
+// learn remembers message of the banned user
+func (r *Filter) learn(userID int64, record *banRecord.BanRecord) {
+	if record.GetMessageExcerpt() == "" {
+		return
+	}
+	source := fmt.Sprintf("user %v banned by %v", userID, record.GetChainName())
+	if record.GetAdminId() != 0 {
+		source = fmt.Sprintf("user %v banned by admin %v", userID, record.GetAdminId())
+	}
+	_, err := r.add(record.GetMessageExcerpt(), source)
+	if err != nil && !errors.Is(err, ErrFingerprintDuplicate) && !errors.Is(err, ErrTooShort) {
+		r.logger.Error("failed to add fingerprint", zap.Int64("user_id", userID), zap.Error(err))
+	}
+}
+
+func (r *Filter) remove(hash uint64) error {
+	r.Lock()
+	defer r.Unlock()
+	i := slices.IndexFunc(r.fingerprints, func(fp *nearDuplicateState.Fingerprint) bool {
+		return fp.Hash == hash
+	})
+	if i == -1 {
+		return ErrFingerprintNotFound
+	}
+	err := r.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(fingerprintKey(hash))
+	})
+	if err != nil {
+		return err
+	}
+	r.fingerprints = slices.Delete(r.fingerprints, i, i+1)
+	return nil
+}
+
+func (r *Filter) setThreshold(threshold int) error {
+	r.Lock()
+	defer r.Unlock()
+	settings := &nearDuplicateState.Settings{Threshold: uint32(threshold)}
+	b, err := proto.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	err = r.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(settingsKey, b)
+	})
+	if err != nil {
+		return err
+	}
+	r.settings.Threshold = settings.Threshold
+	return nil
+}
+
+func (r *Filter) Score(_ botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	res := &scoringResult.ScoringResult{}
+	// Fingerprints are built from excerpts of banned messages, so incoming ones are truncated the same way
+	normalized := r.canonical(tg.MessageExcerpt(msg))
+	if len([]rune(normalized)) < r.minLength {
+		return res
+	}
+	hash := simhash(normalized)
+
+	r.RLock()
+	defer r.RUnlock()
+	fp, sim := r.closest(hash)
+	if fp == nil || sim < r.currentThreshold() {
+		return res
+	}
+	r.logger.Debug("message is similar to known spam", zap.Int("similarity", sim), zap.String("source", fp.Source))
+	res.Score = 100
+	res.Reason = fmt.Sprintf("Message is %v%% similar to a known spam:\n```%v```", sim, fp.Excerpt)
+	return res
+}
+
+func (r *Filter) IsStateful() bool {
+	return false
+}
+
+func (r *Filter) GetName() string {
+	return "nearDuplicate"
+}
+
+func (r *Filter) GetFilterName() string {
+	return ""
+}
+
+func (r *Filter) IsFinal() bool {
+	return r.isFinal
+}
+
+func (r *Filter) TGAdminPrefix() string {
+	return r.chainName
+}
+
+func (r *Filter) Close() error {
+	if r.stopObserving != nil {
+		r.stopObserving()
+	}
+	return badgerOpts.Close(r.db)
+}
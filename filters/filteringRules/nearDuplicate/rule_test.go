@@ -0,0 +1,79 @@
+package nearDuplicate
+
+import (
+	"testing"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+)
+
+const spamText = "earn from 500 dollars a day working from home, write to me in private messages"
+
+func TestLearnsFromBansOfTheHub(t *testing.T) {
+	banDB, err := bannedDB.New(zap.NewNop(), map[string]any{"state_dir": t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = banDB.Close() })
+	hub := events.NewHub()
+	banDB.SetEvents(hub)
+
+	// Ban issued before the rule was created is learnt from the history
+	err = banDB.BanUser(1, &banRecord.BanRecord{ChainName: "spam", MessageExcerpt: spamText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := New(zap.NewNop(), interfaces.Deps{Events: hub}, map[string]any{"config_dir": t.TempDir()}, "spam.nearDuplicate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := r.(*Filter)
+	t.Cleanup(func() { _ = f.Close() })
+	if len(f.fingerprints) != 1 {
+		t.Fatalf("got %v fingerprints from history, want 1", len(f.fingerprints))
+	}
+
+	const other = "the best crypto signals channel, join now and get rich in a week"
+	err = banDB.BanUser(2, &banRecord.BanRecord{ChainName: "spam", MessageExcerpt: other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	score := f.Score(nil, &telego.Message{Text: other})
+	if score.Score != 100 {
+		t.Errorf("message of the banned user is not recognized: %+v", score)
+	}
+}
+
+func TestNormalizedTextIsCompared(t *testing.T) {
+	// Latin letters of words are replaced by Cyrillic homoglyphs and words are split by zero-width spaces
+	const obfuscated = "еаrn frоm 500 dоllаrs a dау wоrking frоm hоmе, wri​te to me in priv​ate mess​ages"
+	tests := []struct {
+		normalize bool
+		want      int32
+	}{
+		{normalize: false, want: 0},
+		{normalize: true, want: 100},
+	}
+	for _, tt := range tests {
+		r, err := New(zap.NewNop(), interfaces.Deps{},
+			map[string]any{"config_dir": t.TempDir(), "normalize": tt.normalize}, "spam.nearDuplicate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := r.(*Filter)
+		_, err = f.add(spamText, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		score := f.Score(nil, &telego.Message{Text: obfuscated})
+		if score.Score != tt.want {
+			t.Errorf("normalize %v: got score %v, want %v", tt.normalize, score.Score, tt.want)
+		}
+		_ = f.Close()
+	}
+}
@@ -0,0 +1,57 @@
+package nearDuplicate
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// shingleLength is a number of runes in a feature, short shingles make fingerprint tolerant to small edits
+const shingleLength = 4
+
+// normalize lowercases text and keeps only letters and digits separated by single spaces
+func normalize(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// simhash returns 64-bit SimHash of normalized text built from its character shingles. Similar texts have
+// fingerprints that differ in a few bits.
+func simhash(normalized string) uint64 {
+	runes := []rune(normalized)
+	var weights [64]int
+	add := func(shingle []rune) {
+		h := fnv.New64a()
+		h.Write([]byte(string(shingle)))
+		v := h.Sum64()
+		for i := range weights {
+			if v&(1<<i) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	if len(runes) <= shingleLength {
+		add(runes)
+	}
+	for i := 0; i+shingleLength <= len(runes); i++ {
+		add(runes[i : i+shingleLength])
+	}
+
+	var res uint64
+	for i, w := range weights {
+		if w > 0 {
+			res |= 1 << i
+		}
+	}
+	return res
+}
+
+// similarity returns share of equal bits of the fingerprints in percents
+func similarity(a, b uint64) int {
+	return 100 * (64 - bits.OnesCount64(a^b)) / 64
+}
@@ -0,0 +1,64 @@
+package nearDuplicate
+
+import (
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "", want: ""},
+		{text: "Hello, World!", want: "hello world"},
+		{text: "  many\n\nspaces\t", want: "many spaces"},
+		{text: "Заработок 💰 от 100$ в день", want: "заработок от 100 в день"},
+	}
+	for _, tt := range tests {
+		if got := normalize(tt.text); got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	const spam = "earn from 500 dollars a day working from home, write to me in private messages"
+	tests := []struct {
+		name    string
+		a, b    string
+		atLeast int
+		below   int
+	}{
+		{name: "same text", a: spam, b: spam, atLeast: 100, below: 101},
+		{name: "small edit", a: spam, b: "earn from 700 dollars a day working from home, write me in private messages",
+			atLeast: 80, below: 101},
+		{name: "unrelated text", a: spam, b: "the meeting is moved to thursday, the agenda is in the shared folder",
+			atLeast: 0, below: 80},
+		{name: "short text", a: "hi", b: "hi", atLeast: 100, below: 101},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sim := similarity(simhash(normalize(tt.a)), simhash(normalize(tt.b)))
+			if sim < tt.atLeast || sim >= tt.below {
+				t.Errorf("got similarity %v, want within [%v, %v)", sim, tt.atLeast, tt.below)
+			}
+		})
+	}
+}
+
+func TestSimilarityOfFingerprints(t *testing.T) {
+	tests := []struct {
+		a, b uint64
+		want int
+	}{
+		{a: 0, b: 0, want: 100},
+		{a: 0, b: ^uint64(0), want: 0},
+		{a: 0, b: 0xFFFFFFFF, want: 50},
+		{a: 0xF0, b: 0xF1, want: 98},
+	}
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("similarity(%x, %x) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/textnorm"
 )
 
 var (
@@ -27,9 +29,11 @@ type Filter struct {
 	partialMatch  string
 	caseSensitive bool
 	isFinal       bool
+	// normalizedMatch is set if matching against normalized text is enabled, see textnorm.Normalize
+	normalizedMatch string
 }
 
-func New(logger *zap.Logger, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
+func New(logger *zap.Logger, _ interfaces.Deps, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
 	logger = logger.With(zap.String("filter", chainName), zap.String("filter_type", "partialMatch"))
 	filter, err := config2.GetOptionString(config, "match")
 	if err != nil {
@@ -53,24 +57,43 @@ func New(logger *zap.Logger, config map[string]any, chainName string) (interface
 		}
 	}
 
+	normalize, err := config2.GetOptionBoolWithDefault(config, "normalize", false)
+	if err != nil {
+		return nil, err
+	}
+	normalizedMatch := ""
+	if normalize {
+		normalizedMatch = textnorm.Normalize(filter)
+	}
+
 	return &Filter{
-		logger:        logger,
-		chainName:     chainName,
-		partialMatch:  filter,
-		caseSensitive: caseSensitive,
-		isFinal:       isFinal,
+		logger:          logger,
+		chainName:       chainName,
+		partialMatch:    filter,
+		caseSensitive:   caseSensitive,
+		isFinal:         isFinal,
+		normalizedMatch: normalizedMatch,
 	}, nil
 }
 
 func Help() string {
-	return "partialMatch requires `match` parameter"
+	return "partialMatch requires `match` parameter, optional: `normalize` (also match text with homoglyphs and invisible characters normalized, default false)"
 }
 
-func (r *Filter) Score(_ *telego.Bot, msg *telego.Message) *scoringResult.ScoringResult {
+func (r *Filter) Score(_ botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
 	res := &scoringResult.ScoringResult{}
 	if strings.Contains(msg.Caption, r.partialMatch) || strings.Contains(msg.Text, r.partialMatch) {
 		res.Reason = fmt.Sprintf("Partial match found: %s", r.partialMatch)
 		res.Score = 100
+		return res
+	}
+	if r.normalizedMatch == "" {
+		return res
+	}
+	if strings.Contains(textnorm.Normalize(msg.Caption), r.normalizedMatch) ||
+		strings.Contains(textnorm.Normalize(msg.Text), r.normalizedMatch) {
+		res.Reason = fmt.Sprintf("Partial match found in normalized text: %s", r.partialMatch)
+		res.Score = 100
 	}
 	return res
 }
@@ -95,6 +118,6 @@ func (r *Filter) TGAdminPrefix() string {
 	return ""
 }
 
-func (r *Filter) HandleTGCommands(_ *zap.Logger, _ *telego.Bot, _ *telego.Message, _ []string) error {
+func (r *Filter) HandleTGCommands(_ *zap.Logger, _ botAPI.BotAPI, _ *telego.Message, _ []string) error {
 	return nil
 }
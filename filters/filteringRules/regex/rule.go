@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
@@ -13,11 +14,15 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/Civil/tg-simple-regex-antispam/audit"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/regexConfig"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
 	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/textnorm"
 	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
 )
 
@@ -36,14 +41,17 @@ type Filter struct {
 	regex         []*regexp.Regexp
 	isFinal       bool
 	caseSensitive bool
+	// normalize enables matching against normalized text as well, see textnorm.Normalize
+	normalize bool
 
 	configDB *badger.DB
 	reConfig regexConfig.Config
+	auditLog *audit.Log
 
 	tg.TGHaveAdminCommands
 }
 
-func New(logger *zap.Logger, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
+func New(logger *zap.Logger, deps interfaces.Deps, config map[string]any, chainName string) (interfaces.FilteringRule, error) {
 	logger = logger.With(zap.String("filter", chainName), zap.String("filter_type", "regex"))
 	configDir, err := config2.GetOptionString(config, "config_dir")
 	if err != nil {
@@ -52,17 +60,22 @@ func New(logger *zap.Logger, config map[string]any, chainName string) (interface
 	if configDir == "" {
 		return nil, ErrConfigDirEmpty
 	}
-	configDB, err := badger.Open(badgerOpts.GetBadgerOptions(logger, chainName+"_DB", configDir))
+	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
 	if err != nil {
 		return nil, err
 	}
 
-	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
+	caseSensitive, err := config2.GetOptionBoolWithDefault(config, "caseSensetive", false)
 	if err != nil {
 		return nil, err
 	}
 
-	caseSensitive, err := config2.GetOptionBoolWithDefault(config, "caseSensetive", false)
+	normalize, err := config2.GetOptionBoolWithDefault(config, "normalize", false)
+	if err != nil {
+		return nil, err
+	}
+
+	configDB, err := badgerOpts.Open(logger, chainName+"_DB", configDir)
 	if err != nil {
 		return nil, err
 	}
@@ -72,13 +85,16 @@ func New(logger *zap.Logger, config map[string]any, chainName string) (interface
 		chainName:           chainName,
 		isFinal:             isFinal,
 		caseSensitive:       caseSensitive,
+		normalize:           normalize,
 		regex:               make([]*regexp.Regexp, 0),
 		TGHaveAdminCommands: tg.TGHaveAdminCommands{},
 		configDB:            configDB,
+		auditLog:            deps.Audit,
 	}
 
 	err = res.loadConfig()
 	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		_ = badgerOpts.Close(configDB)
 		return nil, err
 	}
 	uniqueRegex := make(map[string]struct{})
@@ -109,21 +125,19 @@ func New(logger *zap.Logger, config map[string]any, chainName string) (interface
 }
 
 func Help() string {
-	return "regex requires `config_dir` parameter"
+	return "regex requires `config_dir` parameter, optional: `normalize` (also match text with homoglyphs and invisible characters normalized, default false)"
 }
 
-func (r *Filter) Score(_ *telego.Bot, msg *telego.Message) *scoringResult.ScoringResult {
-	var (
-		text    string
-		caption string
-		res     scoringResult.ScoringResult
-	)
-	if r.caseSensitive {
-		text = msg.Text
-		caption = msg.Caption
-	} else {
-		text = strings.ToLower(msg.Text)
-		caption = strings.ToLower(msg.Caption)
+func (r *Filter) Score(_ botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	var res scoringResult.ScoringResult
+	texts := []string{msg.Caption, msg.Text}
+	if r.normalize {
+		texts = append(textnorm.Variants(msg.Caption), textnorm.Variants(msg.Text)...)
+	}
+	if !r.caseSensitive {
+		for i := range texts {
+			texts[i] = strings.ToLower(texts[i])
+		}
 	}
 	r.RLock()
 	defer r.RUnlock()
@@ -132,7 +146,7 @@ func (r *Filter) Score(_ *telego.Bot, msg *telego.Message) *scoringResult.Scorin
 	}
 
 	for _, re := range r.regex {
-		if re.MatchString(caption) || re.MatchString(text) {
+		if slices.ContainsFunc(texts, re.MatchString) {
 			r.logger.Debug("regex match found", zap.String("regex", re.String()))
 
 			res.Reason = fmt.Sprintf("Regex that matched:\n```%v```", re.String())
@@ -159,7 +173,7 @@ func (r *Filter) IsFinal() bool {
 	return r.isFinal
 }
 
-func (r *Filter) tgHelp(logger *zap.Logger, bot *telego.Bot, message *telego.Message, _ []string) error {
+func (r *Filter) tgHelp(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
 	logger.Debug("sending help message")
 	buf := bytes.NewBuffer([]byte{})
 	buf.WriteString("Commands allows to add, list or remove filtering regex (syntax is re2):\n\n")
@@ -174,7 +188,7 @@ func (r *Filter) tgHelp(logger *zap.Logger, bot *telego.Bot, message *telego.Mes
 	return err
 }
 
-func (r *Filter) tgListRegex(logger *zap.Logger, bot *telego.Bot, message *telego.Message, _ []string) error {
+func (r *Filter) tgListRegex(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
 	r.RLock()
 	defer r.RUnlock()
 	buf := bytes.NewBuffer([]byte{})
@@ -190,7 +204,7 @@ func (r *Filter) tgListRegex(logger *zap.Logger, bot *telego.Bot, message *teleg
 	return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, "End of list")
 }
 
-func (r *Filter) tgAddRegex(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error {
+func (r *Filter) tgAddRegex(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
 	r.Lock()
 	defer r.Unlock()
 	logger.Debug("adding regex", zap.String("regex", strings.Join(tokens, " ")))
@@ -226,11 +240,18 @@ func (r *Filter) tgAddRegex(logger *zap.Logger, bot *telego.Bot, message *telego
 		return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, fmt.Sprintf("Failed to save config: %v", err))
 	}
 	r.regex = append(r.regex, re)
+	r.auditLog.Record(&auditEvent.AuditEvent{
+		Action:  audit.ActionRegexAdd,
+		ActorId: message.From.ID,
+		ChatId:  message.Chat.ID,
+		Rule:    r.chainName,
+		Details: newRegex,
+	})
 
 	return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, "Done")
 }
 
-func (r *Filter) tgDelRegex(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error {
+func (r *Filter) tgDelRegex(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
 	r.Lock()
 	defer r.Unlock()
 	logger.Debug("deleting regex", zap.String("regex", strings.Join(tokens, " ")))
@@ -260,6 +281,13 @@ func (r *Filter) tgDelRegex(logger *zap.Logger, bot *telego.Bot, message *telego
 			break
 		}
 	}
+	r.auditLog.Record(&auditEvent.AuditEvent{
+		Action:  audit.ActionRegexDel,
+		ActorId: message.From.ID,
+		ChatId:  message.Chat.ID,
+		Rule:    r.chainName,
+		Details: reToDel,
+	})
 
 	return tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, "Done")
 }
@@ -292,7 +320,7 @@ func (r *Filter) loadConfig() error {
 }
 
 func (r *Filter) Close() error {
-	return r.configDB.Close()
+	return badgerOpts.Close(r.configDB)
 }
 
 func (r *Filter) TGAdminPrefix() string {
@@ -0,0 +1,20 @@
+package interfaces
+
+import (
+	"errors"
+	"io"
+)
+
+// CloseRules closes filtering rules that hold resources (e.g. databases), returning all the errors that occurred
+func CloseRules(rules []FilteringRule) error {
+	var errs []error
+	for _, rule := range rules {
+		if c, ok := rule.(io.Closer); ok {
+			err := c.Close()
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
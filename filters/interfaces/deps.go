@@ -0,0 +1,15 @@
+package interfaces
+
+import (
+	"github.com/Civil/tg-simple-regex-antispam/audit"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+)
+
+// Deps are components shared by all chains. chains.Builder passes them to stateful filters, filtering rules and
+// actions it creates.
+type Deps struct {
+	// Audit records moderation events, nil if audit is disabled
+	Audit *audit.Log
+	// Events delivers bans and messages with known labels to rules that learn from them, nil if there is no hub
+	Events *events.Hub
+}
@@ -5,20 +5,21 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	"github.com/Civil/tg-simple-regex-antispam/helper/stateful"
 )
 
 type FilteringRule interface {
-	Score(*telego.Bot, *telego.Message) *scoringResult.ScoringResult
+	Score(botAPI.BotAPI, *telego.Message) *scoringResult.ScoringResult
 	IsStateful() bool
 	GetName() string
 	GetFilterName() string
 	IsFinal() bool
 	TGAdminPrefix() string
-	HandleTGCommands(*zap.Logger, *telego.Bot, *telego.Message, []string) error
+	HandleTGCommands(*zap.Logger, botAPI.BotAPI, *telego.Message, []string) error
 }
 
-type InitFunc func(*zap.Logger, map[string]any, string) (FilteringRule, error)
+type InitFunc func(*zap.Logger, Deps, map[string]any, string) (FilteringRule, error)
 
 type HelpFunc func() string
 
@@ -27,4 +28,24 @@ type StatefulFilter interface {
 	FilteringRule
 	RemoveState(int64) error
 	UnbanUser(int64) error
+	// GetThreshold returns score starting from which message is considered a spam
+	GetThreshold() int32
+}
+
+// Verifier is implemented by filters that verify users, e.g. once they have sent enough messages that are not spam
+type Verifier interface {
+	IsVerified(userID int64) (bool, error)
+}
+
+// CallbackHandler is implemented by filters that post messages with inline buttons. Callback data of their buttons
+// must start with CallbackPrefix followed by ':'.
+type CallbackHandler interface {
+	CallbackPrefix() string
+	HandleCallbackQuery(*zap.Logger, botAPI.BotAPI, *telego.CallbackQuery) error
+}
+
+// MemberJoinHandler is implemented by filters that react to users joining the chat. It is called for chat_member
+// updates, which have no service message, filters receive new_chat_members service messages in Score.
+type MemberJoinHandler interface {
+	HandleNewMember(logger *zap.Logger, bot botAPI.BotAPI, chat telego.Chat, user telego.User)
 }
@@ -0,0 +1,29 @@
+package interfaces
+
+import (
+	"strconv"
+	"strings"
+)
+
+// RuleNames returns names of the parent's (chain or composite rule) nested rules of given types, that are unique
+// among rules of all chains: parent's name followed by rule type and, for repeated types, their ordinal number, e.g.
+// "spam_filter.regex" and "spam_filter.regex2". Rules use it to name their databases and as admin prefix.
+func RuleNames(parent string, types []string) []string {
+	res := make([]string, 0, len(types))
+	seen := make(map[string]int, len(types))
+	for _, t := range types {
+		seen[t]++
+		name := parent + "." + t
+		if n := seen[t]; n > 1 {
+			name += strconv.Itoa(n)
+		}
+		res = append(res, name)
+	}
+	return res
+}
+
+// LocalPrefix returns admin prefix of the nested rule relative to its parent, e.g. "regex2" for "spam_filter.regex2",
+// so its commands are available as `/admin spam_filter regex2 ...`
+func LocalPrefix(parent, prefix string) string {
+	return strings.TrimPrefix(prefix, parent+".")
+}
@@ -0,0 +1,61 @@
+package interfaces
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRuleNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		parent string
+		types  []string
+		want   []string
+	}{
+		{name: "empty", parent: "spam", types: nil, want: []string{}},
+		{
+			name:   "distinct types",
+			parent: "spam",
+			types:  []string{"regex", "partialMatch"},
+			want:   []string{"spam.regex", "spam.partialMatch"},
+		},
+		{
+			name:   "repeated types",
+			parent: "spam",
+			types:  []string{"regex", "anyOf", "regex", "anyOf", "regex"},
+			want:   []string{"spam.regex", "spam.anyOf", "spam.regex2", "spam.anyOf2", "spam.regex3"},
+		},
+		{
+			name:   "nested",
+			parent: "spam.anyOf",
+			types:  []string{"regex"},
+			want:   []string{"spam.anyOf.regex"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RuleNames(tt.parent, tt.types)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("RuleNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalPrefix(t *testing.T) {
+	tests := []struct {
+		parent string
+		prefix string
+		want   string
+	}{
+		{parent: "spam", prefix: "spam.regex2", want: "regex2"},
+		{parent: "spam.anyOf", prefix: "spam.anyOf.regex", want: "regex"},
+		{parent: "spam", prefix: "spammer.regex", want: "spammer.regex"},
+		{parent: "spam", prefix: "regex", want: "regex"},
+	}
+	for _, tt := range tests {
+		if got := LocalPrefix(tt.parent, tt.prefix); got != tt.want {
+			t.Errorf("LocalPrefix(%q, %q) = %q, want %q", tt.parent, tt.prefix, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package scoring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+)
+
+// MaxScore is a score of a rule that is sure that message is a spam
+const MaxScore = 100
+
+type Mode string
+
+const (
+	// ModeMax takes the highest score of all rules
+	ModeMax Mode = "max"
+	// ModeSum adds up scores of all rules
+	ModeSum Mode = "sum"
+)
+
+var ErrUnknownMode = errors.New("unknown aggregation mode, supported modes are `max` and `sum`")
+
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case ModeMax, ModeSum:
+		return Mode(s), nil
+	default:
+		return "", ErrUnknownMode
+	}
+}
+
+// WeightedRule multiplies score of the underlying rule by its weight
+type WeightedRule struct {
+	interfaces.FilteringRule
+	weight      float64
+	displayName string
+}
+
+// NewWeighted wraps the rule, weight 0 means that rule is used as is. displayName is used in reasons, rule's name
+// is used if it is empty.
+func NewWeighted(rule interfaces.FilteringRule, weight float64, displayName string) *WeightedRule {
+	if weight == 0 {
+		weight = 1
+	}
+	if displayName == "" {
+		displayName = rule.GetName()
+	}
+	return &WeightedRule{
+		FilteringRule: rule,
+		weight:        weight,
+		displayName:   displayName,
+	}
+}
+
+func (r *WeightedRule) Score(bot botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	res := r.FilteringRule.Score(bot, msg)
+	if r.weight == 1 || res.Score == 0 {
+		return res
+	}
+	return &scoringResult.ScoringResult{
+		Score:  int32(math.Round(float64(res.Score) * r.weight)),
+		Reason: res.Reason,
+	}
+}
+
+func (r *WeightedRule) GetWeight() float64 {
+	return r.weight
+}
+
+func (r *WeightedRule) DisplayName() string {
+	return r.displayName
+}
+
+// Close closes the underlying rule if it holds any resources
+func (r *WeightedRule) Close() error {
+	return interfaces.CloseRules([]interfaces.FilteringRule{r.FilteringRule})
+}
+
+// Unwrap returns original rule
+func (r *WeightedRule) Unwrap() interfaces.FilteringRule {
+	return r.FilteringRule
+}
+
+// DisplayName returns name of the rule as it is specified in configuration
+func DisplayName(rule interfaces.FilteringRule) string {
+	if r, ok := rule.(interface{ DisplayName() string }); ok {
+		return r.DisplayName()
+	}
+	return rule.GetName()
+}
+
+// Evaluate scores message with all the rules and aggregates the result.
+//
+// In ModeMax the reason of the rule with the highest score is returned. In ModeSum reasons of all the rules that
+// contributed to the score are listed. In both modes evaluation stops after final rule gives a positive score.
+func Evaluate(bot botAPI.BotAPI, msg *telego.Message, rules []interfaces.FilteringRule, mode Mode) *scoringResult.ScoringResult {
+	res := &scoringResult.ScoringResult{}
+	if mode == ModeMax {
+		for _, rule := range rules {
+			score := rule.Score(bot, msg)
+			if score.Score > res.Score {
+				res = &scoringResult.ScoringResult{
+					Score:  score.Score,
+					Reason: score.Reason,
+					Rule:   DisplayName(rule),
+				}
+				if rule.IsFinal() {
+					break
+				}
+			}
+		}
+		return res
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	names := make([]string, 0)
+	for _, rule := range rules {
+		score := rule.Score(bot, msg)
+		if score.Score == 0 {
+			continue
+		}
+		res.Score += score.Score
+		names = append(names, DisplayName(rule))
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(fmt.Sprintf("%v (%+d): %v", DisplayName(rule), score.Score, score.Reason))
+		if score.Score > 0 && rule.IsFinal() {
+			break
+		}
+	}
+	res.Reason = buf.String()
+	res.Rule = strings.Join(names, ", ")
+	return res
+}
@@ -0,0 +1,63 @@
+package campaign
+
+import (
+	"crypto/sha256"
+	"strings"
+	"unicode"
+
+	"github.com/mymmrac/telego"
+)
+
+const fingerprintLength = 16
+
+type fingerprint [fingerprintLength]byte
+
+// normalize lowercases text and keeps only letters and digits separated by single spaces, so the same text with
+// different punctuation, emojis or formatting has the same fingerprint
+func normalize(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// mediaID returns unique id of the file attached to the message, empty if there is none. Stickers, voice messages
+// and audio are ignored, as the same ones are commonly sent by unrelated users.
+func mediaID(msg *telego.Message) string {
+	switch {
+	case len(msg.Photo) > 0:
+		return msg.Photo[len(msg.Photo)-1].FileUniqueID
+	case msg.Video != nil:
+		return msg.Video.FileUniqueID
+	case msg.Animation != nil:
+		return msg.Animation.FileUniqueID
+	case msg.Document != nil:
+		return msg.Document.FileUniqueID
+	case msg.VideoNote != nil:
+		return msg.VideoNote.FileUniqueID
+	default:
+		return ""
+	}
+}
+
+// fingerprintOf hashes normalized text, caption and attached media. False is returned for messages which text and
+// caption are shorter than minLength, even if they have media, as short phrases and popular media are often repeated
+// by unrelated users.
+func fingerprintOf(msg *telego.Message, minLength int) (fingerprint, bool) {
+	text := normalize(msg.Text)
+	caption := normalize(msg.Caption)
+	if len([]rune(text))+len([]rune(caption)) < minLength {
+		return fingerprint{}, false
+	}
+	media := mediaID(msg)
+
+	h := sha256.New()
+	h.Write([]byte(text))
+	h.Write([]byte{0})
+	h.Write([]byte(caption))
+	h.Write([]byte{0})
+	h.Write([]byte(media))
+	var res fingerprint
+	copy(res[:], h.Sum(nil))
+	return res, true
+}
@@ -0,0 +1,593 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	actions "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/scoring"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/campaignState"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+var (
+	ErrStateDirEmpty     = errors.New("state_dir cannot be empty")
+	ErrKInvalid          = errors.New("k must be at least 2")
+	ErrWindowInvalid     = errors.New("window must be positive")
+	ErrFlagTTLInvalid    = errors.New("flag_ttl must be positive")
+	ErrMinLengthNegative = errors.New("min_length cannot be negative")
+)
+
+const (
+	prefixPost     byte = 'p'
+	prefixCampaign byte = 'c'
+)
+
+// adminsTTL is how long admins of a chat are cached, so that they are not requested for every message
+const adminsTTL = 10 * time.Minute
+
+// Filter detects the same content posted by several users. Posts are stored by fingerprint of their content in
+// buckets as long as the window. Once k distinct users post the same content within the window, the content is
+// flagged as a campaign, actions are applied to all of its posters, including the earlier ones, and to everyone who
+// posts it while the flag lasts. Posts of chat admins and verified users are neither recorded nor counted.
+type Filter struct {
+	chainName string
+	logger    *zap.Logger
+
+	db      *badger.DB
+	banDB   bannedDB.BanDB
+	actions []actions.Action
+
+	k         int
+	window    time.Duration
+	flagTTL   time.Duration
+	minLength int
+	recordBan bool
+	isFinal   bool
+
+	// Serializes lookups and updates of the posts of the same content
+	mu sync.Mutex
+
+	adminsMu sync.Mutex
+	admins   map[int64]chatAdminsEntry
+
+	tg.TGHaveAdminCommands
+}
+
+func New(logger *zap.Logger, _ interfaces.Deps, chainName string, banDB bannedDB.BanDB, _ botAPI.BotAPI, config map[string]any,
+	_ []interfaces.FilteringRule, actions []actions.Action,
+) (interfaces.StatefulFilter, error) {
+	stateDir, err := config2.GetOptionString(config, "state_dir")
+	if err != nil {
+		return nil, err
+	}
+	if stateDir == "" {
+		return nil, ErrStateDirEmpty
+	}
+
+	k, err := config2.GetOptionIntWithDefault(config, "k", 3)
+	if err != nil {
+		return nil, err
+	}
+	if k < 2 {
+		return nil, ErrKInvalid
+	}
+
+	window, err := config2.GetOptionDurationWithDefault(config, "window", 10*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		return nil, ErrWindowInvalid
+	}
+
+	flagTTL, err := config2.GetOptionDurationWithDefault(config, "flag_ttl", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if flagTTL <= 0 {
+		return nil, ErrFlagTTLInvalid
+	}
+
+	minLength, err := config2.GetOptionIntWithDefault(config, "min_length", 20)
+	if err != nil {
+		return nil, err
+	}
+	if minLength < 0 {
+		return nil, ErrMinLengthNegative
+	}
+
+	recordBan, err := config2.GetOptionBoolWithDefault(config, "recordBan", true)
+	if err != nil {
+		return nil, err
+	}
+
+	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
+	if err != nil {
+		return nil, err
+	}
+
+	badgerDB, err := badgerOpts.Open(logger, chainName+"_DB", stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		logger: logger.With(
+			zap.String("filter", chainName),
+			zap.String("filter_type", "campaign"),
+		),
+		chainName: chainName,
+		db:        badgerDB,
+		banDB:     banDB,
+		actions:   actions,
+		k:         k,
+		window:    window,
+		flagTTL:   flagTTL,
+		minLength: minLength,
+		recordBan: recordBan,
+		isFinal:   isFinal,
+		admins:    make(map[int64]chatAdminsEntry),
+	}
+	f.TGHaveAdminCommands = tg.TGHaveAdminCommands{
+		Handlers: map[string]tg.AdminCMDHandlerFunc{
+			"list": f.tgListCampaigns,
+			"help": f.tgHelp,
+		},
+	}
+	return f, nil
+}
+
+func Help() string {
+	return "campaign requires `state_dir` parameter, optional: `k` (number of distinct users that post the same content, default 3), `window` (default 10m), `flag_ttl` (how long further posts of flagged content are handled immediately, default 24h), `min_length` (messages which text and caption are shorter are ignored, default 20), `recordBan` (add posters to banned users, default true)"
+}
+
+func (r *Filter) bucket(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(r.window))
+}
+
+func bucketPrefix(fp fingerprint, bucket uint64) []byte {
+	key := append([]byte{prefixPost}, fp[:]...)
+	return binary.BigEndian.AppendUint64(key, bucket)
+}
+
+const userIDOffset = 1 + fingerprintLength + 8
+
+func (r *Filter) postKey(fp fingerprint, p *campaignState.Post) []byte {
+	key := bucketPrefix(fp, r.bucket(p.GetPostedAt().AsTime()))
+	key = binary.BigEndian.AppendUint64(key, uint64(p.UserId))
+	key = binary.BigEndian.AppendUint64(key, uint64(p.ChatId))
+	return binary.BigEndian.AppendUint64(key, uint64(p.MessageId))
+}
+
+func campaignKey(fp fingerprint) []byte {
+	return append([]byte{prefixCampaign}, fp[:]...)
+}
+
+// addPost stores the post, it is removed by badger once it can't be within the window anymore
+func (r *Filter) addPost(fp fingerprint, p *campaignState.Post) error {
+	b, err := proto.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(r.postKey(fp, p), b).WithTTL(2 * r.window))
+	})
+}
+
+// recentPosts returns posts of the content within the window, the window is always covered by current and
+// previous buckets
+func (r *Filter) recentPosts(fp fingerprint, now time.Time) ([]*campaignState.Post, error) {
+	res := make([]*campaignState.Post, 0)
+	cutoff := now.Add(-r.window)
+	current := r.bucket(now)
+	err := r.db.View(func(txn *badger.Txn) error {
+		for _, bucket := range []uint64{current - 1, current} {
+			opts := badger.DefaultIteratorOptions
+			opts.Prefix = bucketPrefix(fp, bucket)
+			it := txn.NewIterator(opts)
+			for it.Rewind(); it.Valid(); it.Next() {
+				var p campaignState.Post
+				err := it.Item().Value(func(val []byte) error {
+					return proto.Unmarshal(val, &p)
+				})
+				if err != nil {
+					it.Close()
+					return err
+				}
+				if p.GetPostedAt().AsTime().Before(cutoff) {
+					continue
+				}
+				res = append(res, &p)
+			}
+			it.Close()
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (r *Filter) removePosts(fp fingerprint, posts []*campaignState.Post) error {
+	return r.db.Update(func(txn *badger.Txn) error {
+		for _, p := range posts {
+			err := txn.Delete(r.postKey(fp, p))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Filter) getCampaign(fp fingerprint) (*campaignState.Campaign, error) {
+	var c campaignState.Campaign
+	err := r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(campaignKey(fp))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return proto.Unmarshal(val, &c)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// setCampaign stores the campaign, flag expires flag_ttl after the campaign was detected
+func (r *Filter) setCampaign(fp fingerprint, c *campaignState.Campaign) error {
+	b, err := proto.Marshal(c)
+	if err != nil {
+		return err
+	}
+	ttl := time.Until(c.GetFlaggedAt().AsTime().Add(r.flagTTL))
+	if ttl <= 0 {
+		return nil
+	}
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(campaignKey(fp), b).WithTTL(ttl))
+	})
+}
+
+func distinctUsers(posts []*campaignState.Post) []int64 {
+	users := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		if !slices.Contains(users, p.UserId) {
+			users = append(users, p.UserId)
+		}
+	}
+	return users
+}
+
+// check records the post and returns posts that actions must be applied to, nil if content is not a campaign
+func (r *Filter) check(fp fingerprint, msg *telego.Message, post *campaignState.Post) ([]*campaignState.Post, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c, err := r.getCampaign(fp)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		if !slices.Contains(c.UserIds, post.UserId) {
+			c.UserIds = append(c.UserIds, post.UserId)
+			err = r.setCampaign(fp, c)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return []*campaignState.Post{post}, nil
+	}
+
+	err = r.addPost(fp, post)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := r.recentPosts(fp, post.GetPostedAt().AsTime())
+	if err != nil {
+		return nil, err
+	}
+	// Users could have been verified after they posted
+	posts = slices.DeleteFunc(posts, func(p *campaignState.Post) bool {
+		return r.banDB.IsVerified(p.UserId)
+	})
+	users := distinctUsers(posts)
+	if len(users) < r.k {
+		return nil, nil
+	}
+
+	err = r.setCampaign(fp, &campaignState.Campaign{
+		Excerpt:   tg.MessageExcerpt(msg),
+		UserIds:   users,
+		FlaggedAt: post.GetPostedAt(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Posts are handled now, further ones are recognized by the flag
+	err = r.removePosts(fp, posts)
+	if err != nil {
+		r.logger.Error("failed to remove posts of the campaign", zap.Error(err))
+	}
+	return posts, nil
+}
+
+func (r *Filter) Score(bot botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	score := &scoringResult.ScoringResult{}
+	if msg.From == nil || msg.From.IsBot {
+		return score
+	}
+	fp, ok := fingerprintOf(msg, r.minLength)
+	if !ok {
+		return score
+	}
+	logger := r.logger.With(zap.Int64("chat_id", msg.Chat.ID), zap.Int64("user_id", msg.From.ID))
+	if r.isTrusted(logger, bot, msg.Chat.ID, msg.From.ID) {
+		return score
+	}
+
+	post := &campaignState.Post{
+		ChatId:    msg.Chat.ID,
+		MessageId: int64(msg.MessageID),
+		UserId:    msg.From.ID,
+		PostedAt:  timestamppb.Now(),
+	}
+	posts, err := r.check(fp, msg, post)
+	if err != nil {
+		logger.Error("failed to check message", zap.Error(err))
+		return score
+	}
+	if len(posts) == 0 {
+		return score
+	}
+
+	score.Score = scoring.MaxScore
+	score.Rule = "campaign"
+	score.Reason = fmt.Sprintf("same content was posted by at least %v users within %v", r.k,
+		config2.FormatDuration(r.window))
+	logger.Info("campaign detected", zap.Int("posts", len(posts)))
+	r.applyActions(logger, bot, score, msg, posts)
+	return score
+}
+
+type posterKey struct {
+	chatID int64
+	userID int64
+}
+
+type chatAdminsEntry struct {
+	ids       map[int64]struct{}
+	fetchedAt time.Time
+}
+
+// isChatAdmin reports whether user is admin of the chat. Admins are cached for adminsTTL, errors are logged and user
+// is not considered an admin then.
+func (r *Filter) isChatAdmin(logger *zap.Logger, bot botAPI.BotAPI, chatID, userID int64) bool {
+	r.adminsMu.Lock()
+	entry, ok := r.admins[chatID]
+	r.adminsMu.Unlock()
+	if !ok || time.Since(entry.fetchedAt) > adminsTTL {
+		admins, err := bot.GetChatAdministrators(&telego.GetChatAdministratorsParams{ChatID: telego.ChatID{ID: chatID}})
+		if err != nil {
+			logger.Error("failed to get chat administrators", zap.Int64("poster_chat_id", chatID), zap.Error(err))
+			return false
+		}
+		entry = chatAdminsEntry{ids: make(map[int64]struct{}, len(admins)), fetchedAt: time.Now()}
+		for _, admin := range admins {
+			entry.ids[admin.MemberUser().ID] = struct{}{}
+		}
+		r.adminsMu.Lock()
+		r.admins[chatID] = entry
+		r.adminsMu.Unlock()
+	}
+	_, ok = entry.ids[userID]
+	return ok
+}
+
+// isTrusted reports whether user is admin of the chat or was verified by other filters. Such users are trusted to
+// share the same content.
+func (r *Filter) isTrusted(logger *zap.Logger, bot botAPI.BotAPI, chatID, userID int64) bool {
+	return r.isChatAdmin(logger, bot, chatID, userID) || r.banDB.IsVerified(userID)
+}
+
+// applyActions applies actions once per poster in every chat, with all of their messages. Posters who became chat
+// admins or were verified after they posted are skipped.
+func (r *Filter) applyActions(logger *zap.Logger, bot botAPI.BotAPI, score *scoringResult.ScoringResult, msg *telego.Message, posts []*campaignState.Post) {
+	messageIDs := make(map[posterKey][]int64)
+	order := make([]posterKey, 0, len(posts))
+	for _, p := range posts {
+		key := posterKey{chatID: p.ChatId, userID: p.UserId}
+		if _, ok := messageIDs[key]; !ok {
+			order = append(order, key)
+		}
+		messageIDs[key] = append(messageIDs[key], p.MessageId)
+	}
+
+	excerpt := tg.MessageExcerpt(msg)
+	for _, key := range order {
+		logger := logger.With(zap.Int64("poster_chat_id", key.chatID), zap.Int64("poster_user_id", key.userID))
+		if r.isTrusted(logger, bot, key.chatID, key.userID) {
+			logger.Info("poster is chat admin or verified, skipping")
+			continue
+		}
+		if r.recordBan && !r.banDB.IsBanned(key.userID) {
+			err := r.banDB.BanUser(key.userID, &banRecord.BanRecord{
+				ChatId:         key.chatID,
+				ChainName:      r.chainName,
+				RuleName:       score.Rule,
+				Reason:         score.Reason,
+				MessageExcerpt: excerpt,
+			})
+			if err != nil {
+				logger.Error("failed to ban user", zap.Error(err))
+			}
+		}
+
+		ids := messageIDs[key]
+		// Per message actions get the message itself if it's the current one, earlier ones are only known by ids
+		target := msg
+		if key.chatID != msg.Chat.ID || key.userID != msg.From.ID {
+			target = &telego.Message{
+				MessageID: int(ids[len(ids)-1]),
+				Chat:      telego.Chat{ID: key.chatID},
+				From:      &telego.User{ID: key.userID},
+			}
+		}
+		for _, action := range r.actions {
+			var err error
+			if action.PerMessage() {
+				err = action.ApplyToMessage(r, score, target)
+			} else {
+				err = action.Apply(r, score, telego.ChatID{ID: key.chatID}, ids, key.userID)
+			}
+			if err != nil {
+				logger.Error("failed to apply action", zap.String("action", action.GetName()), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (r *Filter) listCampaigns() ([]*campaignState.Campaign, error) {
+	res := make([]*campaignState.Campaign, 0)
+	err := r.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte{prefixCampaign}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var c campaignState.Campaign
+			err := it.Item().Value(func(val []byte) error {
+				return proto.Unmarshal(val, &c)
+			})
+			if err != nil {
+				return err
+			}
+			res = append(res, &c)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (r *Filter) tgListCampaigns(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	campaigns, err := r.listCampaigns()
+	if err != nil {
+		logger.Error("failed to list campaigns", zap.Error(err))
+		return err
+	}
+	slices.SortFunc(campaigns, func(a, b *campaignState.Campaign) int {
+		return b.GetFlaggedAt().AsTime().Compare(a.GetFlaggedAt().AsTime())
+	})
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("Flagged campaigns:\n\n")
+	for _, c := range campaigns {
+		buf.WriteString(fmt.Sprintf("%v - %v users, flagged at %v\n", c.Excerpt, len(c.UserIds),
+			c.GetFlaggedAt().AsTime().Format(time.RFC3339)))
+	}
+	err = tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
+
+func (r *Filter) tgHelp(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("Available commands:\n")
+	buf.WriteString(" - `list` - list content that is currently flagged as a campaign\n")
+	buf.WriteString(" - `help` - this help\n")
+
+	err := tg.SendMarkdownMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
+
+// RemoveState forgets recent posts of the user, so they don't count towards a campaign
+func (r *Filter) RemoveState(userID int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.db.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte{prefixPost}
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().KeyCopy(nil)
+			if len(key) < userIDOffset+8 || int64(binary.BigEndian.Uint64(key[userIDOffset:])) != userID {
+				continue
+			}
+			err := txn.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Filter) UnbanUser(userID int64) error {
+	return r.RemoveState(userID)
+}
+
+func (r *Filter) GetThreshold() int32 {
+	return scoring.MaxScore
+}
+
+func (r *Filter) IsStateful() bool {
+	return true
+}
+
+func (r *Filter) GetName() string {
+	return "campaign"
+}
+
+func (r *Filter) GetFilterName() string {
+	return r.chainName
+}
+
+func (r *Filter) IsFinal() bool {
+	return r.isFinal
+}
+
+func (r *Filter) Close() error {
+	return badgerOpts.Close(r.db)
+}
+
+func (r *Filter) SaveState() error {
+	return nil
+}
+
+func (r *Filter) LoadState() error {
+	return nil
+}
+
+func (r *Filter) TGAdminPrefix() string {
+	return r.chainName
+}
@@ -0,0 +1,177 @@
+package campaign
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	actions "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+)
+
+const (
+	testChatID = -100
+	testText   = "buy cheap followers at example dot com"
+)
+
+func TestFingerprintOf(t *testing.T) {
+	photo := func(id string) []telego.PhotoSize { return []telego.PhotoSize{{FileUniqueID: id}} }
+	tests := []struct {
+		name   string
+		a, b   telego.Message
+		wantOK bool
+		same   bool
+	}{
+		{
+			name:   "punctuation and case are ignored",
+			a:      telego.Message{Text: testText},
+			b:      telego.Message{Text: "Buy cheap followers, at example dot com!!!"},
+			wantOK: true,
+			same:   true,
+		},
+		{
+			name: "short text with media is ignored",
+			a:    telego.Message{Caption: "look", Photo: photo("p1")},
+			b:    telego.Message{Caption: "look", Photo: photo("p1")},
+		},
+		{
+			name:   "different media",
+			a:      telego.Message{Caption: testText, Photo: photo("p1")},
+			b:      telego.Message{Caption: testText, Photo: photo("p2")},
+			wantOK: true,
+		},
+		{
+			name:   "stickers are not part of fingerprint",
+			a:      telego.Message{Text: testText, Sticker: &telego.Sticker{FileUniqueID: "s1"}},
+			b:      telego.Message{Text: testText, Sticker: &telego.Sticker{FileUniqueID: "s2"}},
+			wantOK: true,
+			same:   true,
+		},
+		{
+			name:   "voice messages are not part of fingerprint",
+			a:      telego.Message{Caption: testText, Voice: &telego.Voice{FileUniqueID: "v1"}},
+			b:      telego.Message{Caption: testText, Voice: &telego.Voice{FileUniqueID: "v2"}},
+			wantOK: true,
+			same:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, okA := fingerprintOf(&tt.a, 20)
+			b, okB := fingerprintOf(&tt.b, 20)
+			if okA != tt.wantOK || okB != tt.wantOK {
+				t.Fatalf("got ok %v and %v, want %v", okA, okB, tt.wantOK)
+			}
+			if tt.wantOK && (a == b) != tt.same {
+				t.Errorf("fingerprints are the same: %v, want %v", a == b, tt.same)
+			}
+		})
+	}
+}
+
+// recordingAction records users it was applied to
+type recordingAction struct {
+	mu    sync.Mutex
+	users []int64
+}
+
+func (a *recordingAction) Apply(_ interfaces.StatefulFilter, _ *scoringResult.ScoringResult, _ telego.ChatID, _ []int64, userID int64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.users = append(a.users, userID)
+	return nil
+}
+
+func (a *recordingAction) ApplyToMessage(interfaces.StatefulFilter, *scoringResult.ScoringResult, *telego.Message) error {
+	return nil
+}
+
+func (a *recordingAction) GetName() string {
+	return "recording"
+}
+
+func (a *recordingAction) PerMessage() bool {
+	return false
+}
+
+// verifier is a stateful filter that verified some users
+type verifier struct {
+	interfaces.StatefulFilter
+	verified []int64
+}
+
+func (v *verifier) IsVerified(userID int64) (bool, error) {
+	return slices.Contains(v.verified, userID), nil
+}
+
+func TestAdminsAndVerifiedUsersAreNotCounted(t *testing.T) {
+	const (
+		admin    = 1
+		verified = 2
+		spammer  = 3
+	)
+	tests := []struct {
+		name    string
+		posters []int64
+		want    []int64
+	}{
+		{
+			name:    "admin and verified user don't make a campaign",
+			posters: []int64{admin, verified, spammer},
+		},
+		{
+			name:    "only untrusted posters are handled",
+			posters: []int64{admin, spammer, verified, spammer + 1, spammer + 2},
+			want:    []int64{spammer, spammer + 1, spammer + 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			banDB, err := bannedDB.New(zap.NewNop(), map[string]any{"state_dir": t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = banDB.Close() })
+			banDB.SetStatefulFilters([]interfaces.StatefulFilter{&verifier{verified: []int64{verified}}})
+
+			action := &recordingAction{}
+			f, err := New(zap.NewNop(), interfaces.Deps{}, "campaign", banDB, nil,
+				map[string]any{"state_dir": t.TempDir(), "k": 3}, nil, []actions.Action{action})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = f.Close() })
+
+			bot := fakeBot.New()
+			bot.ChatAdministrators[testChatID] = []telego.ChatMember{
+				&telego.ChatMemberAdministrator{Status: telego.MemberStatusAdministrator, User: telego.User{ID: admin}},
+			}
+			for i, userID := range tt.posters {
+				f.Score(bot, &telego.Message{
+					MessageID: i + 1,
+					Chat:      telego.Chat{ID: testChatID},
+					From:      &telego.User{ID: userID},
+					Text:      testText,
+				})
+			}
+
+			if !slices.Equal(action.users, tt.want) {
+				t.Errorf("actions were applied to %v, want %v", action.users, tt.want)
+			}
+			for _, userID := range []int64{admin, verified} {
+				if banDB.IsBanned(userID) {
+					t.Errorf("user %v was recorded as banned", userID)
+				}
+			}
+			if calls := bot.CallsTo(fakeBot.MethodGetChatAdministrators); len(calls) != 1 {
+				t.Errorf("admins were requested %v times, want them to be cached", len(calls))
+			}
+		})
+	}
+}
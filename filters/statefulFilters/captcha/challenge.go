@@ -0,0 +1,112 @@
+package captcha
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+)
+
+const (
+	ChallengeButton = "button"
+	ChallengeMath   = "math"
+	ChallengeEmoji  = "emoji"
+
+	optionsCount = 4
+)
+
+var ErrUnknownChallengeType = errors.New("unknown challenge type, supported types are `button`, `math` and `emoji`")
+
+type challenge struct {
+	question string
+	options  []string
+	answer   int
+}
+
+type generator func() challenge
+
+func getGenerator(challengeType string) (generator, error) {
+	switch challengeType {
+	case ChallengeButton:
+		return buttonChallenge, nil
+	case ChallengeMath:
+		return mathChallenge, nil
+	case ChallengeEmoji:
+		return emojiChallenge, nil
+	default:
+		return nil, ErrUnknownChallengeType
+	}
+}
+
+// shuffle puts correct option to a random position and returns its index
+func shuffle(correct string, wrong []string) ([]string, int) {
+	options := append([]string{correct}, wrong...)
+	rand.Shuffle(len(options), func(i, j int) {
+		options[i], options[j] = options[j], options[i]
+	})
+	for i, o := range options {
+		if o == correct {
+			return options, i
+		}
+	}
+	return options, 0
+}
+
+func buttonChallenge() challenge {
+	options, answer := shuffle("✅ I'm human", []string{"🤖 I'm a bot", "📢 I'm here to advertise", "❌ Leave the chat"})
+	return challenge{
+		question: "press the button that says that you are a human",
+		options:  options,
+		answer:   answer,
+	}
+}
+
+func mathChallenge() challenge {
+	a, b := rand.IntN(9)+1, rand.IntN(9)+1
+	sum := a + b
+	used := map[int]struct{}{sum: {}}
+	wrong := make([]string, 0, optionsCount-1)
+	for len(wrong) < optionsCount-1 {
+		w := sum + rand.IntN(9) - 4
+		if _, ok := used[w]; ok || w <= 0 {
+			continue
+		}
+		used[w] = struct{}{}
+		wrong = append(wrong, strconv.Itoa(w))
+	}
+	options, answer := shuffle(strconv.Itoa(sum), wrong)
+	return challenge{
+		question: fmt.Sprintf("how much is %v + %v?", a, b),
+		options:  options,
+		answer:   answer,
+	}
+}
+
+var emojis = []struct {
+	emoji string
+	name  string
+}{
+	{"🍎", "apple"},
+	{"🐶", "dog"},
+	{"🚗", "car"},
+	{"🌵", "cactus"},
+	{"⚽", "ball"},
+	{"🎸", "guitar"},
+	{"🌙", "moon"},
+	{"🔑", "key"},
+}
+
+func emojiChallenge() challenge {
+	perm := rand.Perm(len(emojis))
+	correct := emojis[perm[0]]
+	wrong := make([]string, 0, optionsCount-1)
+	for _, i := range perm[1:optionsCount] {
+		wrong = append(wrong, emojis[i].emoji)
+	}
+	options, answer := shuffle(correct.emoji, wrong)
+	return challenge{
+		question: fmt.Sprintf("press the %v", correct.name),
+		options:  options,
+		answer:   answer,
+	}
+}
@@ -0,0 +1,575 @@
+package captcha
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	actions "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/scoring"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/captchaState"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	badgerHelper "github.com/Civil/tg-simple-regex-antispam/helper/badger"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+var (
+	ErrStateDirEmpty       = errors.New("state_dir cannot be empty")
+	ErrTimeoutInvalid      = errors.New("timeout must be positive")
+	ErrAttemptsInvalid     = errors.New("attempts must be positive")
+	ErrChainNameInvalid    = errors.New("captcha chain name must be 1-20 characters long and must not contain ':'")
+	ErrChallengeNotFound   = errors.New("challenge not found")
+	ErrCallbackDataInvalid = errors.New("invalid callback data")
+)
+
+// Filter restricts users that join the chat until they solve a challenge. Users that fail to solve it in time
+// (or run out of attempts) are handled by the configured actions, e.g. deleteAndBan or kick.
+type Filter struct {
+	chainName string
+	logger    *zap.Logger
+
+	db      *badger.DB
+	bot     botAPI.BotAPI
+	actions []actions.Action
+
+	generate generator
+	timeout  time.Duration
+	attempts int
+	isFinal  bool
+
+	// Serializes changes of the challenges between updates and the sweeper. It is never held during API calls,
+	// challenge is removed under it by whoever handles its outcome.
+	mu   sync.Mutex
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	tg.TGHaveAdminCommands
+}
+
+func New(logger *zap.Logger, _ interfaces.Deps, chainName string, _ bannedDB.BanDB, bot botAPI.BotAPI, config map[string]any,
+	_ []interfaces.FilteringRule, actions []actions.Action,
+) (interfaces.StatefulFilter, error) {
+	// Chain name is used as a prefix of callback data, which is limited to 64 bytes
+	if chainName == "" || len(chainName) > 20 || strings.Contains(chainName, ":") {
+		return nil, ErrChainNameInvalid
+	}
+
+	stateDir, err := config2.GetOptionString(config, "state_dir")
+	if err != nil {
+		return nil, err
+	}
+	if stateDir == "" {
+		return nil, ErrStateDirEmpty
+	}
+
+	generate, err := getGenerator(config2.GetOptionStringWithDefault(config, "type", ChallengeButton))
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := time.ParseDuration(config2.GetOptionStringWithDefault(config, "timeout", "5m"))
+	if err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return nil, ErrTimeoutInvalid
+	}
+
+	attempts, err := config2.GetOptionIntWithDefault(config, "attempts", 1)
+	if err != nil {
+		return nil, err
+	}
+	if attempts <= 0 {
+		return nil, ErrAttemptsInvalid
+	}
+
+	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
+	if err != nil {
+		return nil, err
+	}
+
+	badgerDB, err := badgerOpts.Open(logger, chainName+"_DB", stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		logger: logger.With(
+			zap.String("filter", chainName),
+			zap.String("filter_type", "captcha"),
+		),
+		chainName: chainName,
+		db:        badgerDB,
+		bot:       bot,
+		actions:   actions,
+		generate:  generate,
+		timeout:   timeout,
+		attempts:  attempts,
+		isFinal:   isFinal,
+		stop:      make(chan struct{}),
+	}
+	f.TGHaveAdminCommands = tg.TGHaveAdminCommands{
+		Handlers: map[string]tg.AdminCMDHandlerFunc{
+			"list": f.tgListChallenges,
+		},
+	}
+
+	f.wg.Add(1)
+	go f.sweepLoop()
+
+	return f, nil
+}
+
+func Help() string {
+	return "captcha requires `state_dir` parameter, optional: `type` (`button`, `math` or `emoji`, default `button`), `timeout` (default 5m), `attempts` (default 1). Actions are applied to users that failed the challenge."
+}
+
+func challengeKey(chatID, userID int64) []byte {
+	return append(badgerHelper.UserIDToKey(chatID), badgerHelper.UserIDToKey(userID)...)
+}
+
+func (r *Filter) setChallenge(c *captchaState.Challenge) error {
+	b, err := proto.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(challengeKey(c.ChatId, c.UserId), b)
+	})
+}
+
+func (r *Filter) getChallenge(chatID, userID int64) (*captchaState.Challenge, error) {
+	var c captchaState.Challenge
+	err := r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(challengeKey(chatID, userID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return proto.Unmarshal(val, &c)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrChallengeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *Filter) removeChallenge(chatID, userID int64) error {
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(challengeKey(chatID, userID))
+	})
+}
+
+func (r *Filter) listChallenges() ([]*captchaState.Challenge, error) {
+	res := make([]*captchaState.Challenge, 0)
+	err := r.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var c captchaState.Challenge
+			err := it.Item().Value(func(val []byte) error {
+				return proto.Unmarshal(val, &c)
+			})
+			if err != nil {
+				return err
+			}
+			res = append(res, &c)
+		}
+		return nil
+	})
+	return res, err
+}
+
+func mention(user *telego.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return user.FirstName
+}
+
+// Score starts challenges for users from new_chat_members service messages, it never considers messages a spam
+func (r *Filter) Score(bot botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	for _, user := range msg.NewChatMembers {
+		r.challenge(bot, msg.Chat, user, msg.MessageID)
+	}
+	return &scoringResult.ScoringResult{}
+}
+
+// HandleNewMember restricts the user that joined the chat and posts a challenge
+func (r *Filter) HandleNewMember(_ *zap.Logger, bot botAPI.BotAPI, chat telego.Chat, user telego.User) {
+	r.challenge(bot, chat, user, 0)
+}
+
+// challenge restricts the user and posts a challenge as a reply to the join message, if there is one. Nothing is
+// done if the user already has a pending challenge, as the same join can be reported both by a service message and
+// by a chat_member update.
+func (r *Filter) challenge(bot botAPI.BotAPI, chat telego.Chat, user telego.User, joinMessageID int) {
+	if user.IsBot {
+		return
+	}
+	logger := r.logger.With(zap.Int64("chat_id", chat.ID), zap.Int64("user_id", user.ID))
+
+	c := r.generate()
+	state := &captchaState.Challenge{
+		ChatId:        chat.ID,
+		UserId:        user.ID,
+		JoinMessageId: int64(joinMessageID),
+		Answer:        uint32(c.answer),
+		AttemptsLeft:  uint32(r.attempts),
+		ExpiresAt:     timestamppb.New(time.Now().Add(r.timeout)),
+	}
+
+	// Challenge is saved before calling the API, so that concurrent report of the same join finds it
+	r.mu.Lock()
+	_, err := r.getChallenge(chat.ID, user.ID)
+	if err == nil {
+		r.mu.Unlock()
+		logger.Debug("user already has a pending challenge")
+		return
+	}
+	if !errors.Is(err, ErrChallengeNotFound) {
+		r.mu.Unlock()
+		logger.Error("failed to get challenge", zap.Error(err))
+		return
+	}
+	err = r.setChallenge(state)
+	r.mu.Unlock()
+	if err != nil {
+		logger.Error("failed to save challenge", zap.Error(err))
+		return
+	}
+
+	err = bot.RestrictChatMember(&telego.RestrictChatMemberParams{
+		ChatID:      chat.ChatID(),
+		UserID:      user.ID,
+		Permissions: telego.ChatPermissions{CanSendMessages: telego.ToPtr(false)},
+	})
+	if err != nil {
+		logger.Error("failed to restrict user", zap.Error(err))
+	}
+
+	buttons := make([]telego.InlineKeyboardButton, 0, len(c.options))
+	for i, o := range c.options {
+		buttons = append(buttons, tu.InlineKeyboardButton(o).WithCallbackData(fmt.Sprintf("%v:%v:%v", r.chainName, user.ID, i)))
+	}
+	params := &telego.SendMessageParams{
+		ChatID:      chat.ChatID(),
+		Text:        fmt.Sprintf("%v, welcome! To be able to write in this chat, %v You have %v.", mention(&user), c.question, r.timeout),
+		ReplyMarkup: tu.InlineKeyboard(tu.InlineKeyboardCols(2, buttons...)...),
+	}
+	if joinMessageID != 0 {
+		params.ReplyParameters = &telego.ReplyParameters{MessageID: joinMessageID, AllowSendingWithoutReply: true}
+	}
+	challengeMsg, err := bot.SendMessage(params)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		logger.Error("failed to send challenge", zap.Error(err))
+		err = r.removeChallenge(chat.ID, user.ID)
+		if err != nil {
+			logger.Error("failed to remove challenge", zap.Error(err))
+		}
+		return
+	}
+	// Challenge could be already failed by the sweeper
+	_, err = r.getChallenge(chat.ID, user.ID)
+	if err != nil {
+		logger.Debug("challenge was removed while it was being sent", zap.Error(err))
+		return
+	}
+	state.MessageId = int64(challengeMsg.MessageID)
+	err = r.setChallenge(state)
+	if err != nil {
+		logger.Error("failed to save challenge", zap.Error(err))
+	}
+}
+
+func (r *Filter) CallbackPrefix() string {
+	return r.chainName
+}
+
+func answerCallback(logger *zap.Logger, bot botAPI.BotAPI, query *telego.CallbackQuery, text string, alert bool) {
+	err := bot.AnswerCallbackQuery(&telego.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+		Text:            text,
+		ShowAlert:       alert,
+	})
+	if err != nil {
+		logger.Error("failed to answer callback query", zap.Error(err))
+	}
+}
+
+func (r *Filter) HandleCallbackQuery(logger *zap.Logger, bot botAPI.BotAPI, query *telego.CallbackQuery) error {
+	parts := strings.Split(query.Data, ":")
+	if len(parts) != 3 || query.Message == nil {
+		return ErrCallbackDataInvalid
+	}
+	userID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return ErrCallbackDataInvalid
+	}
+	option, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return ErrCallbackDataInvalid
+	}
+	chatID := query.Message.GetChat().ID
+	logger = logger.With(zap.Int64("chat_id", chatID), zap.Int64("user_id", userID))
+
+	if query.From.ID != userID {
+		answerCallback(logger, bot, query, "This challenge is for another user", true)
+		return nil
+	}
+
+	r.mu.Lock()
+	c, err := r.getChallenge(chatID, userID)
+	if errors.Is(err, ErrChallengeNotFound) {
+		r.mu.Unlock()
+		answerCallback(logger, bot, query, "This challenge has expired", true)
+		return nil
+	}
+	if err != nil {
+		r.mu.Unlock()
+		return err
+	}
+
+	solved := uint32(option) == c.Answer
+	if !solved {
+		c.AttemptsLeft--
+	}
+	if solved || c.AttemptsLeft == 0 {
+		// Removed challenge can't be handled by the sweeper or by another callback anymore
+		err = r.removeChallenge(chatID, userID)
+	} else {
+		err = r.setChallenge(c)
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case solved:
+		logger.Debug("challenge solved")
+		r.pass(logger, bot, c)
+		answerCallback(logger, bot, query, "Thank you, you can write in the chat now", false)
+	case c.AttemptsLeft == 0:
+		logger.Info("challenge failed, no attempts left")
+		answerCallback(logger, bot, query, "Wrong answer", true)
+		r.fail(logger, c, "wrong answer to the captcha")
+	default:
+		answerCallback(logger, bot, query, fmt.Sprintf("Wrong answer, attempts left: %v", c.AttemptsLeft), true)
+	}
+	return nil
+}
+
+// chatPermissions returns default permissions of the chat, so lifted restriction doesn't give user more rights
+// than other members have
+func chatPermissions(bot botAPI.BotAPI, chatID int64) telego.ChatPermissions {
+	chat, err := bot.GetChat(&telego.GetChatParams{ChatID: telego.ChatID{ID: chatID}})
+	if err == nil && chat.Permissions != nil {
+		return *chat.Permissions
+	}
+	yes := telego.ToPtr(true)
+	return telego.ChatPermissions{
+		CanSendMessages:       yes,
+		CanSendAudios:         yes,
+		CanSendDocuments:      yes,
+		CanSendPhotos:         yes,
+		CanSendVideos:         yes,
+		CanSendVideoNotes:     yes,
+		CanSendVoiceNotes:     yes,
+		CanSendPolls:          yes,
+		CanSendOtherMessages:  yes,
+		CanAddWebPagePreviews: yes,
+	}
+}
+
+// pass lifts the restriction of the user whose challenge was removed
+func (r *Filter) pass(logger *zap.Logger, bot botAPI.BotAPI, c *captchaState.Challenge) {
+	err := bot.RestrictChatMember(&telego.RestrictChatMemberParams{
+		ChatID:      telego.ChatID{ID: c.ChatId},
+		UserID:      c.UserId,
+		Permissions: chatPermissions(bot, c.ChatId),
+	})
+	if err != nil {
+		logger.Error("failed to lift restriction", zap.Error(err))
+	}
+
+	err = bot.DeleteMessage(tu.Delete(telego.ChatID{ID: c.ChatId}, int(c.MessageId)))
+	if err != nil {
+		logger.Error("failed to delete challenge message", zap.Error(err))
+	}
+}
+
+// fail applies actions to the user whose challenge was removed, they receive challenge message and join message
+// (if any)
+func (r *Filter) fail(logger *zap.Logger, c *captchaState.Challenge, reason string) {
+	score := &scoringResult.ScoringResult{
+		Score:  scoring.MaxScore,
+		Reason: reason,
+	}
+	chatID := telego.ChatID{ID: c.ChatId}
+	messageIDs := make([]int64, 0, 2)
+	if c.MessageId != 0 {
+		messageIDs = append(messageIDs, c.MessageId)
+	}
+	if c.JoinMessageId != 0 {
+		messageIDs = append(messageIDs, c.JoinMessageId)
+	}
+	msg := &telego.Message{
+		Chat: telego.Chat{ID: c.ChatId},
+		From: &telego.User{ID: c.UserId},
+	}
+	if len(messageIDs) > 0 {
+		msg.MessageID = int(messageIDs[len(messageIDs)-1])
+	}
+	for _, action := range r.actions {
+		var err error
+		if action.PerMessage() {
+			err = action.ApplyToMessage(r, score, msg)
+		} else {
+			err = action.Apply(r, score, chatID, messageIDs, c.UserId)
+		}
+		if err != nil {
+			logger.Error("failed to apply action", zap.String("action", action.GetName()), zap.Error(err))
+		}
+	}
+}
+
+// sweep fails all expired challenges
+func (r *Filter) sweep() {
+	r.mu.Lock()
+	challenges, err := r.listChallenges()
+	if err != nil {
+		r.mu.Unlock()
+		r.logger.Error("failed to list challenges", zap.Error(err))
+		return
+	}
+	now := time.Now()
+	expired := make([]*captchaState.Challenge, 0)
+	for _, c := range challenges {
+		if c.GetExpiresAt().AsTime().After(now) {
+			continue
+		}
+		err = r.removeChallenge(c.ChatId, c.UserId)
+		if err != nil {
+			r.logger.Error("failed to remove challenge", zap.Int64("chat_id", c.ChatId), zap.Int64("user_id", c.UserId), zap.Error(err))
+			continue
+		}
+		expired = append(expired, c)
+	}
+	r.mu.Unlock()
+
+	for _, c := range expired {
+		logger := r.logger.With(zap.Int64("chat_id", c.ChatId), zap.Int64("user_id", c.UserId))
+		logger.Info("challenge timed out")
+		r.fail(logger, c, "captcha was not solved in time")
+	}
+}
+
+func (r *Filter) sweepLoop() {
+	defer r.wg.Done()
+	interval := min(max(r.timeout/4, time.Second), 30*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.sweep()
+		}
+	}
+}
+
+func (r *Filter) tgListChallenges(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	r.mu.Lock()
+	challenges, err := r.listChallenges()
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("Pending challenges:\n\n")
+	for _, c := range challenges {
+		buf.WriteString(fmt.Sprintf("chat_id=%v user_id=%v expires in %v\n", c.ChatId, c.UserId,
+			time.Until(c.GetExpiresAt().AsTime()).Round(time.Second)))
+	}
+	err = tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
+
+func (r *Filter) RemoveState(_ int64) error {
+	return nil
+}
+
+func (r *Filter) UnbanUser(_ int64) error {
+	return nil
+}
+
+func (r *Filter) GetThreshold() int32 {
+	return scoring.MaxScore
+}
+
+func (r *Filter) IsStateful() bool {
+	return true
+}
+
+func (r *Filter) GetName() string {
+	return "captcha"
+}
+
+func (r *Filter) GetFilterName() string {
+	return r.chainName
+}
+
+func (r *Filter) IsFinal() bool {
+	return r.isFinal
+}
+
+func (r *Filter) Close() error {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	r.wg.Wait()
+	return badgerOpts.Close(r.db)
+}
+
+func (r *Filter) SaveState() error {
+	return nil
+}
+
+func (r *Filter) LoadState() error {
+	return nil
+}
+
+func (r *Filter) TGAdminPrefix() string {
+	return r.chainName
+}
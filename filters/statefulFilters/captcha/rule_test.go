@@ -0,0 +1,224 @@
+package captcha
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	actions "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/actions/kick"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+)
+
+const (
+	testChatID = -100
+	testUserID = 1000
+)
+
+// lockCheckingBot records whether the filter's mutex was held during any API call
+type lockCheckingBot struct {
+	*fakeBot.Bot
+	filter     *Filter
+	lockedCall atomic.Bool
+}
+
+func (b *lockCheckingBot) check() {
+	if b.filter.mu.TryLock() {
+		b.filter.mu.Unlock()
+		return
+	}
+	b.lockedCall.Store(true)
+}
+
+func (b *lockCheckingBot) SendMessage(params *telego.SendMessageParams) (*telego.Message, error) {
+	b.check()
+	return b.Bot.SendMessage(params)
+}
+
+func (b *lockCheckingBot) RestrictChatMember(params *telego.RestrictChatMemberParams) error {
+	b.check()
+	return b.Bot.RestrictChatMember(params)
+}
+
+func (b *lockCheckingBot) DeleteMessage(params *telego.DeleteMessageParams) error {
+	b.check()
+	return b.Bot.DeleteMessage(params)
+}
+
+func (b *lockCheckingBot) BanChatMember(params *telego.BanChatMemberParams) error {
+	b.check()
+	return b.Bot.BanChatMember(params)
+}
+
+func (b *lockCheckingBot) AnswerCallbackQuery(params *telego.AnswerCallbackQueryParams) error {
+	b.check()
+	return b.Bot.AnswerCallbackQuery(params)
+}
+
+func newTestFilter(t *testing.T) (*Filter, *lockCheckingBot) {
+	t.Helper()
+	logger := zap.NewNop()
+	bot := &lockCheckingBot{Bot: fakeBot.New()}
+	kickAction, err := kick.New(logger, interfaces.Deps{}, nil, bot, map[string]any{"dryRun": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := New(logger, interfaces.Deps{}, "captcha", nil, bot, map[string]any{"state_dir": t.TempDir(), "attempts": 2}, nil,
+		[]actions.Action{kickAction})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = f.Close() })
+	bot.filter = f.(*Filter)
+	return bot.filter, bot
+}
+
+func joinMessage(id int) *telego.Message {
+	return &telego.Message{
+		MessageID:      id,
+		Chat:           telego.Chat{ID: testChatID, Type: telego.ChatTypeSupergroup},
+		NewChatMembers: []telego.User{{ID: testUserID, FirstName: "user"}},
+	}
+}
+
+func callback(f *Filter, option uint32) *telego.CallbackQuery {
+	return &telego.CallbackQuery{
+		ID:      "query",
+		From:    telego.User{ID: testUserID},
+		Message: &telego.Message{Chat: telego.Chat{ID: testChatID}},
+		Data:    f.chainName + ":1000:" + string(rune('0'+option)),
+	}
+}
+
+func TestChallengeIsPostedOncePerJoin(t *testing.T) {
+	f, bot := newTestFilter(t)
+
+	f.Score(bot, joinMessage(10))
+	f.HandleNewMember(zap.NewNop(), bot, telego.Chat{ID: testChatID}, telego.User{ID: testUserID})
+
+	if n := len(bot.CallsTo(fakeBot.MethodRestrictChatMember)); n != 1 {
+		t.Errorf("user was restricted %v times, want 1", n)
+	}
+	sent := bot.CallsTo(fakeBot.MethodSendMessage)
+	if len(sent) != 1 {
+		t.Fatalf("challenge was sent %v times, want 1", len(sent))
+	}
+	params := sent[0].Params.(*telego.SendMessageParams)
+	if params.ReplyParameters == nil || params.ReplyParameters.MessageID != 10 {
+		t.Errorf("challenge is not a reply to the join message: %+v", params.ReplyParameters)
+	}
+
+	c, err := f.getChallenge(testChatID, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MessageId == 0 || c.JoinMessageId != 10 {
+		t.Errorf("unexpected challenge: %+v", c)
+	}
+	if bot.lockedCall.Load() {
+		t.Errorf("API was called with mutex held")
+	}
+}
+
+func TestSolvedChallenge(t *testing.T) {
+	f, bot := newTestFilter(t)
+	f.HandleNewMember(zap.NewNop(), bot, telego.Chat{ID: testChatID}, telego.User{ID: testUserID})
+	c, err := f.getChallenge(testChatID, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.HandleCallbackQuery(zap.NewNop(), bot, callback(f, c.Answer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.getChallenge(testChatID, testUserID); err != ErrChallengeNotFound {
+		t.Errorf("challenge was not removed: %v", err)
+	}
+	if n := len(bot.CallsTo(fakeBot.MethodRestrictChatMember)); n != 2 {
+		t.Errorf("restriction was not lifted, %v restrict calls", n)
+	}
+	if n := len(bot.CallsTo(fakeBot.MethodBanChatMember)); n != 0 {
+		t.Errorf("user who solved the challenge was kicked")
+	}
+	if bot.lockedCall.Load() {
+		t.Errorf("API was called with mutex held")
+	}
+}
+
+func TestWrongAnswers(t *testing.T) {
+	f, bot := newTestFilter(t)
+	f.HandleNewMember(zap.NewNop(), bot, telego.Chat{ID: testChatID}, telego.User{ID: testUserID})
+	c, err := f.getChallenge(testChatID, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := (c.Answer + 1) % 2
+
+	err = f.HandleCallbackQuery(zap.NewNop(), bot, callback(f, wrong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = f.getChallenge(testChatID, testUserID)
+	if err != nil {
+		t.Fatalf("challenge was removed after the first attempt: %v", err)
+	}
+	if c.AttemptsLeft != 1 {
+		t.Errorf("got %v attempts left, want 1", c.AttemptsLeft)
+	}
+
+	err = f.HandleCallbackQuery(zap.NewNop(), bot, callback(f, wrong))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.getChallenge(testChatID, testUserID); err != ErrChallengeNotFound {
+		t.Errorf("challenge was not removed: %v", err)
+	}
+	if n := len(bot.CallsTo(fakeBot.MethodBanChatMember)); n != 1 {
+		t.Errorf("user was kicked %v times, want 1", n)
+	}
+	if bot.lockedCall.Load() {
+		t.Errorf("API was called with mutex held")
+	}
+}
+
+func TestSweepFailsExpiredChallenges(t *testing.T) {
+	f, bot := newTestFilter(t)
+	f.Score(bot, joinMessage(10))
+	c, err := f.getChallenge(testChatID, testUserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.ExpiresAt = timestamppb.New(time.Now().Add(-time.Second))
+	err = f.setChallenge(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.sweep()
+	f.sweep()
+
+	if _, err := f.getChallenge(testChatID, testUserID); err != ErrChallengeNotFound {
+		t.Errorf("challenge was not removed: %v", err)
+	}
+	if n := len(bot.CallsTo(fakeBot.MethodBanChatMember)); n != 1 {
+		t.Errorf("user was kicked %v times, want 1", n)
+	}
+	deleted := make(map[int]struct{})
+	for _, call := range bot.CallsTo(fakeBot.MethodDeleteMessage) {
+		deleted[call.Params.(*telego.DeleteMessageParams).MessageID] = struct{}{}
+	}
+	for _, id := range []int{int(c.MessageId), 10} {
+		if _, ok := deleted[id]; !ok {
+			t.Errorf("message %v was not deleted", id)
+		}
+	}
+	if bot.lockedCall.Load() {
+		t.Errorf("API was called with mutex held")
+	}
+}
@@ -12,26 +12,34 @@ import (
 	actions "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/scoring"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/checkNeventsState"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
 	badgerHelper "github.com/Civil/tg-simple-regex-antispam/helper/badger"
 	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
 	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
 )
 
 var (
 	ErrStateDirEmpty = errors.New("state_dir cannot be empty")
 	ErrNIsZero       = errors.New("n cannot be equal to 0")
+	ErrThresholdZero = errors.New("threshold must be positive")
 )
 
 type Filter struct {
 	chainName      string
 	n              int
+	threshold      int32
+	aggregation    scoring.Mode
 	logger         *zap.Logger
 	filteringRules []interfaces.FilteringRule
 
 	bannedUsers bannedDB.BanDB
+	events      *events.Hub
 
 	stateDir string
 
@@ -45,7 +53,7 @@ type Filter struct {
 	tg.TGHaveAdminCommands
 }
 
-func New(logger *zap.Logger, chainName string, banDB bannedDB.BanDB, _ *telego.Bot, config map[string]any,
+func New(logger *zap.Logger, deps interfaces.Deps, chainName string, banDB bannedDB.BanDB, _ botAPI.BotAPI, config map[string]any,
 	filteringRules []interfaces.FilteringRule, actions []actions.Action,
 ) (interfaces.StatefulFilter, error) {
 	stateDir, err := config2.GetOptionString(config, "state_dir")
@@ -74,7 +82,20 @@ func New(logger *zap.Logger, chainName string, banDB bannedDB.BanDB, _ *telego.B
 		return nil, err
 	}
 
-	badgerDB, err := badger.Open(badgerOpts.GetBadgerOptions(logger, chainName+"_DB", stateDir))
+	threshold, err := config2.GetOptionIntWithDefault(config, "threshold", scoring.MaxScore)
+	if err != nil {
+		return nil, err
+	}
+	if threshold <= 0 {
+		return nil, ErrThresholdZero
+	}
+
+	aggregation, err := scoring.ParseMode(config2.GetOptionStringWithDefault(config, "aggregation", string(scoring.ModeSum)))
+	if err != nil {
+		return nil, err
+	}
+
+	badgerDB, err := badgerOpts.Open(logger, chainName+"_DB", stateDir)
 	if err != nil {
 		return nil, err
 	}
@@ -87,11 +108,14 @@ func New(logger *zap.Logger, chainName string, banDB bannedDB.BanDB, _ *telego.B
 		chainName:              chainName,
 		stateDir:               stateDir,
 		bannedUsers:            banDB,
+		events:                 deps.Events,
 		filteringRules:         filteringRules,
 		actions:                actions,
 		db:                     badgerDB,
 		isFinal:                isFinal,
 		n:                      n,
+		threshold:              int32(threshold),
+		aggregation:            aggregation,
 		warnAboutAlreadyBanned: warnAboutAlreadyBanned,
 		TGHaveAdminCommands: tg.TGHaveAdminCommands{
 			Handlers: make(map[string]tg.AdminCMDHandlerFunc),
@@ -101,7 +125,7 @@ func New(logger *zap.Logger, chainName string, banDB bannedDB.BanDB, _ *telego.B
 	for _, filter := range f.filteringRules {
 		prefix := filter.TGAdminPrefix()
 		if prefix != "" {
-			f.TGHaveAdminCommands.Handlers[prefix] = filter.HandleTGCommands
+			f.TGHaveAdminCommands.Handlers[interfaces.LocalPrefix(chainName, prefix)] = filter.HandleTGCommands
 		}
 	}
 
@@ -111,7 +135,7 @@ func New(logger *zap.Logger, chainName string, banDB bannedDB.BanDB, _ *telego.B
 }
 
 func Help() string {
-	return "checkNevents requires `stateFile` parameter"
+	return "checkNevents requires `state_dir` and `n` parameters, optional `threshold` (default 100) and `aggregation` (`sum` or `max`, default `sum`) control how scores of the rules are combined. Only the n-th message of a user, which verifies them, is used to train rules that learn from verified users, texts of earlier messages are not stored"
 }
 
 func (r *Filter) setState(userID int64, s *checkNeventsState.State) error {
@@ -143,6 +167,18 @@ func (r *Filter) getState(userID int64) (*checkNeventsState.State, error) {
 	return &s, nil
 }
 
+// IsVerified returns true if user has sent enough messages that are not spam or was verified by an admin
+func (r *Filter) IsVerified(userID int64) (bool, error) {
+	s, err := r.getState(userID)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return s.Verified, nil
+}
+
 func (r *Filter) RemoveState(userID int64) error {
 	return r.db.Update(
 		func(txn *badger.Txn) error {
@@ -150,14 +186,14 @@ func (r *Filter) RemoveState(userID int64) error {
 		})
 }
 
-func (r *Filter) Score(bot *telego.Bot, msg *telego.Message) *scoringResult.ScoringResult {
+func (r *Filter) Score(bot botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
 	r.logger.Debug("scoring message", zap.Any("message", msg))
 	userID := msg.From.ID
 	logger := r.logger.With(zap.Int64("userID", userID))
 	maxScore := &scoringResult.ScoringResult{}
 	if r.bannedUsers.IsBanned(userID) && r.warnAboutAlreadyBanned {
 		logger.Warn("user is banned, but somehow sends messages, deleting them")
-		maxScore.Score = 100
+		maxScore.Score = max(r.threshold, scoring.MaxScore)
 		maxScore.Reason = "user was already banned"
 		err := r.applyActions(logger, maxScore, msg.Chat.ChatID(), msg, []int64{int64(msg.MessageID)}, userID)
 		if err != nil {
@@ -196,21 +232,19 @@ func (r *Filter) Score(bot *telego.Bot, msg *telego.Message) *scoringResult.Scor
 	actualState.LastUpdate = timestamppb.Now()
 
 	// Checking for the filters to match the message
-	for _, filter := range r.filteringRules {
-		score := filter.Score(bot, msg)
-		if score.Score > maxScore.Score {
-			maxScore = score
-			if filter.IsFinal() {
-				break
-			}
-		}
-	}
-	if maxScore.Score == 100 {
+	maxScore = scoring.Evaluate(bot, msg, r.filteringRules, r.aggregation)
+	if maxScore.Score >= r.threshold {
 		// We don't care about State of a spammer, but we need to track if they are banned (at least for some time)
 		logger.Debug("user is a spammer, banning them",
 			zap.String("username", msg.From.Username),
 		)
-		err = r.bannedUsers.BanUser(userID)
+		err = r.bannedUsers.BanUser(userID, &banRecord.BanRecord{
+			ChatId:         msg.Chat.ID,
+			ChainName:      r.chainName,
+			RuleName:       maxScore.Rule,
+			Reason:         maxScore.Reason,
+			MessageExcerpt: tg.MessageExcerpt(msg),
+		})
 		if err != nil {
 			logger.Error("failed to ban user", zap.Error(err))
 			return maxScore
@@ -238,6 +272,8 @@ func (r *Filter) Score(bot *telego.Bot, msg *telego.Message) *scoringResult.Scor
 		logger.Debug("reached threshold, marking user as verified", zap.Int("n", r.n))
 		actualState.Verified = true
 		actualState.MessageIds = nil
+		// Only texts of messages that verify users are trained on, earlier ones are not kept
+		r.events.PublishTraining(events.Ham, tg.MessageText(msg))
 	}
 	err = r.setState(userID, actualState)
 	if err != nil {
@@ -277,12 +313,16 @@ func (r *Filter) GetName() string {
 	return "checkNEvents"
 }
 
+func (r *Filter) GetThreshold() int32 {
+	return r.threshold
+}
+
 func (r *Filter) IsFinal() bool {
 	return r.isFinal
 }
 
 func (r *Filter) Close() error {
-	return r.db.Close()
+	return errors.Join(interfaces.CloseRules(r.filteringRules), badgerOpts.Close(r.db))
 }
 
 func (r *Filter) SaveState() error {
@@ -0,0 +1,190 @@
+package flood
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/floodState"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/stateful"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+func formatLimit(l *floodState.Limit) string {
+	return fmt.Sprintf("%v messages in %v", l.GetN(), config2.FormatDuration(l.GetWindow().AsDuration()))
+}
+
+func (r *Filter) reply(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, text string) error {
+	err := tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, text)
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
+
+func (r *Filter) tgLimits(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	r.mu.Lock()
+	buf := bytes.NewBuffer([]byte{})
+	if r.limits.DefaultLimit != nil {
+		buf.WriteString(fmt.Sprintf("Default: %v (configuration: %v)\n", formatLimit(r.limits.DefaultLimit), formatLimit(r.limit)))
+	} else {
+		buf.WriteString(fmt.Sprintf("Default: %v\n", formatLimit(r.limit)))
+	}
+	chatIDs := make([]int64, 0, len(r.limits.Chats))
+	for chatID := range r.limits.Chats {
+		chatIDs = append(chatIDs, chatID)
+	}
+	slices.Sort(chatIDs)
+	for _, chatID := range chatIDs {
+		buf.WriteString(fmt.Sprintf("Chat %v: %v\n", chatID, formatLimit(r.limits.Chats[chatID])))
+	}
+	r.mu.Unlock()
+	return r.reply(logger, bot, message, buf.String())
+}
+
+// parseChatID parses optional chat id, 0 means default limit
+func parseChatID(tokens []string) (int64, error) {
+	if len(tokens) == 0 || tokens[0] == "default" {
+		return 0, nil
+	}
+	return strconv.ParseInt(tokens[0], 10, 64)
+}
+
+func (r *Filter) tgSet(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	if len(tokens) < 2 {
+		logger.Warn("invalid command", zap.Strings("tokens", tokens))
+		return stateful.ErrInvalidCommand
+	}
+	n, err := strconv.ParseUint(tokens[0], 10, 32)
+	if err != nil || n == 0 {
+		logger.Warn("invalid number of messages", zap.Strings("tokens", tokens))
+		return ErrNInvalid
+	}
+	window, err := config2.ParseDuration(tokens[1])
+	if err != nil {
+		logger.Warn("invalid window", zap.Strings("tokens", tokens), zap.Error(err))
+		return err
+	}
+	if window <= 0 {
+		return ErrWindowInvalid
+	}
+	chatID, err := parseChatID(tokens[2:])
+	if err != nil {
+		logger.Warn("invalid chat id", zap.Strings("tokens", tokens), zap.Error(err))
+		return err
+	}
+
+	limit := &floodState.Limit{N: uint32(n), Window: durationpb.New(window)}
+	err = r.updateLimits(func(limits *floodState.Limits) {
+		if chatID == 0 {
+			limits.DefaultLimit = limit
+		} else {
+			limits.Chats[chatID] = limit
+		}
+	})
+	if err != nil {
+		logger.Error("failed to save limits", zap.Error(err))
+		return err
+	}
+
+	target := "default limit"
+	if chatID != 0 {
+		target = fmt.Sprintf("limit for chat %v", chatID)
+	}
+	return r.reply(logger, bot, message, fmt.Sprintf("%v set to %v", target, formatLimit(limit)))
+}
+
+func (r *Filter) tgReset(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	chatID, err := parseChatID(tokens)
+	if err != nil {
+		logger.Warn("invalid chat id", zap.Strings("tokens", tokens), zap.Error(err))
+		return err
+	}
+
+	err = r.updateLimits(func(limits *floodState.Limits) {
+		if chatID == 0 {
+			limits.DefaultLimit = nil
+		} else {
+			delete(limits.Chats, chatID)
+		}
+	})
+	if err != nil {
+		logger.Error("failed to save limits", zap.Error(err))
+		return err
+	}
+
+	text := "default limit is reset to the configured one"
+	if chatID != 0 {
+		text = fmt.Sprintf("chat %v uses default limit now", chatID)
+	}
+	return r.reply(logger, bot, message, text)
+}
+
+func parseUserID(logger *zap.Logger, tokens []string) (int64, error) {
+	if len(tokens) < 1 {
+		logger.Warn("invalid command", zap.Strings("tokens", tokens))
+		return 0, stateful.ErrInvalidCommand
+	}
+	userID, err := strconv.ParseInt(tokens[0], 10, 64)
+	if err != nil {
+		logger.Warn("invalid user id", zap.Strings("tokens", tokens), zap.Error(err))
+		return 0, stateful.ErrUserIDInvalid
+	}
+	return userID, nil
+}
+
+func (r *Filter) tgStrikes(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	userID, err := parseUserID(logger, tokens)
+	if err != nil {
+		return err
+	}
+	s, err := r.getStrikes(userID)
+	if err != nil {
+		logger.Error("failed to get strikes", zap.Int64("user_id", userID), zap.Error(err))
+		return err
+	}
+	text := fmt.Sprintf("user %v has no recent violations", userID)
+	if s.Count > 0 {
+		text = fmt.Sprintf("user %v has %v violations, last one at %v", userID, s.Count,
+			s.GetLastViolation().AsTime().Format(time.RFC3339))
+	}
+	return r.reply(logger, bot, message, text)
+}
+
+func (r *Filter) tgForgive(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
+	userID, err := parseUserID(logger, tokens)
+	if err != nil {
+		return err
+	}
+	err = r.RemoveState(userID)
+	if err != nil {
+		logger.Error("failed to remove strikes", zap.Int64("user_id", userID), zap.Error(err))
+		return err
+	}
+	return r.reply(logger, bot, message, fmt.Sprintf("violations of user %v are forgotten", userID))
+}
+
+func (r *Filter) tgHelp(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString("Available commands:\n")
+	buf.WriteString(" - `limits` - show current limits\n")
+	buf.WriteString(" - `set <n> <window> [chat_id]` - allow at most n messages within the window, e.g. `set 5 10s`. Limit applies to all chats if chat_id is not set\n")
+	buf.WriteString(" - `reset [chat_id]` - remove limit of the chat or return default limit to the configured one\n")
+	buf.WriteString(" - `strikes <user_id>` - show how many times user flooded recently\n")
+	buf.WriteString(" - `forgive <user_id>` - forget violations of the user, next one would be handled as the first\n")
+	buf.WriteString(" - `help` - this help\n")
+
+	err := tg.SendMarkdownMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
+	if err != nil {
+		logger.Error("failed to send message", zap.Error(err))
+	}
+	return err
+}
@@ -0,0 +1,434 @@
+package flood
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	actions "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/scoring"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/floodState"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
+	badgerHelper "github.com/Civil/tg-simple-regex-antispam/helper/badger"
+	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+var (
+	ErrStateDirEmpty    = errors.New("state_dir cannot be empty")
+	ErrNInvalid         = errors.New("n must be positive")
+	ErrWindowInvalid    = errors.New("window must be positive")
+	ErrStrikeTTLInvalid = errors.New("strike_ttl cannot be negative")
+)
+
+var limitsKey = []byte("limits")
+
+const strikesPrefix = 's'
+
+// message is a message that is still within the window
+type message struct {
+	at time.Time
+	id int64
+	// handled is set once actions were applied to the message
+	handled bool
+}
+
+type windowKey struct {
+	chatID int64
+	userID int64
+}
+
+// Filter limits rate of messages of every user in every chat. Users that send more than n messages within the window
+// are handled by the chain's actions. With escalation enabled, first violation applies first action, second one
+// applies second action and so on, the last action is used for all further violations.
+//
+// Recent messages are tracked in memory, only strikes and limits set by admins are stored in the database.
+type Filter struct {
+	chainName string
+	logger    *zap.Logger
+
+	db      *badger.DB
+	actions []actions.Action
+
+	// limit from the configuration
+	limit     *floodState.Limit
+	escalate  bool
+	strikeTTL time.Duration
+	isFinal   bool
+
+	// Protects windows and limits
+	mu      sync.Mutex
+	windows map[windowKey][]message
+	limits  *floodState.Limits
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	tg.TGHaveAdminCommands
+}
+
+func New(logger *zap.Logger, _ interfaces.Deps, chainName string, _ bannedDB.BanDB, _ botAPI.BotAPI, config map[string]any,
+	_ []interfaces.FilteringRule, actions []actions.Action,
+) (interfaces.StatefulFilter, error) {
+	stateDir, err := config2.GetOptionString(config, "state_dir")
+	if err != nil {
+		return nil, err
+	}
+	if stateDir == "" {
+		return nil, ErrStateDirEmpty
+	}
+
+	n, err := config2.GetOptionInt(config, "n")
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, ErrNInvalid
+	}
+
+	window, err := config2.GetOptionDurationWithDefault(config, "window", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	if window <= 0 {
+		return nil, ErrWindowInvalid
+	}
+
+	escalate, err := config2.GetOptionBoolWithDefault(config, "escalate", true)
+	if err != nil {
+		return nil, err
+	}
+
+	strikeTTL, err := config2.GetOptionDurationWithDefault(config, "strike_ttl", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	if strikeTTL < 0 {
+		return nil, ErrStrikeTTLInvalid
+	}
+
+	isFinal, err := config2.GetOptionBoolWithDefault(config, "isFinal", false)
+	if err != nil {
+		return nil, err
+	}
+
+	badgerDB, err := badgerOpts.Open(logger, chainName+"_DB", stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		logger: logger.With(
+			zap.String("filter", chainName),
+			zap.String("filter_type", "flood"),
+		),
+		chainName: chainName,
+		db:        badgerDB,
+		actions:   actions,
+		limit:     &floodState.Limit{N: uint32(n), Window: durationpb.New(window)},
+		escalate:  escalate,
+		strikeTTL: strikeTTL,
+		isFinal:   isFinal,
+		windows:   make(map[windowKey][]message),
+		stop:      make(chan struct{}),
+	}
+	f.limits, err = f.loadLimits()
+	if err != nil {
+		_ = badgerOpts.Close(badgerDB)
+		return nil, err
+	}
+	f.TGHaveAdminCommands = tg.TGHaveAdminCommands{
+		Handlers: map[string]tg.AdminCMDHandlerFunc{
+			"limits":  f.tgLimits,
+			"set":     f.tgSet,
+			"reset":   f.tgReset,
+			"strikes": f.tgStrikes,
+			"forgive": f.tgForgive,
+			"help":    f.tgHelp,
+		},
+	}
+
+	f.wg.Add(1)
+	go f.sweepLoop()
+
+	return f, nil
+}
+
+func Help() string {
+	return "flood requires `state_dir` and `n` (maximum number of messages within the window) parameters, optional: `window` (default 10s), `escalate` (default true, apply n-th action on n-th violation instead of all of them), `strike_ttl` (default 24h, violations are forgotten after that time)"
+}
+
+func (r *Filter) loadLimits() (*floodState.Limits, error) {
+	limits := &floodState.Limits{}
+	err := r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(limitsKey)
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return proto.Unmarshal(val, limits)
+		})
+	})
+	if err != nil && !errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, err
+	}
+	if limits.Chats == nil {
+		limits.Chats = make(map[int64]*floodState.Limit)
+	}
+	return limits, nil
+}
+
+// updateLimits applies update to a copy of limits and uses it once it is saved. Limits are kept intact if save fails.
+func (r *Filter) updateLimits(update func(limits *floodState.Limits)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limits := proto.Clone(r.limits).(*floodState.Limits)
+	if limits.Chats == nil {
+		limits.Chats = make(map[int64]*floodState.Limit)
+	}
+	update(limits)
+	b, err := proto.Marshal(limits)
+	if err != nil {
+		return err
+	}
+	err = r.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(limitsKey, b)
+	})
+	if err != nil {
+		return err
+	}
+	r.limits = limits
+	return nil
+}
+
+// limitFor returns limit that applies to the chat. Must be called with mutex held.
+func (r *Filter) limitFor(chatID int64) *floodState.Limit {
+	if l, ok := r.limits.Chats[chatID]; ok {
+		return l
+	}
+	if r.limits.DefaultLimit != nil {
+		return r.limits.DefaultLimit
+	}
+	return r.limit
+}
+
+func strikesKey(userID int64) []byte {
+	return append([]byte{strikesPrefix}, badgerHelper.UserIDToKey(userID)...)
+}
+
+func (r *Filter) getStrikes(userID int64) (*floodState.Strikes, error) {
+	var s floodState.Strikes
+	err := r.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(strikesKey(userID))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return proto.Unmarshal(val, &s)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.strikeTTL > 0 && time.Since(s.GetLastViolation().AsTime()) > r.strikeTTL {
+		return &floodState.Strikes{}, nil
+	}
+	return &s, nil
+}
+
+// addStrike records violation and returns number of violations, including this one
+func (r *Filter) addStrike(userID int64) (uint32, error) {
+	s, err := r.getStrikes(userID)
+	if err != nil {
+		return 0, err
+	}
+	s.Count++
+	s.LastViolation = timestamppb.Now()
+	b, err := proto.Marshal(s)
+	if err != nil {
+		return 0, err
+	}
+	err = r.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(strikesKey(userID), b)
+	})
+	return s.Count, err
+}
+
+func (r *Filter) removeStrikes(userID int64) error {
+	return r.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(strikesKey(userID))
+	})
+}
+
+// track adds message to the window of the user and returns messages within the window that were not handled yet if
+// there are more of them than limit allows. Window is kept, so every further message within it is another violation
+// and escalation is driven by strikes.
+func (r *Filter) track(chatID, userID int64, messageID int64, now time.Time) ([]int64, *floodState.Limit) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	limit := r.limitFor(chatID)
+	key := windowKey{chatID: chatID, userID: userID}
+	cutoff := now.Add(-limit.GetWindow().AsDuration())
+	msgs := r.windows[key]
+	i := 0
+	for i < len(msgs) && msgs[i].at.Before(cutoff) {
+		i++
+	}
+	msgs = append(msgs[i:], message{at: now, id: messageID})
+	r.windows[key] = msgs
+	if len(msgs) <= int(limit.GetN()) {
+		return nil, limit
+	}
+	ids := make([]int64, 0, len(msgs))
+	for i := range msgs {
+		if !msgs[i].handled {
+			ids = append(ids, msgs[i].id)
+			msgs[i].handled = true
+		}
+	}
+	return ids, limit
+}
+
+// actionsFor returns actions that are applied on the violation with the number
+func (r *Filter) actionsFor(strike uint32) []actions.Action {
+	if !r.escalate || len(r.actions) == 0 {
+		return r.actions
+	}
+	i := min(int(strike), len(r.actions)) - 1
+	return r.actions[i : i+1]
+}
+
+func (r *Filter) Score(_ botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
+	score := &scoringResult.ScoringResult{}
+	if msg.From == nil || msg.From.IsBot || len(msg.NewChatMembers) > 0 {
+		return score
+	}
+	userID := msg.From.ID
+	messageIDs, limit := r.track(msg.Chat.ID, userID, int64(msg.MessageID), time.Now())
+	if messageIDs == nil {
+		return score
+	}
+
+	logger := r.logger.With(zap.Int64("chat_id", msg.Chat.ID), zap.Int64("user_id", userID))
+	strike, err := r.addStrike(userID)
+	if err != nil {
+		logger.Error("failed to record strike", zap.Error(err))
+		strike = 1
+	}
+	logger.Info("user is flooding", zap.Int("messages", len(messageIDs)), zap.Uint32("strike", strike))
+
+	score.Score = scoring.MaxScore
+	score.Reason = fmt.Sprintf("more than %v messages in %v, violation #%v", limit.GetN(),
+		config2.FormatDuration(limit.GetWindow().AsDuration()), strike)
+	for _, action := range r.actionsFor(strike) {
+		if action.PerMessage() {
+			err = action.ApplyToMessage(r, score, msg)
+		} else {
+			err = action.Apply(r, score, msg.Chat.ChatID(), messageIDs, userID)
+		}
+		if err != nil {
+			logger.Error("failed to apply action", zap.String("action", action.GetName()), zap.Error(err))
+		}
+	}
+	return score
+}
+
+// sweep forgets windows without recent messages
+func (r *Filter) sweep() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for key, msgs := range r.windows {
+		window := r.limitFor(key.chatID).GetWindow().AsDuration()
+		if now.Sub(msgs[len(msgs)-1].at) > window {
+			delete(r.windows, key)
+		}
+	}
+}
+
+func (r *Filter) sweepLoop() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.sweep()
+		}
+	}
+}
+
+// RemoveState forgets recent messages and violations of the user
+func (r *Filter) RemoveState(userID int64) error {
+	r.mu.Lock()
+	for key := range r.windows {
+		if key.userID == userID {
+			delete(r.windows, key)
+		}
+	}
+	r.mu.Unlock()
+	return r.removeStrikes(userID)
+}
+
+func (r *Filter) UnbanUser(userID int64) error {
+	return r.RemoveState(userID)
+}
+
+func (r *Filter) GetThreshold() int32 {
+	return scoring.MaxScore
+}
+
+func (r *Filter) IsStateful() bool {
+	return true
+}
+
+func (r *Filter) GetName() string {
+	return "flood"
+}
+
+func (r *Filter) GetFilterName() string {
+	return r.chainName
+}
+
+func (r *Filter) IsFinal() bool {
+	return r.isFinal
+}
+
+func (r *Filter) Close() error {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	r.wg.Wait()
+	return badgerOpts.Close(r.db)
+}
+
+func (r *Filter) SaveState() error {
+	return nil
+}
+
+func (r *Filter) LoadState() error {
+	return nil
+}
+
+func (r *Filter) TGAdminPrefix() string {
+	return r.chainName
+}
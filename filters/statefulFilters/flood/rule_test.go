@@ -0,0 +1,78 @@
+package flood
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/floodState"
+)
+
+const testChatID = -100
+
+func newTestFilter(t *testing.T) *Filter {
+	t.Helper()
+	f, err := New(zap.NewNop(), interfaces.Deps{}, "flood", nil, nil,
+		map[string]any{"state_dir": t.TempDir(), "n": 2, "window": "10s"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f.(*Filter)
+}
+
+func TestWindowIsKeptAfterViolation(t *testing.T) {
+	f := newTestFilter(t)
+	t.Cleanup(func() { _ = f.Close() })
+	now := time.Now()
+
+	tests := []struct {
+		messageID int64
+		want      []int64
+	}{
+		{messageID: 1},
+		{messageID: 2},
+		{messageID: 3, want: []int64{1, 2, 3}},
+		{messageID: 4, want: []int64{4}},
+	}
+	for i, tt := range tests {
+		ids, _ := f.track(testChatID, 1000, tt.messageID, now.Add(time.Duration(i)*time.Second))
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("message %v: got %v, want %v", tt.messageID, ids, tt.want)
+		}
+	}
+
+	ids, _ := f.track(testChatID, 1000, 5, now.Add(time.Minute))
+	if ids != nil {
+		t.Errorf("messages outside of the window are counted: %v", ids)
+	}
+}
+
+func TestFailedSaveKeepsLimits(t *testing.T) {
+	f := newTestFilter(t)
+	limit := &floodState.Limit{N: 5, Window: durationpb.New(time.Minute)}
+	err := f.updateLimits(func(limits *floodState.Limits) {
+		limits.Chats[testChatID] = limit
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.updateLimits(func(limits *floodState.Limits) {
+		delete(limits.Chats, testChatID)
+		limits.DefaultLimit = limit
+	})
+	if err == nil {
+		t.Fatal("limits were saved to closed database")
+	}
+	if f.limitFor(testChatID).GetN() != 5 || f.limits.DefaultLimit != nil {
+		t.Errorf("limits were changed by failed update: %v", f.limits)
+	}
+}
@@ -11,12 +11,16 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 
 	actions "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/audit"
 	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/scoring"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/checkNeventsState"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types/scoringResult"
 	badgerHelper "github.com/Civil/tg-simple-regex-antispam/helper/badger"
 	"github.com/Civil/tg-simple-regex-antispam/helper/badger/badgerOpts"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	config2 "github.com/Civil/tg-simple-regex-antispam/helper/config"
 	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
 )
@@ -35,14 +39,15 @@ type Filter struct {
 	filteringRules []interfaces.FilteringRule
 	actions        []actions.Action
 
-	db  *badger.DB
-	bot *telego.Bot
+	db       *badger.DB
+	bot      botAPI.BotAPI
+	auditLog *audit.Log
 
 	isFinal         bool
 	removeReportMsg bool
 }
 
-func New(logger *zap.Logger, chainName string, _ bannedDB.BanDB, bot *telego.Bot, config map[string]any,
+func New(logger *zap.Logger, deps interfaces.Deps, chainName string, _ bannedDB.BanDB, bot botAPI.BotAPI, config map[string]any,
 	filteringRules []interfaces.FilteringRule, actions []actions.Action,
 ) (interfaces.StatefulFilter, error) {
 	var stateDir string
@@ -65,7 +70,7 @@ func New(logger *zap.Logger, chainName string, _ bannedDB.BanDB, bot *telego.Bot
 		return nil, err
 	}
 
-	badgerDB, err := badger.Open(badgerOpts.GetBadgerOptions(logger, chainName+"_DB", stateDir))
+	badgerDB, err := badgerOpts.Open(logger, chainName+"_DB", stateDir)
 	if err != nil {
 		return nil, err
 	}
@@ -79,6 +84,7 @@ func New(logger *zap.Logger, chainName string, _ bannedDB.BanDB, bot *telego.Bot
 		stateDir:        stateDir,
 		db:              badgerDB,
 		bot:             bot,
+		auditLog:        deps.Audit,
 		isFinal:         isFinal,
 		filteringRules:  filteringRules,
 		removeReportMsg: removeReportMsg,
@@ -127,7 +133,7 @@ func (r *Filter) RemoveState(userID int64) error {
 		})
 }
 
-func (r *Filter) Score(bot *telego.Bot, msg *telego.Message) *scoringResult.ScoringResult {
+func (r *Filter) Score(bot botAPI.BotAPI, msg *telego.Message) *scoringResult.ScoringResult {
 	score := &scoringResult.ScoringResult{}
 	if !strings.HasPrefix(msg.Text, "/report") {
 		r.logger.Debug("message does not start with /report")
@@ -191,6 +197,19 @@ func (r *Filter) Score(bot *telego.Bot, msg *telego.Message) *scoringResult.Scor
 	r.logger.Debug("applying actions...")
 	score.Score = 100
 	score.Reason = "reported command"
+	event := &auditEvent.AuditEvent{
+		Action:  audit.ActionReport,
+		ChatId:  msg.Chat.ID,
+		Chain:   r.chainName,
+		Details: tg.MessageExcerpt(reportedMsg),
+	}
+	if msg.From != nil {
+		event.ActorId = msg.From.ID
+	}
+	if reportedMsg.From != nil {
+		event.UserId = reportedMsg.From.ID
+	}
+	r.auditLog.Record(event)
 	for _, action := range r.actions {
 		r.logger.Debug("trying to apply action",
 			zap.Any("message_ids", actualState.MessageIds),
@@ -232,7 +251,7 @@ func (r *Filter) IsFinal() bool {
 }
 
 func (r *Filter) Close() error {
-	return r.db.Close()
+	return errors.Join(interfaces.CloseRules(r.filteringRules), badgerOpts.Close(r.db))
 }
 
 func (r *Filter) SaveState() error {
@@ -243,6 +262,10 @@ func (r *Filter) LoadState() error {
 	return nil
 }
 
+func (r *Filter) GetThreshold() int32 {
+	return scoring.MaxScore
+}
+
 func (r *Filter) TGAdminPrefix() string {
 	return ""
 }
@@ -251,6 +274,6 @@ func (r *Filter) UnbanUser(_ int64) error {
 	return nil
 }
 
-func (r *Filter) HandleTGCommands(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error {
+func (r *Filter) HandleTGCommands(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
 	return nil
 }
@@ -3,46 +3,77 @@ package filters
 import (
 	"errors"
 
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/filters/filteringRules/bayes"
+	"github.com/Civil/tg-simple-regex-antispam/filters/filteringRules/composite"
 	"github.com/Civil/tg-simple-regex-antispam/filters/filteringRules/hasEmoji"
 	"github.com/Civil/tg-simple-regex-antispam/filters/filteringRules/hasLinks"
 	"github.com/Civil/tg-simple-regex-antispam/filters/filteringRules/isForward"
+	"github.com/Civil/tg-simple-regex-antispam/filters/filteringRules/nearDuplicate"
 	"github.com/Civil/tg-simple-regex-antispam/filters/filteringRules/partialMatch"
 	"github.com/Civil/tg-simple-regex-antispam/filters/filteringRules/regex"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/filters/scoring"
+	"github.com/Civil/tg-simple-regex-antispam/filters/statefulFilters/campaign"
+	"github.com/Civil/tg-simple-regex-antispam/filters/statefulFilters/captcha"
 	"github.com/Civil/tg-simple-regex-antispam/filters/statefulFilters/checkNevents"
+	"github.com/Civil/tg-simple-regex-antispam/filters/statefulFilters/flood"
 	"github.com/Civil/tg-simple-regex-antispam/filters/statefulFilters/report"
 	"github.com/Civil/tg-simple-regex-antispam/filters/types"
 )
 
 var (
 	supportedFilteringRules = map[string]interfaces.InitFunc{
-		"regex":        regex.New,
-		"partialMatch": partialMatch.New,
-		"isForward":    isForward.New,
-		"hasEmoji":     hasEmoji.New,
-		"hasLinks":     hasLinks.New,
+		"regex":         regex.New,
+		"partialMatch":  partialMatch.New,
+		"isForward":     isForward.New,
+		"hasEmoji":      hasEmoji.New,
+		"hasLinks":      hasLinks.New,
+		"nearDuplicate": nearDuplicate.New,
+		"bayes":         bayes.New,
 	}
 	supportedFilteringRulesHelp = map[string]interfaces.HelpFunc{
-		"regex":        regex.Help,
-		"partialMatch": partialMatch.Help,
-		"isForward":    isForward.Help,
-		"hasEmoji":     hasEmoji.Help,
-		"hasLinks":     hasLinks.Help,
+		"regex":         regex.Help,
+		"partialMatch":  partialMatch.Help,
+		"isForward":     isForward.Help,
+		"hasEmoji":      hasEmoji.Help,
+		"hasLinks":      hasLinks.Help,
+		"nearDuplicate": nearDuplicate.Help,
+		"bayes":         bayes.Help,
 	}
 )
 
+// Composite rules create nested rules through the registry, so they can't be part of its initializer
+func init() {
+	for _, op := range composite.Operators {
+		supportedFilteringRules[string(op)] = composite.NewInitFunc(op, NewFilteringRule)
+		supportedFilteringRulesHelp[string(op)] = composite.Help
+	}
+}
+
 var (
 	supportedStatefulFilters = map[string]types.StatefulInitFunc{
 		"checkNevents": checkNevents.New,
 		"report":       report.New,
+		"captcha":      captcha.New,
+		"flood":        flood.New,
+		"campaign":     campaign.New,
 	}
 	supportedStatefulFiltersHelp = map[string]interfaces.HelpFunc{
 		"checkNevents": checkNevents.Help,
 		"report":       report.Help,
+		"captcha":      captcha.Help,
+		"flood":        flood.Help,
+		"campaign":     campaign.Help,
 	}
 )
 
-var ErrUknownStatefulFilter = errors.New("unknown stateful filter")
+var (
+	ErrUknownStatefulFilter = errors.New("unknown stateful filter")
+	ErrUnknownFilteringRule = errors.New("unknown filtering rule")
+)
 
 func GetStatefulFilter(name string) (types.StatefulInitFunc, error) {
 	initFunc, ok := supportedStatefulFilters[name]
@@ -64,6 +95,23 @@ func GetFilteringRules() map[string]interfaces.InitFunc {
 	return supportedFilteringRules
 }
 
+// NewFilteringRule creates filtering rule from its configuration, applying rule's weight. name must be unique among
+// all rules, see interfaces.RuleNames.
+func NewFilteringRule(logger *zap.Logger, deps interfaces.Deps, name string, cfg config.StatelessFilteringRules) (interfaces.FilteringRule, error) {
+	fInit, ok := supportedFilteringRules[cfg.Name]
+	if !ok {
+		logger.Error("unsupported filtering rule", zap.String("rule", cfg.Name))
+		return nil, ErrUnknownFilteringRule
+	}
+
+	r, err := fInit(logger, deps, cfg.Arguments, name)
+	if err != nil {
+		logger.Error("error initializing filtering rule", zap.String("rule", cfg.Name), zap.Error(err))
+		return nil, err
+	}
+	return scoring.NewWeighted(r, cfg.Weight, cfg.FilterName), nil
+}
+
 func GetFilteringRulesHelp() map[string]interfaces.HelpFunc {
 	return supportedFilteringRulesHelp
 }
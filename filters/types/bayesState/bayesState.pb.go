@@ -0,0 +1,154 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.34.2
+// 	protoc        v5.27.3
+// source: bayesState.proto
+
+package bayesState
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Counts struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Spam uint64 `protobuf:"varint,1,opt,name=spam,proto3" json:"spam,omitempty"`
+	Ham  uint64 `protobuf:"varint,2,opt,name=ham,proto3" json:"ham,omitempty"`
+}
+
+func (x *Counts) Reset() {
+	*x = Counts{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_bayesState_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Counts) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Counts) ProtoMessage() {}
+
+func (x *Counts) ProtoReflect() protoreflect.Message {
+	mi := &file_bayesState_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Counts.ProtoReflect.Descriptor instead.
+func (*Counts) Descriptor() ([]byte, []int) {
+	return file_bayesState_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Counts) GetSpam() uint64 {
+	if x != nil {
+		return x.Spam
+	}
+	return 0
+}
+
+func (x *Counts) GetHam() uint64 {
+	if x != nil {
+		return x.Ham
+	}
+	return 0
+}
+
+var File_bayesState_proto protoreflect.FileDescriptor
+
+var file_bayesState_proto_rawDesc = []byte{
+	0x0a, 0x10, 0x62, 0x61, 0x79, 0x65, 0x73, 0x53, 0x74, 0x61, 0x74, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x0a, 0x62, 0x61, 0x79, 0x65, 0x73, 0x53, 0x74, 0x61, 0x74, 0x65, 0x22, 0x2e,
+	0x0a, 0x06, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x70, 0x61, 0x6d,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x73, 0x70, 0x61, 0x6d, 0x12, 0x10, 0x0a, 0x03,
+	0x68, 0x61, 0x6d, 0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x68, 0x61, 0x6d, 0x42, 0x44,
+	0x5a, 0x42, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x43, 0x69, 0x76,
+	0x69, 0x6c, 0x2f, 0x74, 0x67, 0x2d, 0x73, 0x69, 0x6d, 0x70, 0x6c, 0x65, 0x2d, 0x72, 0x65, 0x67,
+	0x65, 0x78, 0x2d, 0x61, 0x6e, 0x74, 0x69, 0x73, 0x61, 0x70, 0x6d, 0x2f, 0x66, 0x69, 0x6c, 0x74,
+	0x65, 0x72, 0x73, 0x2f, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2f, 0x62, 0x61, 0x79, 0x65, 0x73, 0x53,
+	0x74, 0x61, 0x74, 0x65, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_bayesState_proto_rawDescOnce sync.Once
+	file_bayesState_proto_rawDescData = file_bayesState_proto_rawDesc
+)
+
+func file_bayesState_proto_rawDescGZIP() []byte {
+	file_bayesState_proto_rawDescOnce.Do(func() {
+		file_bayesState_proto_rawDescData = protoimpl.X.CompressGZIP(file_bayesState_proto_rawDescData)
+	})
+	return file_bayesState_proto_rawDescData
+}
+
+var file_bayesState_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_bayesState_proto_goTypes = []any{
+	(*Counts)(nil), // 0: bayesState.Counts
+}
+var file_bayesState_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_bayesState_proto_init() }
+func file_bayesState_proto_init() {
+	if File_bayesState_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_bayesState_proto_msgTypes[0].Exporter = func(v any, i int) any {
+			switch v := v.(*Counts); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_bayesState_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_bayesState_proto_goTypes,
+		DependencyIndexes: file_bayesState_proto_depIdxs,
+		MessageInfos:      file_bayesState_proto_msgTypes,
+	}.Build()
+	File_bayesState_proto = out.File
+	file_bayesState_proto_rawDesc = nil
+	file_bayesState_proto_goTypes = nil
+	file_bayesState_proto_depIdxs = nil
+}
@@ -0,0 +1,3 @@
+package bayesState
+
+//go:generate protoc --proto_path=. --go_out=. --go_opt=paths=source_relative bayesState.proto
@@ -0,0 +1,3 @@
+package campaignState
+
+//go:generate protoc --proto_path=. --go_out=. --go_opt=paths=source_relative campaignState.proto
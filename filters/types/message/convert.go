@@ -0,0 +1,203 @@
+package message
+
+import (
+	"github.com/mymmrac/telego"
+)
+
+func (f *From) toTelego() *telego.User {
+	if f == nil {
+		return nil
+	}
+	return &telego.User{
+		ID:        int64(f.Id),
+		IsBot:     f.IsBot,
+		FirstName: f.FirstName,
+		Username:  f.Username,
+	}
+}
+
+func (c *Chat) toTelego() telego.Chat {
+	if c == nil {
+		return telego.Chat{}
+	}
+	return telego.Chat{
+		ID:       c.Id,
+		Type:     c.Type,
+		Title:    c.Title,
+		Username: c.Username,
+	}
+}
+
+func (o *ForwardOrigin) toTelego() telego.MessageOrigin {
+	if o == nil {
+		return nil
+	}
+	switch o.Type {
+	case telego.OriginTypeUser:
+		res := &telego.MessageOriginUser{
+			Type: o.Type,
+			Date: int64(o.Date),
+		}
+		if o.SenderUser != nil {
+			res.SenderUser = telego.User{
+				ID:        int64(o.SenderUser.Id),
+				IsBot:     o.SenderUser.IsBot,
+				FirstName: o.SenderUser.FirstName,
+				Username:  o.SenderUser.Username,
+				IsPremium: o.SenderUser.IsPremium,
+			}
+		}
+		return res
+	case telego.OriginTypeChat:
+		return &telego.MessageOriginChat{
+			Type: o.Type,
+			Date: int64(o.Date),
+		}
+	case telego.OriginTypeChannel:
+		return &telego.MessageOriginChannel{
+			Type: o.Type,
+			Date: int64(o.Date),
+		}
+	default:
+		return &telego.MessageOriginHiddenUser{
+			Type: telego.OriginTypeHiddenUser,
+			Date: int64(o.Date),
+		}
+	}
+}
+
+// ToTelego converts stored message to the form that filters and actions work with. Only fields that are present
+// in the proto are filled.
+func (m *Message) ToTelego() *telego.Message {
+	res := &telego.Message{
+		MessageID:       int(m.MessageId),
+		MessageThreadID: int(m.MessageThreadId),
+		From:            m.From.toTelego(),
+		Date:            int64(m.Date),
+		Chat:            m.Chat.toTelego(),
+		ForwardOrigin:   m.ForwardOrigin.toTelego(),
+		Text:            m.Text,
+		Caption:         m.Caption,
+	}
+
+	for _, e := range m.Entities {
+		res.Entities = append(res.Entities, telego.MessageEntity{
+			Type:   e.Type,
+			Offset: int(e.Offset),
+			Length: int(e.Length),
+		})
+	}
+
+	for _, p := range m.Photo {
+		res.Photo = append(res.Photo, telego.PhotoSize{
+			FileID:       p.FileId,
+			FileUniqueID: p.FileUniqueId,
+			Width:        int(p.Width),
+			Height:       int(p.Height),
+			FileSize:     int(p.FileSize),
+		})
+	}
+
+	if r := m.ReplyToMessage; r != nil {
+		res.ReplyToMessage = &telego.Message{
+			MessageID:       int(r.MessageId),
+			MessageThreadID: int(r.MessageThreadId),
+			From:            r.From.toTelego(),
+			Date:            int64(r.Date),
+			Chat:            r.Chat.toTelego(),
+			Text:            r.Text,
+		}
+	}
+
+	return res
+}
+
+func fromTelegoUser(u *telego.User) *From {
+	if u == nil {
+		return nil
+	}
+	return &From{
+		Id:        uint64(u.ID),
+		IsBot:     u.IsBot,
+		FirstName: u.FirstName,
+		Username:  u.Username,
+	}
+}
+
+func fromTelegoChat(c *telego.Chat) *Chat {
+	return &Chat{
+		Id:       c.ID,
+		Type:     c.Type,
+		Title:    c.Title,
+		Username: c.Username,
+	}
+}
+
+func fromTelegoOrigin(o telego.MessageOrigin) *ForwardOrigin {
+	if o == nil {
+		return nil
+	}
+	res := &ForwardOrigin{
+		Type: o.OriginType(),
+		Date: uint32(o.OriginalDate()),
+	}
+	if u, ok := o.(*telego.MessageOriginUser); ok {
+		res.SenderUser = &SenderUser{
+			Id:        uint64(u.SenderUser.ID),
+			IsBot:     u.SenderUser.IsBot,
+			FirstName: u.SenderUser.FirstName,
+			Username:  u.SenderUser.Username,
+			IsPremium: u.SenderUser.IsPremium,
+		}
+	}
+	return res
+}
+
+// FromTelego converts message to its stored form, fields that are not present in the proto are dropped
+func FromTelego(msg *telego.Message) *Message {
+	res := &Message{
+		MessageId:       uint32(msg.MessageID),
+		MessageThreadId: uint32(msg.MessageThreadID),
+		From:            fromTelegoUser(msg.From),
+		Date:            uint32(msg.Date),
+		Chat:            fromTelegoChat(&msg.Chat),
+		ForwardOrigin:   fromTelegoOrigin(msg.ForwardOrigin),
+		Text:            msg.Text,
+		Caption:         msg.Caption,
+	}
+
+	entities := msg.Entities
+	if len(entities) == 0 {
+		entities = msg.CaptionEntities
+	}
+	for _, e := range entities {
+		res.Entities = append(res.Entities, &Entities{
+			Type:   e.Type,
+			Offset: uint32(e.Offset),
+			Length: uint32(e.Length),
+		})
+	}
+
+	for _, p := range msg.Photo {
+		res.Photo = append(res.Photo, &Photo{
+			FileId:       p.FileID,
+			FileUniqueId: p.FileUniqueID,
+			Width:        uint32(p.Width),
+			Height:       uint32(p.Height),
+			FileSize:     uint32(p.FileSize),
+		})
+	}
+
+	if r := msg.ReplyToMessage; r != nil {
+		res.ReplyToMessage = &ReplyToMessage{
+			MessageId:       uint32(r.MessageID),
+			MessageThreadId: uint32(r.MessageThreadID),
+			From:            fromTelegoUser(r.From),
+			Date:            uint32(r.Date),
+			Chat:            fromTelegoChat(&r.Chat),
+			Text:            r.Text,
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,3 @@
+package nearDuplicateState
+
+//go:generate protoc --proto_path=. --go_out=. --go_opt=paths=source_relative nearDuplicateState.proto
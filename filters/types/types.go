@@ -1,13 +1,13 @@
 package types
 
 import (
-	"github.com/mymmrac/telego"
 	"go.uber.org/zap"
 
 	actions "github.com/Civil/tg-simple-regex-antispam/actions/interfaces"
 	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
 	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 )
 
-type StatefulInitFunc func(*zap.Logger, string, bannedDB.BanDB, *telego.Bot, map[string]any, []interfaces.FilteringRule, []actions.Action) (interfaces.StatefulFilter,
+type StatefulInitFunc func(*zap.Logger, interfaces.Deps, string, bannedDB.BanDB, botAPI.BotAPI, map[string]any, []interfaces.FilteringRule, []actions.Action) (interfaces.StatefulFilter,
 	error)
@@ -0,0 +1,109 @@
+package badgerOpts
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/metrics"
+)
+
+var ErrDirInUse = errors.New("directory is already used by another rule or chain")
+
+type openDB struct {
+	db    *badger.DB
+	inUse bool
+}
+
+var open = struct {
+	mu      sync.Mutex
+	byDir   map[string]*openDB
+	byDB    map[*badger.DB]string
+	handoff bool
+}{
+	byDir: make(map[string]*openDB),
+	byDB:  make(map[*badger.DB]string),
+}
+
+// Open opens database in the dir. Every dir can be used by only one rule or chain at a time, so misconfigured ones
+// that would overwrite each other's state are rejected. Database that was closed during handoff (see StartHandoff)
+// is reused instead of being opened again. Database is tracked in metrics.
+func Open(logger *zap.Logger, badgerDBname string, dir string) (*badger.DB, error) {
+	key, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	open.mu.Lock()
+	defer open.mu.Unlock()
+	if o, ok := open.byDir[key]; ok {
+		if o.inUse {
+			return nil, fmt.Errorf("%w: %v", ErrDirInUse, dir)
+		}
+		o.inUse = true
+		metrics.UntrackBadger(o.db)
+		metrics.TrackBadger(badgerDBname, o.db)
+		return o.db, nil
+	}
+
+	db, err := badger.Open(GetBadgerOptions(logger, badgerDBname, dir))
+	if err != nil {
+		return nil, err
+	}
+	metrics.TrackBadger(badgerDBname, db)
+	open.byDir[key] = &openDB{db: db, inUse: true}
+	open.byDB[db] = key
+	return db, nil
+}
+
+// Close closes database returned by Open. During handoff database is kept open until FinishHandoff, so that the
+// one who replaces the owner gets it without reopening.
+func Close(db *badger.DB) error {
+	open.mu.Lock()
+	defer open.mu.Unlock()
+	key, ok := open.byDB[db]
+	if !ok {
+		metrics.UntrackBadger(db)
+		return db.Close()
+	}
+	if open.handoff {
+		open.byDir[key].inUse = false
+		return nil
+	}
+	return closeDB(key, db)
+}
+
+// closeDB must be called with open.mu held
+func closeDB(key string, db *badger.DB) error {
+	delete(open.byDir, key)
+	delete(open.byDB, db)
+	metrics.UntrackBadger(db)
+	return db.Close()
+}
+
+// StartHandoff makes Close keep databases open, so that rules and chains can be replaced by new ones without
+// reopening their state
+func StartHandoff() {
+	open.mu.Lock()
+	defer open.mu.Unlock()
+	open.handoff = true
+}
+
+// FinishHandoff closes databases that were closed during handoff and were not opened again
+func FinishHandoff() error {
+	open.mu.Lock()
+	defer open.mu.Unlock()
+	open.handoff = false
+	var errs []error
+	for key, o := range open.byDir {
+		if o.inUse {
+			continue
+		}
+		errs = append(errs, closeDB(key, o.db))
+	}
+	return errors.Join(errs...)
+}
@@ -22,3 +22,10 @@ func KeyToUserID(key []byte) (int64, error) {
 	}
 	return i, nil
 }
+
+// IsUserIDKey reports whether the key is exactly one user ID, so that databases can keep other data under keys
+// that are not
+func IsUserIDKey(key []byte) bool {
+	_, n := binary.Varint(key)
+	return n > 0 && n == len(key)
+}
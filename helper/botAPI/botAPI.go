@@ -0,0 +1,23 @@
+package botAPI
+
+import (
+	"github.com/mymmrac/telego"
+)
+
+// BotAPI is a subset of Telegram Bot API that is used by filters, actions and admin commands.
+// *telego.Bot implements it, fakeBot.Bot can be used instead of it to run everything without reaching Telegram.
+type BotAPI interface {
+	SendMessage(params *telego.SendMessageParams) (*telego.Message, error)
+	ForwardMessage(params *telego.ForwardMessageParams) (*telego.Message, error)
+	EditMessageText(params *telego.EditMessageTextParams) (*telego.Message, error)
+	AnswerCallbackQuery(params *telego.AnswerCallbackQueryParams) error
+	DeleteMessage(params *telego.DeleteMessageParams) error
+	DeleteMessages(params *telego.DeleteMessagesParams) error
+	BanChatMember(params *telego.BanChatMemberParams) error
+	UnbanChatMember(params *telego.UnbanChatMemberParams) error
+	RestrictChatMember(params *telego.RestrictChatMemberParams) error
+	GetChat(params *telego.GetChatParams) (*telego.ChatFullInfo, error)
+	GetChatAdministrators(params *telego.GetChatAdministratorsParams) ([]telego.ChatMember, error)
+}
+
+var _ BotAPI = (*telego.Bot)(nil)
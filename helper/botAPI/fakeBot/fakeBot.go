@@ -0,0 +1,210 @@
+package fakeBot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+)
+
+const (
+	MethodSendMessage           = "sendMessage"
+	MethodForwardMessage        = "forwardMessage"
+	MethodEditMessageText       = "editMessageText"
+	MethodAnswerCallbackQuery   = "answerCallbackQuery"
+	MethodDeleteMessage         = "deleteMessage"
+	MethodDeleteMessages        = "deleteMessages"
+	MethodBanChatMember         = "banChatMember"
+	MethodUnbanChatMember       = "unbanChatMember"
+	MethodRestrictChatMember    = "restrictChatMember"
+	MethodGetChat               = "getChat"
+	MethodGetChatAdministrators = "getChatAdministrators"
+)
+
+// Call is a single recorded call to the Bot API, Params holds a pointer to the original request parameters
+type Call struct {
+	Method string
+	Params any
+}
+
+// Bot is an in-memory implementation of botAPI.BotAPI that records all calls and never reaches Telegram.
+type Bot struct {
+	mu sync.Mutex
+
+	calls         []Call
+	nextMessageID int
+	errors        map[string]error
+
+	// Me is used as a sender of all messages that are sent or forwarded by the bot
+	Me telego.User
+	// Chats are returned by GetChat, unknown chats are returned with only ID set
+	Chats map[int64]*telego.ChatFullInfo
+	// ChatAdministrators are returned by GetChatAdministrators
+	ChatAdministrators map[int64][]telego.ChatMember
+}
+
+var _ botAPI.BotAPI = (*Bot)(nil)
+
+func New() *Bot {
+	return &Bot{
+		nextMessageID: 1,
+		errors:        make(map[string]error),
+		Me: telego.User{
+			ID:        1,
+			IsBot:     true,
+			FirstName: "fake",
+			Username:  "fake_bot",
+		},
+		Chats:              make(map[int64]*telego.ChatFullInfo),
+		ChatAdministrators: make(map[int64][]telego.ChatMember),
+	}
+}
+
+// SetError makes all subsequent calls of the method fail with err, nil err resets that.
+func (b *Bot) SetError(method string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.errors, method)
+		return
+	}
+	b.errors[method] = err
+}
+
+// Calls returns copy of all recorded calls in order they were made
+func (b *Bot) Calls() []Call {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := make([]Call, len(b.calls))
+	copy(res, b.calls)
+	return res
+}
+
+// CallsTo returns recorded calls of a single method
+func (b *Bot) CallsTo(method string) []Call {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	res := make([]Call, 0)
+	for _, c := range b.calls {
+		if c.Method == method {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// Reset forgets all recorded calls
+func (b *Bot) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = nil
+}
+
+func (b *Bot) record(method string, params any) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, Call{Method: method, Params: params})
+	return b.errors[method]
+}
+
+func (b *Bot) newMessage(chatID telego.ChatID) *telego.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.nextMessageID
+	b.nextMessageID++
+	me := b.Me
+	return &telego.Message{
+		MessageID: id,
+		From:      &me,
+		Date:      time.Now().Unix(),
+		Chat: telego.Chat{
+			ID:       chatID.ID,
+			Username: chatID.Username,
+		},
+	}
+}
+
+func (b *Bot) SendMessage(params *telego.SendMessageParams) (*telego.Message, error) {
+	err := b.record(MethodSendMessage, params)
+	if err != nil {
+		return nil, err
+	}
+	msg := b.newMessage(params.ChatID)
+	msg.Text = params.Text
+	msg.ReplyMarkup, _ = params.ReplyMarkup.(*telego.InlineKeyboardMarkup)
+	return msg, nil
+}
+
+func (b *Bot) ForwardMessage(params *telego.ForwardMessageParams) (*telego.Message, error) {
+	err := b.record(MethodForwardMessage, params)
+	if err != nil {
+		return nil, err
+	}
+	return b.newMessage(params.ChatID), nil
+}
+
+func (b *Bot) EditMessageText(params *telego.EditMessageTextParams) (*telego.Message, error) {
+	err := b.record(MethodEditMessageText, params)
+	if err != nil {
+		return nil, err
+	}
+	me := b.Me
+	return &telego.Message{
+		MessageID:   params.MessageID,
+		From:        &me,
+		Date:        time.Now().Unix(),
+		Chat:        telego.Chat{ID: params.ChatID.ID, Username: params.ChatID.Username},
+		Text:        params.Text,
+		Entities:    params.Entities,
+		ReplyMarkup: params.ReplyMarkup,
+	}, nil
+}
+
+func (b *Bot) AnswerCallbackQuery(params *telego.AnswerCallbackQueryParams) error {
+	return b.record(MethodAnswerCallbackQuery, params)
+}
+
+func (b *Bot) DeleteMessage(params *telego.DeleteMessageParams) error {
+	return b.record(MethodDeleteMessage, params)
+}
+
+func (b *Bot) DeleteMessages(params *telego.DeleteMessagesParams) error {
+	return b.record(MethodDeleteMessages, params)
+}
+
+func (b *Bot) BanChatMember(params *telego.BanChatMemberParams) error {
+	return b.record(MethodBanChatMember, params)
+}
+
+func (b *Bot) UnbanChatMember(params *telego.UnbanChatMemberParams) error {
+	return b.record(MethodUnbanChatMember, params)
+}
+
+func (b *Bot) RestrictChatMember(params *telego.RestrictChatMemberParams) error {
+	return b.record(MethodRestrictChatMember, params)
+}
+
+func (b *Bot) GetChat(params *telego.GetChatParams) (*telego.ChatFullInfo, error) {
+	err := b.record(MethodGetChat, params)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if chat, ok := b.Chats[params.ChatID.ID]; ok {
+		return chat, nil
+	}
+	return &telego.ChatFullInfo{ID: params.ChatID.ID, Username: params.ChatID.Username}, nil
+}
+
+func (b *Bot) GetChatAdministrators(params *telego.GetChatAdministratorsParams) ([]telego.ChatMember, error) {
+	err := b.record(MethodGetChatAdministrators, params)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.ChatAdministrators[params.ChatID.ID], nil
+}
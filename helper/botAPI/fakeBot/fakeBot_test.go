@@ -0,0 +1,117 @@
+package fakeBot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+func TestRecordsCalls(t *testing.T) {
+	bot := New()
+	chatID := tu.ID(-100)
+
+	err := tg.SendMessage(bot, chatID, nil, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tg.BanUser(bot, chatID, 1000, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tg.SendMessage(bot, chatID, nil, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := bot.Calls()
+	methods := make([]string, 0, len(calls))
+	for _, c := range calls {
+		methods = append(methods, c.Method)
+	}
+	want := []string{MethodSendMessage, MethodBanChatMember, MethodSendMessage}
+	if len(methods) != len(want) {
+		t.Fatalf("got calls %v, want %v", methods, want)
+	}
+	for i := range want {
+		if methods[i] != want[i] {
+			t.Fatalf("got calls %v, want %v", methods, want)
+		}
+	}
+
+	ban := bot.CallsTo(MethodBanChatMember)[0].Params.(*telego.BanChatMemberParams)
+	if ban.UserID != 1000 || ban.ChatID.ID != -100 || !ban.RevokeMessages {
+		t.Errorf("unexpected ban params: %+v", ban)
+	}
+
+	bot.Reset()
+	if len(bot.Calls()) != 0 {
+		t.Errorf("calls were not reset")
+	}
+}
+
+func TestSentMessagesGetUniqueIDs(t *testing.T) {
+	bot := New()
+	ids := make(map[int]struct{})
+	for i := 0; i < 3; i++ {
+		msg, err := bot.SendMessage(tu.Message(tu.ID(-100), "text"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.From.ID != bot.Me.ID || msg.Chat.ID != -100 || msg.Text != "text" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+		ids[msg.MessageID] = struct{}{}
+	}
+	if len(ids) != 3 {
+		t.Errorf("message ids are not unique: %v", ids)
+	}
+}
+
+func TestSetError(t *testing.T) {
+	bot := New()
+	errFailed := errors.New("failed")
+	bot.SetError(MethodDeleteMessage, errFailed)
+
+	err := bot.DeleteMessage(tu.Delete(tu.ID(-100), 1))
+	if !errors.Is(err, errFailed) {
+		t.Errorf("got error %v, want %v", err, errFailed)
+	}
+	if len(bot.CallsTo(MethodDeleteMessage)) != 1 {
+		t.Errorf("failed call was not recorded")
+	}
+	err = bot.BanChatMember(&telego.BanChatMemberParams{ChatID: tu.ID(-100), UserID: 1})
+	if err != nil {
+		t.Errorf("error of another method was returned: %v", err)
+	}
+
+	bot.SetError(MethodDeleteMessage, nil)
+	err = bot.DeleteMessage(tu.Delete(tu.ID(-100), 1))
+	if err != nil {
+		t.Errorf("error was not reset: %v", err)
+	}
+}
+
+func TestGetChat(t *testing.T) {
+	bot := New()
+	bot.Chats[-100] = &telego.ChatFullInfo{ID: -100, Title: "known"}
+
+	chat, err := bot.GetChat(&telego.GetChatParams{ChatID: tu.ID(-100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chat.Title != "known" {
+		t.Errorf("configured chat was not returned: %+v", chat)
+	}
+
+	chat, err = bot.GetChat(&telego.GetChatParams{ChatID: tu.ID(-200)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chat.ID != -200 || chat.Title != "" {
+		t.Errorf("unexpected unknown chat: %+v", chat)
+	}
+}
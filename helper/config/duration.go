@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ansel1/merry/v2"
+)
+
+var ErrNotADuration = errors.New("value is not a duration")
+
+const day = 24 * time.Hour
+
+// ParseDuration works as time.ParseDuration, but also accepts days and weeks, e.g. `7d` or `2w`
+func ParseDuration(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": day, "w": 7 * day} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, merry.Wrap(ErrNotADuration, merry.WithMessagef("invalid duration %q", s))
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, merry.Wrap(ErrNotADuration, merry.WithMessagef("invalid duration %q", s))
+	}
+	return d, nil
+}
+
+// FormatDuration formats duration rounded to minutes, omitting zero units, e.g. `6d23h` or `1h30m`
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d <= 0 {
+		return "0m"
+	}
+	res := ""
+	for _, u := range []struct {
+		name string
+		unit time.Duration
+	}{{"d", day}, {"h", time.Hour}, {"m", time.Minute}} {
+		if n := d / u.unit; n > 0 {
+			res += fmt.Sprintf("%d%s", n, u.name)
+			d -= n * u.unit
+		}
+	}
+	return res
+}
+
+func GetOptionDurationWithDefault(config map[string]any, name string, def time.Duration) (time.Duration, error) {
+	valI, ok := config[name]
+	if !ok {
+		return def, nil
+	}
+	val, ok := valI.(string)
+	if !ok {
+		return def, merry.Wrap(ErrNotADuration, merry.WithMessagef("%s is not a duration", name))
+	}
+	return ParseDuration(val)
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+)
+
+// BanObserver is called after user is banned by a chain or by an admin, record contains details of the ban
+type BanObserver func(userID int64, record *banRecord.BanRecord)
+
+// BanHistory lists bans that were issued before observer was registered
+type BanHistory interface {
+	// ForEachBan calls fn for every ban that was issued locally
+	ForEachBan(fn BanObserver) error
+}
+
+// Hub delivers events of one component to others that learn from them, e.g. bans and messages with known labels to
+// filtering rules. Nil hub drops all events, so components can be used without it.
+type Hub struct {
+	mu           sync.RWMutex
+	next         int
+	banObservers map[int]BanObserver
+	trainers     map[int]Trainer
+	history      BanHistory
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		banObservers: make(map[int]BanObserver),
+		trainers:     make(map[int]Trainer),
+	}
+}
+
+// ObserveBans registers observer of new bans, returned function unregisters it
+func (h *Hub) ObserveBans(o BanObserver) func() {
+	if h == nil {
+		return func() {}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := h.next
+	h.next++
+	h.banObservers[id] = o
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.banObservers, id)
+	}
+}
+
+// PublishBan passes the ban to all observers
+func (h *Hub) PublishBan(userID int64, record *banRecord.BanRecord) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, o := range h.banObservers {
+		o(userID, record)
+	}
+}
+
+// SetBanHistory sets source of bans for ForEachBan, nil unsets it
+func (h *Hub) SetBanHistory(history BanHistory) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.history = history
+}
+
+// ForEachBan calls fn for every ban in the history. It does nothing if there is no history.
+func (h *Hub) ForEachBan(fn BanObserver) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	history := h.history
+	h.mu.RUnlock()
+	if history == nil {
+		return nil
+	}
+	return history.ForEachBan(fn)
+}
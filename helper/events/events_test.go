@@ -0,0 +1,85 @@
+package events
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+)
+
+type history []int64
+
+func (h history) ForEachBan(fn BanObserver) error {
+	for _, id := range h {
+		fn(id, &banRecord.BanRecord{})
+	}
+	return nil
+}
+
+func TestBans(t *testing.T) {
+	hub := NewHub()
+	var observed []int64
+	stop := hub.ObserveBans(func(userID int64, _ *banRecord.BanRecord) {
+		observed = append(observed, userID)
+	})
+
+	err := hub.ForEachBan(func(int64, *banRecord.BanRecord) {
+		t.Error("bans are listed without history")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hub.SetBanHistory(history{1, 2})
+	err = hub.ForEachBan(func(userID int64, _ *banRecord.BanRecord) {
+		observed = append(observed, userID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hub.PublishBan(3, &banRecord.BanRecord{})
+	stop()
+	hub.PublishBan(4, &banRecord.BanRecord{})
+	if want := []int64{1, 2, 3}; !slices.Equal(observed, want) {
+		t.Errorf("got bans %v, want %v", observed, want)
+	}
+}
+
+func TestNilHub(t *testing.T) {
+	var hub *Hub
+	stop := hub.ObserveBans(func(int64, *banRecord.BanRecord) {
+		t.Error("nil hub delivered a ban")
+	})
+	hub.PublishBan(1, &banRecord.BanRecord{})
+	stop()
+	hub.SetBanHistory(history{1})
+	err := hub.ForEachBan(func(int64, *banRecord.BanRecord) {
+		t.Error("nil hub has history")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTraining(t *testing.T) {
+	hub := NewHub()
+	var observed []string
+	stop := hub.ObserveTraining(func(label Label, text string) {
+		observed = append(observed, string(label)+":"+text)
+	})
+
+	hub.PublishTraining(Spam, "buy now")
+	hub.PublishTraining(Ham, "")
+	hub.PublishTraining(Ham, "hello")
+	stop()
+	hub.PublishTraining(Spam, "too late")
+	if want := []string{"spam:buy now", "ham:hello"}; !slices.Equal(observed, want) {
+		t.Errorf("got samples %v, want %v", observed, want)
+	}
+
+	var nilHub *Hub
+	nilHub.ObserveTraining(func(Label, string) {
+		t.Error("nil hub delivered a sample")
+	})()
+	nilHub.PublishTraining(Spam, "buy now")
+}
@@ -0,0 +1,56 @@
+package events
+
+import (
+	"strings"
+)
+
+// Label tells if message is a spam or not
+type Label string
+
+const (
+	Spam Label = "spam"
+	Ham  Label = "ham"
+)
+
+func ParseLabel(s string) (Label, bool) {
+	switch Label(strings.ToLower(s)) {
+	case Spam:
+		return Spam, true
+	case Ham:
+		return Ham, true
+	default:
+		return "", false
+	}
+}
+
+// Trainer learns from text of a message which label is known
+type Trainer func(label Label, text string)
+
+// ObserveTraining registers trainer, returned function unregisters it
+func (h *Hub) ObserveTraining(t Trainer) func() {
+	if h == nil {
+		return func() {}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id := h.next
+	h.next++
+	h.trainers[id] = t
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.trainers, id)
+	}
+}
+
+// PublishTraining passes text to all trainers, empty texts are ignored
+func (h *Hub) PublishTraining(label Label, text string) {
+	if h == nil || text == "" {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, t := range h.trainers {
+		t(label, text)
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"github.com/mymmrac/telego"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+)
+
+// Bot counts failed requests of the underlying bot by method
+type Bot struct {
+	bot botAPI.BotAPI
+}
+
+var _ botAPI.BotAPI = (*Bot)(nil)
+
+func InstrumentBot(bot botAPI.BotAPI) *Bot {
+	return &Bot{bot: bot}
+}
+
+func countError(method string, err error) {
+	if err != nil {
+		TelegramErrors.WithLabelValues(method).Inc()
+	}
+}
+
+func (b *Bot) SendMessage(params *telego.SendMessageParams) (*telego.Message, error) {
+	msg, err := b.bot.SendMessage(params)
+	countError("sendMessage", err)
+	return msg, err
+}
+
+func (b *Bot) ForwardMessage(params *telego.ForwardMessageParams) (*telego.Message, error) {
+	msg, err := b.bot.ForwardMessage(params)
+	countError("forwardMessage", err)
+	return msg, err
+}
+
+func (b *Bot) EditMessageText(params *telego.EditMessageTextParams) (*telego.Message, error) {
+	msg, err := b.bot.EditMessageText(params)
+	countError("editMessageText", err)
+	return msg, err
+}
+
+func (b *Bot) AnswerCallbackQuery(params *telego.AnswerCallbackQueryParams) error {
+	err := b.bot.AnswerCallbackQuery(params)
+	countError("answerCallbackQuery", err)
+	return err
+}
+
+func (b *Bot) DeleteMessage(params *telego.DeleteMessageParams) error {
+	err := b.bot.DeleteMessage(params)
+	countError("deleteMessage", err)
+	return err
+}
+
+func (b *Bot) DeleteMessages(params *telego.DeleteMessagesParams) error {
+	err := b.bot.DeleteMessages(params)
+	countError("deleteMessages", err)
+	return err
+}
+
+func (b *Bot) BanChatMember(params *telego.BanChatMemberParams) error {
+	err := b.bot.BanChatMember(params)
+	countError("banChatMember", err)
+	return err
+}
+
+func (b *Bot) UnbanChatMember(params *telego.UnbanChatMemberParams) error {
+	err := b.bot.UnbanChatMember(params)
+	countError("unbanChatMember", err)
+	return err
+}
+
+func (b *Bot) RestrictChatMember(params *telego.RestrictChatMemberParams) error {
+	err := b.bot.RestrictChatMember(params)
+	countError("restrictChatMember", err)
+	return err
+}
+
+func (b *Bot) GetChat(params *telego.GetChatParams) (*telego.ChatFullInfo, error) {
+	chat, err := b.bot.GetChat(params)
+	countError("getChat", err)
+	return chat, err
+}
+
+func (b *Bot) GetChatAdministrators(params *telego.GetChatAdministratorsParams) ([]telego.ChatMember, error) {
+	admins, err := b.bot.GetChatAdministrators(params)
+	countError("getChatAdministrators", err)
+	return admins, err
+}
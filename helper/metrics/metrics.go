@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "antispam"
+
+// Registry contains all metrics of the bot, it is served on `/metrics`
+var Registry = prometheus.NewRegistry()
+
+var (
+	MessagesProcessed = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_processed_total",
+		Help:      "Messages from allowed chats that were passed to chains",
+	}, []string{"chat_id"})
+
+	RuleHits = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rule_hits_total",
+		Help:      "Messages that got positive score from the rule",
+	}, []string{"chain", "rule"})
+
+	Actions = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "actions_total",
+		Help:      "Actions applied by chains, status is either `applied` or `failed`",
+	}, []string{"chain", "action", "status"})
+
+	Bans = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bans_total",
+		Help:      "Users banned by chains and admins",
+	})
+
+	Unbans = promauto.With(Registry).NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "unbans_total",
+		Help:      "Users unbanned by admins or because their ban expired",
+	})
+
+	TelegramErrors = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "telegram_api_errors_total",
+		Help:      "Failed requests to Telegram Bot API",
+	}, []string{"method"})
+
+	ScoringDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scoring_duration_seconds",
+		Help:      "Time that chain spent on scoring a message, including actions",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"chain"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		badgerDBs,
+	)
+}
+
+// ChatID formats chat id as a label value
+func ChatID(chatID int64) string {
+	return strconv.FormatInt(chatID, 10)
+}
+
+var badgerSizeDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "badger", "size_bytes"),
+	"Size of badger database, type is either `lsm` or `vlog`",
+	[]string{"db", "dir", "type"}, nil,
+)
+
+// badgerCollector reports sizes of databases that are currently open
+type badgerCollector struct {
+	mu  sync.Mutex
+	dbs map[*badger.DB]string
+}
+
+var badgerDBs = &badgerCollector{dbs: make(map[*badger.DB]string)}
+
+// TrackBadger adds size of the database to metrics, it must be untracked before database is closed
+func TrackBadger(name string, db *badger.DB) {
+	badgerDBs.mu.Lock()
+	defer badgerDBs.mu.Unlock()
+	badgerDBs.dbs[db] = name
+}
+
+func UntrackBadger(db *badger.DB) {
+	badgerDBs.mu.Lock()
+	defer badgerDBs.mu.Unlock()
+	delete(badgerDBs.dbs, db)
+}
+
+func (c *badgerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- badgerSizeDesc
+}
+
+func (c *badgerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for db, name := range c.dbs {
+		lsm, vlog := db.Size()
+		dir := db.Opts().Dir
+		ch <- prometheus.MustNewConstMetric(badgerSizeDesc, prometheus.GaugeValue, float64(lsm), name, dir, "lsm")
+		ch <- prometheus.MustNewConstMetric(badgerSizeDesc, prometheus.GaugeValue, float64(vlog), name, dir, "vlog")
+	}
+}
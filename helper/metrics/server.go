@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// Server serves metrics from Registry
+type Server struct {
+	logger        *zap.Logger
+	listenAddress string
+	path          string
+
+	server *http.Server
+}
+
+func NewServer(logger *zap.Logger, listenAddress, path string) *Server {
+	return &Server{
+		logger:        logger.With(zap.String("component", "metrics")),
+		listenAddress: listenAddress,
+		path:          path,
+	}
+}
+
+// Handler serves metrics from Registry on the configured path
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(s.path, promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.listenAddress)
+	if err != nil {
+		return err
+	}
+	s.server = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.logger.Info("serving metrics", zap.String("listen_address", listener.Addr().String()), zap.String("path", s.path))
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("metrics server failed", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Stop() {
+	if s.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		s.logger.Warn("failed to stop metrics server", zap.Error(err))
+	}
+}
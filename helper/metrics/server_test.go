@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+)
+
+// scrape returns metrics served by the server in text format
+func scrape(t *testing.T, srv *httptest.Server, path string) string {
+	t.Helper()
+	resp, err := srv.Client().Get(srv.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status %v", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestCountersAreExported(t *testing.T) {
+	s := NewServer(zap.NewNop(), "127.0.0.1:0", "/metrics")
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+
+	MessagesProcessed.WithLabelValues(ChatID(-1001234567890)).Inc()
+	Bans.Inc()
+	Unbans.Inc()
+	bot := fakeBot.New()
+	bot.SetError(fakeBot.MethodBanChatMember, errors.New("failed"))
+	instrumented := InstrumentBot(bot)
+	_ = instrumented.BanChatMember(&telego.BanChatMemberParams{ChatID: telego.ChatID{ID: -100}, UserID: 1})
+	_ = instrumented.UnbanChatMember(&telego.UnbanChatMemberParams{ChatID: telego.ChatID{ID: -100}, UserID: 1})
+
+	body := scrape(t, srv, "/metrics")
+	for _, want := range []string{
+		`antispam_messages_processed_total{chat_id="-1001234567890"} 1`,
+		`antispam_bans_total 1`,
+		`antispam_unbans_total 1`,
+		`antispam_telegram_api_errors_total{method="banChatMember"} 1`,
+	} {
+		if !strings.Contains(body, want+"\n") {
+			t.Errorf("metric %q is not exported", want)
+		}
+	}
+	// Only failed requests are counted
+	if strings.Contains(body, `antispam_telegram_api_errors_total{method="unbanChatMember"}`) {
+		t.Errorf("successful request was counted as error")
+	}
+
+	resp, err := srv.Client().Get(srv.URL + "/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("metrics are served on unexpected path, got status %v", resp.StatusCode)
+	}
+}
@@ -0,0 +1,257 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrClosed           = errors.New("pipeline is closed")
+	ErrWorkersInvalid   = errors.New("number of workers must be positive")
+	ErrQueueSizeInvalid = errors.New("queue size must be positive")
+)
+
+type KeyType uint8
+
+const (
+	KeyChat KeyType = iota
+	KeyUser
+)
+
+// Key identifies an ordering domain. Tasks that share at least one key are executed in submission order.
+type Key struct {
+	Type KeyType
+	ID   int64
+}
+
+func Chat(id int64) Key {
+	return Key{Type: KeyChat, ID: id}
+}
+
+func User(id int64) Key {
+	return Key{Type: KeyUser, ID: id}
+}
+
+type task struct {
+	keys []Key
+	fn   func()
+}
+
+// Pipeline runs submitted tasks on a fixed pool of workers.
+//
+// Tasks without common keys are executed in parallel, tasks that share a key are executed one by one in the order
+// they were submitted. Submit blocks when the queue (or queue of any of the task's keys) is full, which propagates
+// backpressure to the producer.
+type Pipeline struct {
+	logger *zap.Logger
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	pending  []*task
+	perKey   map[Key]int
+	inFlight map[Key]struct{}
+	running  int
+
+	queueSize    int
+	keyQueueSize int
+	closed       bool
+
+	wg sync.WaitGroup
+}
+
+// New creates pipeline and starts workers. keyQueueSize limits amount of pending tasks for a single key,
+// 0 means that only the global queueSize is enforced.
+func New(logger *zap.Logger, workers, queueSize, keyQueueSize int) (*Pipeline, error) {
+	if workers <= 0 {
+		return nil, ErrWorkersInvalid
+	}
+	if queueSize <= 0 || keyQueueSize < 0 {
+		return nil, ErrQueueSizeInvalid
+	}
+
+	p := &Pipeline{
+		logger:       logger.With(zap.String("component", "pipeline")),
+		pending:      make([]*task, 0, queueSize),
+		perKey:       make(map[Key]int),
+		inFlight:     make(map[Key]struct{}),
+		queueSize:    queueSize,
+		keyQueueSize: keyQueueSize,
+	}
+	p.cond = sync.NewCond(&p.mu)
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p, nil
+}
+
+func (p *Pipeline) isFull(keys []Key) bool {
+	if len(p.pending) >= p.queueSize {
+		return true
+	}
+	if p.keyQueueSize == 0 {
+		return false
+	}
+	for _, k := range keys {
+		if p.perKey[k] >= p.keyQueueSize {
+			return true
+		}
+	}
+	return false
+}
+
+// Submit adds task to the queue, blocking while there is no room for it.
+func (p *Pipeline) Submit(fn func(), keys ...Key) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	waited := false
+	for !p.closed && p.isFull(keys) {
+		if !waited {
+			p.logger.Warn("queue is full, waiting for workers",
+				zap.Int("pending", len(p.pending)),
+				zap.Any("keys", keys),
+			)
+			waited = true
+		}
+		p.cond.Wait()
+	}
+	if p.closed {
+		return ErrClosed
+	}
+
+	p.pending = append(p.pending, &task{keys: keys, fn: fn})
+	for _, k := range keys {
+		p.perKey[k]++
+	}
+	p.cond.Broadcast()
+	return nil
+}
+
+// next returns first task that doesn't share keys with tasks in flight or with tasks queued before it.
+// Must be called with mutex held.
+func (p *Pipeline) next() *task {
+	var blocked map[Key]struct{}
+	for i, t := range p.pending {
+		runnable := true
+		for _, k := range t.keys {
+			if _, ok := p.inFlight[k]; ok {
+				runnable = false
+				break
+			}
+			if _, ok := blocked[k]; ok {
+				runnable = false
+				break
+			}
+		}
+		if runnable {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			for _, k := range t.keys {
+				p.inFlight[k] = struct{}{}
+				p.perKey[k]--
+				if p.perKey[k] == 0 {
+					delete(p.perKey, k)
+				}
+			}
+			return t
+		}
+
+		if blocked == nil {
+			blocked = make(map[Key]struct{})
+		}
+		for _, k := range t.keys {
+			blocked[k] = struct{}{}
+		}
+	}
+	return nil
+}
+
+func (p *Pipeline) worker() {
+	defer p.wg.Done()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		t := p.next()
+		if t == nil {
+			if p.closed && len(p.pending) == 0 {
+				return
+			}
+			p.cond.Wait()
+			continue
+		}
+
+		p.running++
+		p.mu.Unlock()
+		p.run(t)
+		p.mu.Lock()
+		p.running--
+
+		for _, k := range t.keys {
+			delete(p.inFlight, k)
+		}
+		p.cond.Broadcast()
+	}
+}
+
+func (p *Pipeline) run(t *task) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			p.logger.Error("panic while processing task", zap.Any("panic", rec), zap.Any("keys", t.keys))
+		}
+	}()
+	t.fn()
+}
+
+// Len returns amount of tasks that are waiting for a worker
+func (p *Pipeline) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// Stop stops accepting new tasks and waits until all queued tasks are processed. If context is done first, tasks
+// that are still queued are dropped and Stop waits only for the running ones, so that nothing uses resources that
+// caller is going to release after Stop returns.
+func (p *Pipeline) Stop(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	pending := len(p.pending)
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	p.logger.Info("draining pipeline", zap.Int("pending", pending))
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.logger.Info("pipeline drained")
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	dropped, running := len(p.pending), p.running
+	p.pending = nil
+	clear(p.perKey)
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.logger.Error("pipeline drain timed out, dropping queued tasks and waiting for running ones",
+		zap.Int("dropped", dropped),
+		zap.Int("running", running),
+	)
+
+	<-done
+	p.logger.Info("pipeline stopped")
+	return ctx.Err()
+}
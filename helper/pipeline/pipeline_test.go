@@ -0,0 +1,81 @@
+package pipeline
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestStopDrainsQueue(t *testing.T) {
+	p, err := New(zap.NewNop(), 2, 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var done atomic.Int32
+	for i := 0; i < 5; i++ {
+		err = p.Submit(func() { done.Add(1) }, Chat(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = p.Stop(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Load() != 5 {
+		t.Errorf("got %v processed tasks, want 5", done.Load())
+	}
+	if err := p.Submit(func() {}, Chat(1)); err != ErrClosed {
+		t.Errorf("got %v on submit after stop, want %v", err, ErrClosed)
+	}
+}
+
+func TestStopTimeoutWaitsForRunningTasks(t *testing.T) {
+	p, err := New(zap.NewNop(), 1, 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished, dropped atomic.Bool
+	err = p.Submit(func() {
+		close(started)
+		<-release
+		finished.Store(true)
+	}, Chat(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Submit(func() { dropped.Store(true) }, Chat(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+
+	err = p.Stop(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if !finished.Load() {
+		t.Errorf("Stop returned before running task finished")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if dropped.Load() {
+		t.Errorf("queued task was executed after timeout")
+	}
+	if p.Len() != 0 {
+		t.Errorf("got %v queued tasks, want 0", p.Len())
+	}
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/mymmrac/telego"
 	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 )
 
 type Stateful interface {
@@ -12,7 +14,7 @@ type Stateful interface {
 	LoadState() error
 	Close() error
 	TGAdminPrefix() string
-	HandleTGCommands(*zap.Logger, *telego.Bot, *telego.Message, []string) error
+	HandleTGCommands(*zap.Logger, botAPI.BotAPI, *telego.Message, []string) error
 }
 
 var (
@@ -0,0 +1,90 @@
+package textnorm
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables maps letters of other scripts that look the same as Latin ones to their Latin skeleton. It is a subset
+// of Unicode confusables that spammers actually use, mostly Cyrillic and Greek.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'һ': 'h', 'і': 'i', 'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm',
+	'н': 'h', 'о': 'o', 'р': 'p', 'ԛ': 'q', 'ѕ': 's', 'т': 't', 'у': 'y', 'ү': 'y', 'ԝ': 'w', 'х': 'x', 'ь': 'b',
+	'А': 'A', 'В': 'B', 'С': 'C', 'Е': 'E', 'Н': 'H', 'І': 'I', 'Ј': 'J', 'К': 'K', 'М': 'M', 'О': 'O', 'Р': 'P',
+	'Ѕ': 'S', 'Т': 'T', 'У': 'Y', 'Ү': 'Y', 'Х': 'X', 'Ԝ': 'W',
+	// Greek
+	'α': 'a', 'ϲ': 'c', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'υ': 'u', 'χ': 'x',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O', 'Ρ': 'P',
+	'Τ': 'T', 'Υ': 'Y', 'Χ': 'X', 'Ϲ': 'C',
+	// Armenian
+	'օ': 'o', 'ս': 'u', 'ց': 'g', 'հ': 'h', 'ո': 'n',
+	// Latin letters that look like basic ones
+	'ı': 'i', 'ɡ': 'g', 'ɑ': 'a', 'ʏ': 'y',
+}
+
+// invisible reports characters that don't render but split words: zero-width spaces and joiners, bidi controls, soft
+// hyphens (all of them are format characters) and variation selectors
+func invisible(r rune) bool {
+	return unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Variation_Selector, r) || r == '͏'
+}
+
+// Normalize returns a form of the text that spammers can't easily obfuscate: invisible characters are removed,
+// compatibility characters (e.g. fullwidth or mathematical letters) are replaced by NFKC, homoglyphs are folded to
+// Latin letters and whitespace is collapsed to single spaces.
+//
+// Homoglyphs of other scripts are folded only in words that mix them with Latin letters, so legitimate non-Latin words
+// (e.g. Cyrillic "нот") are kept as is and don't match Latin patterns.
+func Normalize(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if invisible(r) {
+			return -1
+		}
+		return r
+	}, text)
+	text = norm.NFKC.String(text)
+
+	var buf strings.Builder
+	buf.Grow(len(text))
+	word := make([]rune, 0, 32)
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		writeFolded(&buf, word)
+		word = word[:0]
+		buf.WriteRune(r)
+	}
+	writeFolded(&buf, word)
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// writeFolded writes the word with its homoglyphs folded. Homoglyphs of other scripts are folded only if the word
+// contains Latin letters as well.
+func writeFolded(buf *strings.Builder, word []rune) {
+	mixed := false
+	for _, r := range word {
+		if _, ok := confusables[r]; !ok && unicode.Is(unicode.Latin, r) {
+			mixed = true
+			break
+		}
+	}
+	for _, r := range word {
+		if l, ok := confusables[r]; ok && (mixed || unicode.Is(unicode.Latin, r)) {
+			r = l
+		}
+		buf.WriteRune(r)
+	}
+}
+
+// Variants returns text and its normalized form if it differs
+func Variants(text string) []string {
+	normalized := Normalize(text)
+	if normalized == text {
+		return []string{text}
+	}
+	return []string{text, normalized}
+}
@@ -0,0 +1,42 @@
+package textnorm
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "plain text", text: "free crypto", want: "free crypto"},
+		{name: "mixed script word", text: "frее сrурtо", want: "free crypto"},
+		{name: "cyrillic words are kept", text: "нот сос", want: "нот сос"},
+		{name: "mixed word next to cyrillic one", text: "нот crурtо", want: "нот crypto"},
+		{name: "greek homoglyphs", text: "Βitcοin", want: "Bitcoin"},
+		{name: "latin homoglyphs", text: "bıtcoın", want: "bitcoin"},
+		{name: "fullwidth letters", text: "ｆｒｅｅ", want: "free"},
+		{name: "mathematical letters", text: "𝐟𝐫𝐞𝐞 money", want: "free money"},
+		{name: "invisible characters", text: "fr​ee­ mo‍ney", want: "free money"},
+		{name: "whitespace", text: "  free\n\tmoney ", want: "free money"},
+		{name: "punctuation splits words", text: "нот,crурtо!", want: "нот,crypto!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Normalize(tt.text); got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariants(t *testing.T) {
+	if got := Variants("free money"); !slices.Equal(got, []string{"free money"}) {
+		t.Errorf("normalized text has variants: %q", got)
+	}
+	if got := Variants("frее"); !slices.Equal(got, []string{"frее", "free"}) {
+		t.Errorf("got variants %q", got)
+	}
+}
@@ -0,0 +1,78 @@
+package tg
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+)
+
+// ChatErrors contains errors of an operation that was applied to several chats, by chat ID
+type ChatErrors map[int64]error
+
+func (e ChatErrors) Error() string {
+	chatIDs := make([]int64, 0, len(e))
+	for chatID := range e {
+		chatIDs = append(chatIDs, chatID)
+	}
+	slices.Sort(chatIDs)
+	res := make([]string, 0, len(chatIDs))
+	for _, chatID := range chatIDs {
+		res = append(res, fmt.Sprintf("chat %v: %v", chatID, e[chatID]))
+	}
+	return strings.Join(res, "; ")
+}
+
+func forEachChat(chatIDs []int64, f func(chatID int64) error) error {
+	errs := make(ChatErrors)
+	for _, chatID := range chatIDs {
+		err := f(chatID)
+		if err != nil {
+			errs[chatID] = err
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Succeeded returns chats where the operation that was applied to chatIDs didn't fail, err is an error returned by it
+func Succeeded(chatIDs []int64, err error) []int64 {
+	if err == nil {
+		return chatIDs
+	}
+	var errs ChatErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	res := make([]int64, 0, len(chatIDs))
+	for _, chatID := range chatIDs {
+		if _, ok := errs[chatID]; !ok {
+			res = append(res, chatID)
+		}
+	}
+	return res
+}
+
+// BanUserInChats bans user in every chat, returns ChatErrors if it failed in some of them
+func BanUserInChats(bot botAPI.BotAPI, chatIDs []int64, userID int64, deleteAll bool) error {
+	return forEachChat(chatIDs, func(chatID int64) error {
+		return BanUser(bot, telego.ChatID{ID: chatID}, userID, deleteAll)
+	})
+}
+
+// UnbanUserInChats lifts ban of the user in every chat, returns ChatErrors if it failed in some of them
+func UnbanUserInChats(bot botAPI.BotAPI, chatIDs []int64, userID int64) error {
+	return forEachChat(chatIDs, func(chatID int64) error {
+		return bot.UnbanChatMember(&telego.UnbanChatMemberParams{
+			ChatID:       telego.ChatID{ID: chatID},
+			UserID:       userID,
+			OnlyIfBanned: true,
+		})
+	})
+}
@@ -0,0 +1,33 @@
+package tg
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestSucceeded(t *testing.T) {
+	chatIDs := []int64{-100, -200, -300}
+	tests := []struct {
+		name string
+		err  error
+		want []int64
+	}{
+		{name: "no errors", err: nil, want: chatIDs},
+		{name: "some chats failed", err: ChatErrors{-200: errors.New("failed")}, want: []int64{-100, -300}},
+		{
+			name: "all chats failed",
+			err:  ChatErrors{-100: errors.New("failed"), -200: errors.New("failed"), -300: errors.New("failed")},
+			want: []int64{},
+		},
+		{name: "unknown error", err: errors.New("failed"), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Succeeded(chatIDs, tt.err)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Succeeded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,9 +3,11 @@ package tg
 import (
 	"github.com/mymmrac/telego"
 	tu "github.com/mymmrac/telego/telegoutil"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 )
 
-func SendMessage(bot *telego.Bot, chatID telego.ChatID, messageID *int, text string) error {
+func SendMessage(bot botAPI.BotAPI, chatID telego.ChatID, messageID *int, text string) error {
 	sendMessageParams := &telego.SendMessageParams{
 		ChatID: chatID,
 		Text:   text,
@@ -21,7 +23,7 @@ func SendMessage(bot *telego.Bot, chatID telego.ChatID, messageID *int, text str
 	return err
 }
 
-func SendMarkdownMessage(bot *telego.Bot, chatID telego.ChatID, messageID *int, text string) error {
+func SendMarkdownMessage(bot botAPI.BotAPI, chatID telego.ChatID, messageID *int, text string) error {
 	sendMessageParams := &telego.SendMessageParams{
 		ChatID:    chatID,
 		Text:      text,
@@ -38,7 +40,7 @@ func SendMarkdownMessage(bot *telego.Bot, chatID telego.ChatID, messageID *int,
 	return err
 }
 
-func BanUser(bot *telego.Bot, chatID telego.ChatID, userID int64, deleteAll bool) error {
+func BanUser(bot botAPI.BotAPI, chatID telego.ChatID, userID int64, deleteAll bool) error {
 	req := &telego.BanChatMemberParams{
 		UserID:         userID,
 		RevokeMessages: deleteAll,
@@ -51,6 +53,32 @@ func BanUser(bot *telego.Bot, chatID telego.ChatID, userID int64, deleteAll bool
 	return nil
 }
 
-func DeleteMessage(bot *telego.Bot, msg *telego.Message) error {
+func DeleteMessage(bot botAPI.BotAPI, msg *telego.Message) error {
 	return bot.DeleteMessage(tu.Delete(msg.Chat.ChatID(), msg.MessageID))
 }
+
+const excerptLength = 200
+
+// MessageText returns text and caption of the message
+func MessageText(msg *telego.Message) string {
+	if msg.Caption == "" {
+		return msg.Text
+	}
+	if msg.Text == "" {
+		return msg.Caption
+	}
+	return msg.Text + "\n" + msg.Caption
+}
+
+// MessageExcerpt returns beginning of message text or caption, to keep it for reference
+func MessageExcerpt(msg *telego.Message) string {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+	runes := []rune(text)
+	if len(runes) <= excerptLength {
+		return text
+	}
+	return string(runes[:excerptLength]) + "…"
+}
@@ -8,13 +8,18 @@ import (
 	"github.com/mymmrac/telego"
 	"go.uber.org/zap"
 
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
 	"github.com/Civil/tg-simple-regex-antispam/helper/stateful"
 )
 
-type AdminCMDHandlerFunc func(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error
+type AdminCMDHandlerFunc func(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error
 
 type AdminCMDHelpFunc func() string
 
+// CallbackHandlerFunc handles callback queries from inline buttons. Handlers are selected by the prefix of the
+// callback data (part before the first ':').
+type CallbackHandlerFunc func(logger *zap.Logger, bot botAPI.BotAPI, query *telego.CallbackQuery) error
+
 type TGHaveAdminCommands struct {
 	Handlers map[string]AdminCMDHandlerFunc
 }
@@ -23,7 +28,7 @@ var (
 	ErrCommandArgsInvalid = errors.New("not enough arguments for command")
 )
 
-func (r *TGHaveAdminCommands) HandleTGCommands(logger *zap.Logger, bot *telego.Bot, message *telego.Message, tokens []string) error {
+func (r *TGHaveAdminCommands) HandleTGCommands(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) error {
 	supportedCommands := make([]string, 0, len(r.Handlers))
 	for cmd := range r.Handlers {
 		supportedCommands = append(supportedCommands, cmd)
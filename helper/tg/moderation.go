@@ -0,0 +1,100 @@
+package tg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+)
+
+// ModerationCallbackPrefix is a prefix of callback data of moderation buttons
+const ModerationCallbackPrefix = "mod"
+
+type ModerationAction string
+
+const (
+	ModerationBan    ModerationAction = "ban"
+	ModerationUnban  ModerationAction = "unban"
+	ModerationDelete ModerationAction = "delete"
+	ModerationVerify ModerationAction = "verify"
+)
+
+var ErrInvalidCallbackData = errors.New("invalid callback data")
+
+// ModerationCallback identifies an action that admin wants to apply to the original message and its sender
+type ModerationCallback struct {
+	Action    ModerationAction
+	ChatID    int64
+	UserID    int64
+	MessageID int
+}
+
+// Data encodes callback to fit into 64 bytes limit of callback data
+func (c *ModerationCallback) Data() string {
+	return fmt.Sprintf("%v:%v:%v:%v:%v", ModerationCallbackPrefix, c.Action, c.ChatID, c.UserID, c.MessageID)
+}
+
+// ActionDescription returns human-readable description of what was done
+func (c *ModerationCallback) ActionDescription() string {
+	switch c.Action {
+	case ModerationBan:
+		return "banned the user"
+	case ModerationUnban:
+		return "unbanned the user (not spam)"
+	case ModerationDelete:
+		return "deleted the original message"
+	case ModerationVerify:
+		return "marked the user as verified"
+	default:
+		return string(c.Action)
+	}
+}
+
+func ParseModerationCallback(data string) (*ModerationCallback, error) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 5 || parts[0] != ModerationCallbackPrefix {
+		return nil, ErrInvalidCallbackData
+	}
+	res := &ModerationCallback{Action: ModerationAction(parts[1])}
+	switch res.Action {
+	case ModerationBan, ModerationUnban, ModerationDelete, ModerationVerify:
+	default:
+		return nil, ErrInvalidCallbackData
+	}
+
+	var err error
+	res.ChatID, err = strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCallbackData
+	}
+	res.UserID, err = strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCallbackData
+	}
+	res.MessageID, err = strconv.Atoi(parts[4])
+	if err != nil {
+		return nil, ErrInvalidCallbackData
+	}
+	return res, nil
+}
+
+// ModerationKeyboard returns buttons that allow admins to act on the message without typing commands
+func ModerationKeyboard(chatID, userID int64, messageID int) *telego.InlineKeyboardMarkup {
+	button := func(text string, action ModerationAction) telego.InlineKeyboardButton {
+		cb := ModerationCallback{Action: action, ChatID: chatID, UserID: userID, MessageID: messageID}
+		return tu.InlineKeyboardButton(text).WithCallbackData(cb.Data())
+	}
+	return tu.InlineKeyboard(
+		tu.InlineKeyboardRow(
+			button("Ban", ModerationBan),
+			button("Unban / not spam", ModerationUnban),
+		),
+		tu.InlineKeyboardRow(
+			button("Delete original", ModerationDelete),
+			button("Mark user verified", ModerationVerify),
+		),
+	)
+}
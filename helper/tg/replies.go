@@ -0,0 +1,53 @@
+package tg
+
+import (
+	"sync"
+
+	"github.com/mymmrac/telego"
+
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+)
+
+// ReplyRecorder keeps replies to the message instead of sending them, all other requests are passed to the bot.
+// It allows to execute admin commands outside of telegram.
+type ReplyRecorder struct {
+	botAPI.BotAPI
+
+	chatID    int64
+	messageID int
+
+	mu      sync.Mutex
+	replies []string
+}
+
+func NewReplyRecorder(bot botAPI.BotAPI, message *telego.Message) *ReplyRecorder {
+	return &ReplyRecorder{
+		BotAPI:    bot,
+		chatID:    message.Chat.ID,
+		messageID: message.MessageID,
+		replies:   make([]string, 0),
+	}
+}
+
+func (r *ReplyRecorder) SendMessage(params *telego.SendMessageParams) (*telego.Message, error) {
+	if params.ChatID.Username != "" || params.ChatID.ID != r.chatID ||
+		params.ReplyParameters == nil || params.ReplyParameters.MessageID != r.messageID {
+		return r.BotAPI.SendMessage(params)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.replies = append(r.replies, params.Text)
+	return &telego.Message{
+		Chat: telego.Chat{ID: r.chatID},
+		Text: params.Text,
+	}, nil
+}
+
+// Replies returns texts of replies in order they were sent
+func (r *ReplyRecorder) Replies() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]string, len(r.replies))
+	copy(res, r.replies)
+	return res
+}
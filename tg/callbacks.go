@@ -0,0 +1,168 @@
+package tg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/audit"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/auditEvent"
+	"github.com/Civil/tg-simple-regex-antispam/filters/types/banRecord"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
+	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
+)
+
+func answerCallback(logger *zap.Logger, bot botAPI.BotAPI, query *telego.CallbackQuery, text string, alert bool) {
+	err := bot.AnswerCallbackQuery(&telego.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+		Text:            text,
+		ShowAlert:       alert,
+	})
+	if err != nil {
+		logger.Error("failed to answer callback query", zap.Error(err))
+	}
+}
+
+// HandleCallbackQuery passes callback query to the handler that is registered for the prefix of its data
+func (t *Telego) HandleCallbackQuery(bot botAPI.BotAPI, query telego.CallbackQuery) {
+	logger := t.logger.With(
+		zap.Int64("from_user_id", query.From.ID),
+		zap.String("callback_data", query.Data),
+	)
+	logger.Debug("got callback query")
+
+	prefix, _, _ := strings.Cut(query.Data, ":")
+	var err error
+	if h, ok := t.callbackHandlers[prefix]; ok {
+		err = h(logger, bot, &query)
+	} else {
+		var handled bool
+		handled, err = t.chains.HandleCallbackQuery(logger, bot, &query, prefix)
+		if !handled {
+			logger.Warn("unsupported callback query")
+			answerCallback(logger, bot, &query, "", false)
+			return
+		}
+	}
+	if err != nil {
+		logger.Error("failed to handle callback query", zap.Error(err))
+		answerCallback(logger, bot, &query, fmt.Sprintf("failed: %v", err), true)
+	}
+}
+
+func userDisplayName(user *telego.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return fmt.Sprintf("%v (%v)", user.FirstName, user.ID)
+}
+
+var moderationAuditActions = map[tg.ModerationAction]string{
+	tg.ModerationUnban:  audit.ActionUnban,
+	tg.ModerationDelete: audit.ActionDelete,
+	tg.ModerationVerify: audit.ActionVerify,
+}
+
+// handleModerationCallback applies action chosen by an admin on the card posted by forwardToChat action and
+// updates the card to show who did what
+func (t *Telego) handleModerationCallback(logger *zap.Logger, bot botAPI.BotAPI, query *telego.CallbackQuery) error {
+	cb, err := tg.ParseModerationCallback(query.Data)
+	if err != nil {
+		return err
+	}
+	logger = logger.With(
+		zap.String("action", string(cb.Action)),
+		zap.Int64("chat_id", cb.ChatID),
+		zap.Int64("user_id", cb.UserID),
+	)
+
+	if !t.isAdmin(query.From.ID, query.From.Username) && !t.isChatAdmin(logger, bot, telego.ChatID{ID: cb.ChatID}, query.From.ID) {
+		logger.Warn("user is not admin or chat admin")
+		answerCallback(logger, bot, query, "Only admins can do that", true)
+		return nil
+	}
+
+	chatID := telego.ChatID{ID: cb.ChatID}
+	card, _ := query.Message.(*telego.Message)
+	switch cb.Action {
+	case tg.ModerationBan:
+		record := &banRecord.BanRecord{
+			ChatId:  cb.ChatID,
+			AdminId: query.From.ID,
+			Reason:  "banned from moderation card",
+		}
+		// Card is a reply to the forwarded message, admin confirms that it's a spam
+		var spam *telego.Message
+		if card != nil && card.ReplyToMessage != nil {
+			spam = card.ReplyToMessage
+			record.MessageExcerpt = tg.MessageExcerpt(spam)
+		}
+		var chatIDs []int64
+		chatIDs, err = t.banDB.ChatsFor(cb.ChatID)
+		if err != nil {
+			return err
+		}
+		err = t.banDB.BanUser(cb.UserID, record)
+		if err != nil {
+			return err
+		}
+		err = tg.BanUserInChats(bot, chatIDs, cb.UserID, true)
+		if err == nil && spam != nil {
+			t.events.PublishTraining(events.Spam, tg.MessageText(spam))
+		}
+	case tg.ModerationUnban:
+		var chatIDs []int64
+		chatIDs, err = t.banDB.ChatsFor(cb.ChatID)
+		if err != nil {
+			return err
+		}
+		err = t.banDB.UnbanUser(cb.UserID)
+		if err != nil {
+			return err
+		}
+		err = tg.UnbanUserInChats(bot, chatIDs, cb.UserID)
+	case tg.ModerationDelete:
+		err = bot.DeleteMessage(tu.Delete(chatID, cb.MessageID))
+	case tg.ModerationVerify:
+		err = t.chains.MarkVerified(cb.UserID)
+		if err == nil && card != nil && card.ReplyToMessage != nil {
+			t.events.PublishTraining(events.Ham, tg.MessageText(card.ReplyToMessage))
+		}
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("moderation action applied", zap.Int64("admin_id", query.From.ID))
+	// bans are recorded by banDB
+	if cb.Action != tg.ModerationBan {
+		t.auditLog.Record(&auditEvent.AuditEvent{
+			Action:  moderationAuditActions[cb.Action],
+			ActorId: query.From.ID,
+			UserId:  cb.UserID,
+			ChatId:  cb.ChatID,
+			Reason:  "moderation card",
+		})
+	}
+
+	description := fmt.Sprintf("%v %v", userDisplayName(&query.From), cb.ActionDescription())
+	answerCallback(logger, bot, query, description, false)
+
+	if card == nil {
+		return nil
+	}
+	_, err = bot.EditMessageText(&telego.EditMessageTextParams{
+		ChatID:      card.Chat.ChatID(),
+		MessageID:   card.MessageID,
+		Text:        card.Text + "\n\n" + description,
+		Entities:    card.Entities,
+		ReplyMarkup: card.ReplyMarkup,
+	})
+	if err != nil {
+		logger.Error("failed to update moderation card", zap.Error(err))
+	}
+	return nil
+}
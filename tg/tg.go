@@ -2,43 +2,75 @@ package tg
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mymmrac/telego"
-	th "github.com/mymmrac/telego/telegohandler"
 	"go.uber.org/zap"
 
+	"github.com/Civil/tg-simple-regex-antispam/audit"
 	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
-	"github.com/Civil/tg-simple-regex-antispam/filters/interfaces"
+	"github.com/Civil/tg-simple-regex-antispam/chains"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI"
+	"github.com/Civil/tg-simple-regex-antispam/helper/events"
 	"github.com/Civil/tg-simple-regex-antispam/helper/logs"
+	"github.com/Civil/tg-simple-regex-antispam/helper/metrics"
+	"github.com/Civil/tg-simple-regex-antispam/helper/pipeline"
 	"github.com/Civil/tg-simple-regex-antispam/helper/tg"
 )
 
 type TgAPI interface {
 	Start()
 	Stop()
-	GetBot() *telego.Bot
-	UpdatePrefixes()
+	GetBot() botAPI.BotAPI
+	SetChains(manager *chains.Manager)
+	SetReloadFunc(reload func() error)
+	SetMessageRecorder(recorder MessageRecorder)
+	SetAuditLog(log *audit.Log)
+	SetEvents(hub *events.Hub)
+	ExecuteAdminCommand(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) (bool, error)
+}
+
+// MessageRecorder receives every message from allowed chats before it is scored
+type MessageRecorder interface {
+	Capture(msg *telego.Message) error
 }
 
 type Telego struct {
 	token  string
 	logger *zap.Logger
 
-	bot            *telego.Bot
-	filters        *[]interfaces.StatefulFilter
+	bot *telego.Bot
+	// api is used for all requests made while handling updates, it counts failed ones
+	api            botAPI.BotAPI
+	chains         *chains.Manager
 	adminIDs       map[int64]struct{}
 	adminUsernames map[string]struct{}
 	banDB          bannedDB.BanDB
 	allowedChats   map[int64]struct{}
+	webhook        config.WebhookConfig
+
+	pipeline     *pipeline.Pipeline
+	drainTimeout time.Duration
+	stopOnce     sync.Once
+
+	recorder MessageRecorder
+	auditLog *audit.Log
+	events   *events.Hub
 
-	handlers map[string]tg.AdminCMDHandlerFunc
+	handlers         map[string]tg.AdminCMDHandlerFunc
+	callbackHandlers map[string]tg.CallbackHandlerFunc
 }
 
-func New(logger *zap.Logger, token string, filters *[]interfaces.StatefulFilter, adminIDs []int64, allowedChats []int64, adminUsernames []string, banDB bannedDB.BanDB) (TgAPI,
-	error) {
+func New(logger *zap.Logger, token string, adminIDs []int64, allowedChats []int64, adminUsernames []string, banDB bannedDB.BanDB,
+	webhook config.WebhookConfig, pipelineCfg config.PipelineConfig,
+) (TgAPI, error) {
 	if token == "" || token == "your_telegram_bot_token" {
 		logger.Error("no token provided")
 		return nil, errors.New("no token provided")
@@ -59,24 +91,27 @@ func New(logger *zap.Logger, token string, filters *[]interfaces.StatefulFilter,
 		adminUsernamesMap[user] = struct{}{}
 	}
 
+	p, err := pipeline.New(logger, pipelineCfg.Workers, pipelineCfg.QueueSize, pipelineCfg.PerKeyQueueSize)
+	if err != nil {
+		return nil, err
+	}
+
 	t := &Telego{
 		banDB:          banDB,
 		logger:         logger,
 		token:          token,
-		filters:        filters,
 		adminIDs:       adminIDsMap,
 		adminUsernames: adminUsernamesMap,
 		allowedChats:   allowedChatsMap,
+		webhook:        webhook,
+		pipeline:       p,
+		drainTimeout:   pipelineCfg.DrainTimeout,
 		handlers:       make(map[string]tg.AdminCMDHandlerFunc),
 	}
-
-	for _, filter := range *filters {
-		logger.Info("registering filter", zap.String("filter", filter.GetFilterName()), zap.String("chain_name", filter.TGAdminPrefix()))
-		prefix := filter.TGAdminPrefix()
-		if prefix != "" {
-			t.handlers[prefix] = filter.HandleTGCommands
-		}
+	t.callbackHandlers = map[string]tg.CallbackHandlerFunc{
+		tg.ModerationCallbackPrefix: t.handleModerationCallback,
 	}
+
 	t.handlers[t.banDB.TGAdminPrefix()] = t.banDB.HandleTGCommands
 	t.handlers["listCmds"] = t.listAdminPrefixes
 
@@ -85,42 +120,57 @@ func New(logger *zap.Logger, token string, filters *[]interfaces.StatefulFilter,
 		return nil, err
 	}
 	t.bot = bot
+	t.api = metrics.InstrumentBot(bot)
 
 	return t, nil
 }
 
-func (t *Telego) UpdatePrefixes() {
-	for _, filter := range *t.filters {
-		prefix := filter.TGAdminPrefix()
-		keys := make([]string, 0)
-		for k := range t.handlers {
-			if strings.HasPrefix(k, prefix) {
-				keys = append(keys, k)
-			}
+func (t *Telego) SetMessageRecorder(recorder MessageRecorder) {
+	t.recorder = recorder
+}
+
+// SetAuditLog enables `audit` admin command and recording of moderation card actions
+func (t *Telego) SetAuditLog(log *audit.Log) {
+	t.auditLog = log
+	t.handlers[log.TGAdminPrefix()] = log.HandleTGCommands
+}
+
+// SetEvents sets hub where messages confirmed by admins as spam or not are published
+func (t *Telego) SetEvents(hub *events.Hub) {
+	t.events = hub
+}
+
+// SetChains sets chains that are applied to messages, their admin commands are available by chain names
+func (t *Telego) SetChains(manager *chains.Manager) {
+	t.chains = manager
+}
+
+// SetReloadFunc enables `reload` admin command
+func (t *Telego) SetReloadFunc(reload func() error) {
+	t.handlers["reload"] = func(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
+		text := "configuration reloaded"
+		err := reload()
+		if err != nil {
+			logger.Error("failed to reload configuration", zap.Error(err))
+			text = fmt.Sprintf("failed to reload configuration, previous one is still in use: %v", err)
 		}
-		t.logger.Debug("checking filter",
-			zap.String("filter", filter.GetFilterName()),
-			zap.String("filter_type", filter.GetName()),
-			zap.String("chain_name", prefix),
-			zap.Any("handlers", keys),
-		)
-
-		if prefix != "" {
-			t.logger.Debug("checking if filter was registered")
-			if _, ok := t.handlers[prefix]; !ok {
-				t.logger.Debug("registering filter", zap.String("filter", filter.GetFilterName()))
-				t.handlers[prefix] = filter.HandleTGCommands
-			}
+		sendErr := tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, text)
+		if sendErr != nil {
+			logger.Error("failed to send message", zap.Error(sendErr))
 		}
+		return err
 	}
 }
 
-func (t *Telego) listAdminPrefixes(logger *zap.Logger, bot *telego.Bot, message *telego.Message, _ []string) error {
+func (t *Telego) listAdminPrefixes(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, _ []string) error {
 	buf := bytes.NewBuffer([]byte{})
 	buf.WriteString("Available subcommands:\n\n")
 	for prefix := range t.handlers {
 		buf.WriteString("   " + prefix + "\n")
 	}
+	for _, prefix := range t.chains.AdminPrefixes() {
+		buf.WriteString("   " + prefix + "\n")
+	}
 
 	err := tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID, buf.String())
 	if err != nil {
@@ -129,7 +179,7 @@ func (t *Telego) listAdminPrefixes(logger *zap.Logger, bot *telego.Bot, message
 	return err
 }
 
-func (t *Telego) HandleAdminMessages(logger *zap.Logger, bot *telego.Bot, message *telego.Message) {
+func (t *Telego) HandleAdminMessages(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message) {
 	logger.Debug("admin command", zap.String("command", message.Text))
 	tokens := strings.Split(message.Text, " ")
 	if len(tokens) < 2 {
@@ -140,13 +190,8 @@ func (t *Telego) HandleAdminMessages(logger *zap.Logger, bot *telego.Bot, messag
 		return
 	}
 
-	if h, ok := t.handlers[tokens[1]]; ok {
-		var err error
-		if len(tokens) > 2 {
-			err = h(logger, bot, message, tokens[2:])
-		} else {
-			err = h(logger, bot, message, nil)
-		}
+	found, err := t.ExecuteAdminCommand(logger, bot, message, tokens[1:])
+	if found {
 		if err != nil {
 			logger.Error("failed to handle command", zap.Error(err))
 		}
@@ -154,13 +199,29 @@ func (t *Telego) HandleAdminMessages(logger *zap.Logger, bot *telego.Bot, messag
 	}
 
 	logger.Warn("unsupported command", zap.Any("message", message))
-	err := tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID,
+	err = tg.SendMessage(bot, message.Chat.ChatID(), &message.MessageID,
 		fmt.Sprintf("unsupported command: %v", message.Text))
 	if err != nil {
 		logger.Error("failed to send message", zap.Error(err))
 	}
 }
 
+// ExecuteAdminCommand runs command (tokens after `/admin`), replies are sent to the message. Returns false if there
+// is no such command.
+func (t *Telego) ExecuteAdminCommand(logger *zap.Logger, bot botAPI.BotAPI, message *telego.Message, tokens []string) (bool, error) {
+	if len(tokens) == 0 {
+		return true, t.listAdminPrefixes(logger, bot, message, nil)
+	}
+	var args []string
+	if len(tokens) > 1 {
+		args = tokens[1:]
+	}
+	if h, ok := t.handlers[tokens[0]]; ok {
+		return true, h(logger, bot, message, args)
+	}
+	return t.chains.HandleTGCommands(logger, bot, message, tokens[0], args)
+}
+
 func (t *Telego) isAdmin(userID int64, username string) bool {
 	if _, ok := t.adminIDs[userID]; ok {
 		return true
@@ -172,7 +233,25 @@ func (t *Telego) isAdmin(userID int64, username string) bool {
 	return false
 }
 
-func (t *Telego) HandleMessages(bot *telego.Bot, message telego.Message) {
+func (t *Telego) isChatAdmin(logger *zap.Logger, bot botAPI.BotAPI, chatID telego.ChatID, userID int64) bool {
+	logger.Debug("user is not in list of extra super users, checking chat admins")
+	params := &telego.GetChatAdministratorsParams{
+		ChatID: chatID,
+	}
+	chatAdmins, err := bot.GetChatAdministrators(params)
+	if err != nil {
+		logger.Error("failed to get chat administrators", zap.Error(err))
+	}
+	for _, admin := range chatAdmins {
+		if admin.MemberUser().ID == userID {
+			logger.Debug("user is chat admin", zap.Any("user_id", userID))
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Telego) HandleMessages(bot botAPI.BotAPI, message telego.Message) {
 	userID := message.From.ID
 	username := message.From.Username
 	logger := t.logger.With(
@@ -181,27 +260,9 @@ func (t *Telego) HandleMessages(bot *telego.Bot, message telego.Message) {
 	)
 	logger.Debug("got message", zap.Any("message", message))
 	if message.Text == "/admin" || strings.HasPrefix(message.Text, "/admin ") {
-		if !t.isAdmin(userID, username) {
-			logger.Debug("user is not in list of extra super users, checking chat admins")
-			params := &telego.GetChatAdministratorsParams{
-				ChatID: message.Chat.ChatID(),
-			}
-			chatAdmins, err := bot.GetChatAdministrators(params)
-			if err != nil {
-				logger.Error("failed to get chat administrators", zap.Error(err))
-			}
-			ok := false
-			for _, admin := range chatAdmins {
-				if admin.MemberUser().ID == userID {
-					ok = true
-					logger.Debug("user is chat admin", zap.Any("user_id", userID))
-					break
-				}
-			}
-			if !ok {
-				logger.Warn("user is not admin or chat admin", zap.Any("user_id", userID), zap.Any("message", message))
-				return
-			}
+		if !t.isAdmin(userID, username) && !t.isChatAdmin(logger, bot, message.Chat.ChatID(), userID) {
+			logger.Warn("user is not admin or chat admin", zap.Any("user_id", userID), zap.Any("message", message))
+			return
 		}
 		t.HandleAdminMessages(logger, bot, &message)
 		return
@@ -210,22 +271,22 @@ func (t *Telego) HandleMessages(bot *telego.Bot, message telego.Message) {
 		logger.Error("message doesn't come from allowed chat list", zap.Any("chat_id", message.Chat.ID), zap.Any("message", message))
 		return
 	}
-	for _, f := range *t.filters {
-		logger.Debug("applying filter",
-			zap.String("filter_name", f.GetFilterName()),
-			zap.String("filter_type", f.GetName()),
-		)
-		score := f.Score(t.bot, &message)
-		if score.Score > 0 {
+	metrics.MessagesProcessed.WithLabelValues(metrics.ChatID(message.Chat.ID)).Inc()
+	if t.recorder != nil {
+		err := t.recorder.Capture(&message)
+		if err != nil {
+			logger.Error("failed to capture message", zap.Error(err))
+		}
+	}
+	for _, res := range t.chains.Apply(bot, &message) {
+		if res.Score.Score > 0 {
 			logger.Info("message got scored",
-				zap.Int32("score", score.Score),
-				zap.String("score_reason", score.Reason),
+				zap.String("filter_name", res.Chain.GetFilterName()),
+				zap.String("filter_type", res.Chain.GetName()),
+				zap.Int32("score", res.Score.Score),
+				zap.String("score_reason", res.Score.Reason),
 				zap.Any("message", message),
 			)
-			if score.Score >= 100 && f.IsFinal() {
-				logger.Info("stop scoring")
-				break
-			}
 		}
 	}
 }
@@ -239,23 +300,171 @@ func (t *Telego) Start() {
 	}
 	t.logger.Info("bot user info", zap.Any("bot_user", botUser))
 
-	updates, _ := t.bot.UpdatesViaLongPolling(nil)
-	defer t.bot.StopLongPolling()
+	updates, err := t.getUpdates()
+	if err != nil {
+		t.logger.Error("failed to start receiving updates", zap.Error(err))
+		return
+	}
 
-	bh, _ := th.NewBotHandler(t.bot, updates)
-	defer bh.Stop()
+	t.logger.Info("telego initialized")
+	// Updates channel is closed once long polling or webhook is stopped
+	for update := range updates {
+		t.dispatch(update)
+	}
 
-	bh.HandleMessage(t.HandleMessages)
-	bh.HandleEditedMessage(t.HandleMessages)
+	ctx, cancel := context.WithTimeout(context.Background(), t.drainTimeout)
+	defer cancel()
+	err = t.pipeline.Stop(ctx)
+	if err != nil {
+		t.logger.Error("failed to process all pending updates", zap.Error(err))
+	}
+}
 
-	t.logger.Info("telego initialized")
-	bh.Start()
+func messageKeys(message *telego.Message) []pipeline.Key {
+	keys := []pipeline.Key{pipeline.Chat(message.Chat.ID)}
+	if message.From != nil {
+		keys = append(keys, pipeline.User(message.From.ID))
+	}
+	return keys
+}
+
+// dispatch sends update to the processing pipeline. Updates from the same chat or from the same user are processed
+// in order they were received.
+func (t *Telego) dispatch(update telego.Update) {
+	var message *telego.Message
+	switch {
+	case update.Message != nil:
+		message = update.Message
+	case update.EditedMessage != nil:
+		message = update.EditedMessage
+	case update.CallbackQuery != nil:
+		query := update.CallbackQuery
+		keys := []pipeline.Key{pipeline.User(query.From.ID)}
+		if query.Message != nil {
+			keys = append(keys, pipeline.Chat(query.Message.GetChat().ID))
+		}
+		err := t.pipeline.Submit(func() {
+			t.HandleCallbackQuery(t.api, *query)
+		}, keys...)
+		if err != nil {
+			t.logger.Error("failed to queue update", zap.Int("update_id", update.UpdateID), zap.Error(err))
+		}
+		return
+	case update.ChatMember != nil:
+		member := update.ChatMember
+		if !isJoin(member) {
+			return
+		}
+		user := member.NewChatMember.MemberUser()
+		err := t.pipeline.Submit(func() {
+			t.HandleNewMember(t.api, member.Chat, user)
+		}, pipeline.Chat(member.Chat.ID), pipeline.User(user.ID))
+		if err != nil {
+			t.logger.Error("failed to queue update", zap.Int("update_id", update.UpdateID), zap.Error(err))
+		}
+		return
+	default:
+		return
+	}
+
+	err := t.pipeline.Submit(func() {
+		t.HandleMessages(t.api, *message)
+	}, messageKeys(message)...)
+	if err != nil {
+		t.logger.Error("failed to queue update", zap.Int("update_id", update.UpdateID), zap.Error(err))
+	}
+}
+
+// isJoin returns true if update is about user that wasn't a member of the chat and became one
+func isJoin(member *telego.ChatMemberUpdated) bool {
+	if member.OldChatMember == nil || member.NewChatMember == nil {
+		return false
+	}
+	return !member.OldChatMember.MemberIsMember() && member.NewChatMember.MemberIsMember()
+}
+
+// HandleNewMember passes user that joined the chat to its chains
+func (t *Telego) HandleNewMember(bot botAPI.BotAPI, chat telego.Chat, user telego.User) {
+	logger := t.logger.With(
+		zap.Int64("chat_id", chat.ID),
+		zap.Int64("user_id", user.ID),
+	)
+	if _, ok := t.allowedChats[chat.ID]; !ok {
+		logger.Debug("chat is not allowed, ignoring new member")
+		return
+	}
+	logger.Debug("new chat member")
+	t.chains.HandleNewMember(logger, bot, chat, user)
 }
 
+// allowedUpdates must be requested explicitly, as chat_member updates are not sent by default
+var allowedUpdates = []string{"message", "edited_message", "callback_query", "chat_member"}
+
+// newWebhookServer returns server that receives updates from Telegram, webhook handler is registered on its ServeMux
+func (t *Telego) newWebhookServer() telego.HTTPWebhookServer {
+	return telego.HTTPWebhookServer{
+		Logger: t.bot.Logger(),
+		Server: &http.Server{
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		ServeMux:    http.NewServeMux(),
+		SecretToken: t.webhook.SecretToken,
+	}
+}
+
+// updatesViaWebhook registers webhook in Telegram and returns updates that are received by the server. Server is not
+// started.
+func (t *Telego) updatesViaWebhook(server telego.HTTPWebhookServer) (<-chan telego.Update, error) {
+	return t.bot.UpdatesViaWebhook(t.webhook.Path,
+		telego.WithWebhookServer(server),
+		telego.WithWebhookSet(&telego.SetWebhookParams{
+			URL:            t.webhook.URL(),
+			SecretToken:    t.webhook.SecretToken,
+			AllowedUpdates: allowedUpdates,
+		}),
+	)
+}
+
+func (t *Telego) getUpdates() (<-chan telego.Update, error) {
+	if !t.webhook.Enabled {
+		return t.bot.UpdatesViaLongPolling(&telego.GetUpdatesParams{AllowedUpdates: allowedUpdates})
+	}
+
+	t.logger.Info("receiving updates via webhook",
+		zap.String("listen_address", t.webhook.ListenAddress),
+		zap.String("path", t.webhook.Path),
+	)
+	updates, err := t.updatesViaWebhook(t.newWebhookServer())
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		// Blocks until webhook is stopped. In case of an error updates channel will be closed as well.
+		err := t.bot.StartWebhook(t.webhook.ListenAddress)
+		if err != nil {
+			t.logger.Error("webhook server failed", zap.Error(err))
+		}
+	}()
+	return updates, nil
+}
+
+// Stop stops receiving updates, which makes Start return once pending ones are processed. It is safe to call Stop
+// more than once, only the first call has an effect.
 func (t *Telego) Stop() {
-	t.bot.StopLongPolling()
+	t.stopOnce.Do(func() {
+		if t.webhook.Enabled {
+			err := t.bot.StopWebhook()
+			if err != nil {
+				t.logger.Error("failed to stop webhook", zap.Error(err))
+			}
+			return
+		}
+		t.bot.StopLongPolling()
+	})
 }
 
-func (t *Telego) GetBot() *telego.Bot {
-	return t.bot
+// GetBot returns bot that should be used for all requests outside of telegram updates processing
+func (t *Telego) GetBot() botAPI.BotAPI {
+	return t.api
 }
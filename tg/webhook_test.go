@@ -0,0 +1,243 @@
+package tg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mymmrac/telego"
+	"go.uber.org/zap"
+
+	"github.com/Civil/tg-simple-regex-antispam/bannedDB"
+	"github.com/Civil/tg-simple-regex-antispam/chains"
+	"github.com/Civil/tg-simple-regex-antispam/config"
+	"github.com/Civil/tg-simple-regex-antispam/helper/botAPI/fakeBot"
+)
+
+const (
+	testToken  = "123456789:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	testSecret = "secret"
+	testChatID = -100
+	testAdmin  = 42
+)
+
+// newTelegramAPI returns server that pretends to be Telegram Bot API and accepts every request, e.g. setWebhook
+func newTelegramAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"ok":true,"result":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newWebhookBot returns bot that receives updates via webhook served by local HTTP server. All requests that are made
+// while handling updates are recorded by the fake bot.
+func newWebhookBot(t *testing.T) (*Telego, *fakeBot.Bot, <-chan telego.Update, *httptest.Server) {
+	t.Helper()
+	logger := zap.NewNop()
+	dir := t.TempDir()
+
+	banDB, err := bannedDB.New(logger, map[string]any{"state_dir": dir + "/BannedDB"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = banDB.Close() })
+
+	webhook := config.WebhookConfig{
+		Enabled:       true,
+		ListenAddress: "127.0.0.1:0",
+		PublicURL:     "https://example.com",
+		Path:          "/webhook",
+		SecretToken:   testSecret,
+	}
+	pipelineCfg := config.PipelineConfig{Workers: 2, QueueSize: 10, PerKeyQueueSize: 10, DrainTimeout: time.Second}
+	api, err := New(logger, testToken, []int64{testAdmin}, []int64{testChatID}, nil, banDB, webhook, pipelineCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbot := api.(*Telego)
+
+	tbot.bot, err = telego.NewBot(testToken, telego.WithAPIServer(newTelegramAPI(t).URL), telego.WithDiscardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot := fakeBot.New()
+	tbot.api = bot
+
+	cfg := &config.Config{
+		StatefulFilters: []config.StatefulFilterConfig{
+			{
+				Name:       "checkNevents",
+				FilterName: "spam_filter",
+				Arguments:  map[string]any{"n": 3, "state_dir": dir + "/spam_filter"},
+				StatelessFilters: []config.StatelessFilteringRules{
+					{Name: "partialMatch", Arguments: map[string]any{"match": "buy crypto"}},
+				},
+				Actions: []config.ActionCfg{
+					{Name: "deleteAndBan", Arguments: map[string]any{"dryRun": false}},
+				},
+			},
+		},
+	}
+	builder := &chains.Builder{Logger: logger, BanDB: banDB, Bot: bot}
+	manager, err := builder.NewManager(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(manager.Close)
+	tbot.SetChains(manager)
+
+	server := tbot.newWebhookServer()
+	updates, err := tbot.updatesViaWebhook(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(server.ServeMux)
+	t.Cleanup(srv.Close)
+	return tbot, bot, updates, srv
+}
+
+func postUpdate(t *testing.T, url, secret string, update telego.Update) int {
+	t.Helper()
+	body, err := json.Marshal(update)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url+"/webhook", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(telego.WebhookSecretTokenHeader, secret)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+// receive dispatches next update that came through webhook and waits until it is processed
+func receive(t *testing.T, tbot *Telego, updates <-chan telego.Update) {
+	t.Helper()
+	select {
+	case update := <-updates:
+		tbot.dispatch(update)
+	case <-time.After(5 * time.Second):
+		t.Fatal("update was not received")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := tbot.pipeline.Stop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func message(id int, userID int64, text string) telego.Update {
+	return telego.Update{
+		UpdateID: id,
+		Message: &telego.Message{
+			MessageID: id,
+			From:      &telego.User{ID: userID, FirstName: "user"},
+			Chat:      telego.Chat{ID: testChatID, Type: telego.ChatTypeSupergroup},
+			Date:      time.Now().Unix(),
+			Text:      text,
+		},
+	}
+}
+
+func TestWebhookSpamIsBanned(t *testing.T) {
+	tbot, bot, updates, srv := newWebhookBot(t)
+
+	code := postUpdate(t, srv.URL, testSecret, message(1, 1000, "buy crypto here"))
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code: %v", code)
+	}
+	receive(t, tbot, updates)
+
+	bans := bot.CallsTo(fakeBot.MethodBanChatMember)
+	if len(bans) != 1 {
+		t.Fatalf("expected 1 ban, got %v", len(bans))
+	}
+	params := bans[0].Params.(*telego.BanChatMemberParams)
+	if params.UserID != 1000 || params.ChatID.ID != testChatID {
+		t.Errorf("unexpected ban: %+v", params)
+	}
+	if len(bot.CallsTo(fakeBot.MethodDeleteMessages)) != 1 {
+		t.Errorf("messages of the spammer were not deleted")
+	}
+	if !tbot.banDB.IsBanned(1000) {
+		t.Errorf("user is not in banDB")
+	}
+}
+
+func TestWebhookAdminCommand(t *testing.T) {
+	tbot, bot, updates, srv := newWebhookBot(t)
+
+	code := postUpdate(t, srv.URL, testSecret, message(1, testAdmin, "/admin listCmds"))
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code: %v", code)
+	}
+	receive(t, tbot, updates)
+
+	replies := bot.CallsTo(fakeBot.MethodSendMessage)
+	if len(replies) != 1 {
+		t.Fatalf("expected 1 reply, got %v", len(replies))
+	}
+	text := replies[0].Params.(*telego.SendMessageParams).Text
+	for _, prefix := range []string{"bandb", "spam_filter"} {
+		if !strings.Contains(text, prefix) {
+			t.Errorf("reply doesn't list %q: %v", prefix, text)
+		}
+	}
+}
+
+func TestWebhookRejectsRequests(t *testing.T) {
+	tbot, bot, updates, srv := newWebhookBot(t)
+
+	tests := []struct {
+		name   string
+		secret string
+		want   int
+	}{
+		{name: "no secret", secret: "", want: http.StatusUnauthorized},
+		{name: "wrong secret", secret: "wrong", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := postUpdate(t, srv.URL, tt.secret, message(1, 1000, "buy crypto here"))
+			if code != tt.want {
+				t.Errorf("got status code %v, want %v", code, tt.want)
+			}
+		})
+	}
+
+	resp, err := http.Get(srv.URL + "/webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("got status code %v for GET, want %v", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+
+	select {
+	case update := <-updates:
+		t.Fatalf("rejected update was delivered: %+v", update)
+	default:
+	}
+	_ = tbot.pipeline.Stop(context.Background())
+	if calls := bot.Calls(); len(calls) != 0 {
+		t.Errorf("unexpected calls to bot api: %+v", calls)
+	}
+}